@@ -0,0 +1,26 @@
+// Package auth 服务端和客户端共用的鉴权配置，不依赖其他包，客户端不需要引入服务端的实现
+package auth
+
+// LaptopServicePath LaptopService方法路径的前缀
+const LaptopServicePath = "/LaptopService/"
+
+// AccessibleRoles 需要鉴权的方法路径及对应的有访问权限的角色列表，
+// 服务端用于鉴权，客户端根据它判断调用时是否需要携带token，两边使用同一份列表
+func AccessibleRoles() map[string][]string {
+	return map[string][]string{
+		LaptopServicePath + "CreateLaptop":      {"admin"},
+		LaptopServicePath + "UpdateLaptop":      {"admin"},
+		LaptopServicePath + "DeleteLaptop":      {"admin"},
+		LaptopServicePath + "UploadImage":       {"admin"},
+		LaptopServicePath + "DeleteImage":       {"admin"},
+		LaptopServicePath + "CreateImageUpload": {"admin"},
+		LaptopServicePath + "UploadImageChunks": {"admin"},
+		LaptopServicePath + "GetImageUpload":    {"admin"},
+		LaptopServicePath + "FinishImageUpload": {"admin"},
+		LaptopServicePath + "RateLaptop":        {"admin", "user"},
+		LaptopServicePath + "GetMyRating":       {"admin", "user"},
+		LaptopServicePath + "DeleteMyRating":    {"admin", "user"},
+		LaptopServicePath + "CreateReview":      {"admin", "user"},
+		LaptopServicePath + "VoteReviewHelpful": {"admin", "user"},
+	}
+}
@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"pcbook/pb"
+	"strings"
+	"testing"
+)
+
+// TestAccessibleRoles 鉴权列表中的方法都存在，客户端和服务端共用该列表，拼写错误会导致方法不需要鉴权
+func TestAccessibleRoles(t *testing.T) {
+	t.Parallel()
+
+	methods := pb.File_laptop_service_proto.Services().ByName("LaptopService").Methods()
+	for path, roles := range AccessibleRoles() {
+		require.True(t, strings.HasPrefix(path, LaptopServicePath), path)
+		name := protoreflect.Name(strings.TrimPrefix(path, LaptopServicePath))
+		require.NotNil(t, methods.ByName(name), path)
+		require.Contains(t, roles, "admin", path)
+	}
+}
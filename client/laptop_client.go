@@ -3,10 +3,14 @@ package client
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -14,6 +18,8 @@ import (
 	"time"
 )
 
+const _maxUploadAttempts = 5 //断点续传上传图片时最多尝试上传的次数
+
 type LaptopClient struct {
 	service pb.LaptopServiceClient
 }
@@ -47,16 +53,103 @@ func (client *LaptopClient) CreateLaptop(laptop *pb.Laptop) {
 	log.Printf("created laptop with id: %s", res.Id)
 }
 
-// SearchLaptop 服务端流模式，根据条件筛选符合要求的laptop
-func (client *LaptopClient) SearchLaptop(filter *pb.Filter) {
-	log.Printf("search filter: %v", filter)
+// GetLaptop 根据id获取laptop
+func (client *LaptopClient) GetLaptop(laptopID string) *pb.Laptop {
+	req := &pb.GetLaptopRequest{
+		Id: laptopID,
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	res, err := client.service.GetLaptop(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.NotFound {
+			log.Print("laptop not found")
+		} else {
+			log.Fatalf("cannot get laptop: %v", err)
+		}
+		return nil
+	}
+
+	log.Printf("got laptop with id: %s", res.GetLaptop().GetId())
+	return res.GetLaptop()
+}
+
+// UpdateLaptop 更新laptop，paths为空时整体替换，否则只更新指定的字段
+func (client *LaptopClient) UpdateLaptop(laptop *pb.Laptop, paths ...string) {
+	req := &pb.UpdateLaptopRequest{
+		Laptop: laptop,
+	}
+	if len(paths) > 0 {
+		req.UpdateMask = &fieldmaskpb.FieldMask{Paths: paths}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.UpdateLaptop(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.NotFound {
+			log.Print("laptop not found")
+		} else {
+			log.Fatalf("cannot update laptop: %v", err)
+		}
+		return
+	}
+
+	log.Printf("updated laptop with id: %s", res.GetLaptop().GetId())
+}
+
+// DeleteLaptop 根据id删除laptop
+func (client *LaptopClient) DeleteLaptop(laptopID string) {
+	req := &pb.DeleteLaptopRequest{
+		Id: laptopID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.DeleteLaptop(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.NotFound {
+			log.Print("laptop not found")
+		} else {
+			log.Fatalf("cannot delete laptop: %v", err)
+		}
+		return
+	}
+
+	log.Printf("deleted laptop with id: %s", res.GetId())
+}
+
+// SearchLaptop 服务端流模式，根据条件筛选符合要求的laptop
+func (client *LaptopClient) SearchLaptop(filter *pb.Filter) {
+	log.Printf("search filter: %v", filter)
+
 	req := &pb.SearchLaptopRequest{
 		Filter: filter,
 	}
+	client.searchLaptop(req)
+}
+
+// SearchLaptopByQuery 服务端流模式，根据文本查询语句筛选符合要求的laptop
+func (client *LaptopClient) SearchLaptopByQuery(query string) {
+	log.Printf("search query: %s", query)
+
+	req := &pb.SearchLaptopRequest{
+		Query: query,
+	}
+	client.searchLaptop(req)
+}
+
+// searchLaptop 发送搜索请求，并打印搜索结果
+func (client *LaptopClient) searchLaptop(req *pb.SearchLaptopRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
 	stream, err := client.service.SearchLaptop(ctx, req)
 	if err != nil {
@@ -82,14 +175,124 @@ func (client *LaptopClient) SearchLaptop(filter *pb.Filter) {
 	}
 }
 
-// UploadImage 客户端流模式，分chunk上传图片
-func (client *LaptopClient) UploadImage(laptopID, imagePath string) {
+// AggregateLaptops 统计符合filter的laptop的分面数量及价格
+func (client *LaptopClient) AggregateLaptops(filter *pb.Filter) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &pb.AggregateLaptopsRequest{
+		Filter: filter,
+	}
+	res, err := client.service.AggregateLaptops(ctx, req)
+	if err != nil {
+		log.Fatalf("cannot aggregate laptops: %v", err)
+	}
+
+	aggregation := res.GetAggregation()
+	log.Print("total: ", aggregation.GetTotalCount())
+	log.Printf("price: min %.2f, max %.2f, avg %.2f", aggregation.GetMinPrice(), aggregation.GetMaxPrice(), aggregation.GetAvgPrice())
+	logFacets := func(name string, facets []*pb.FacetCount) {
+		log.Print(name, ":")
+		for _, facet := range facets {
+			log.Printf("	 + %s: %d", facet.GetValue(), facet.GetCount())
+		}
+	}
+	logFacets("brands", aggregation.GetBrands())
+	logFacets("cpu brands", aggregation.GetCpuBrands())
+	logFacets("ram", aggregation.GetRamBuckets())
+	logFacets("price", aggregation.GetPriceBuckets())
+	logFacets("screen panels", aggregation.GetScreenPanels())
+}
+
+// ListLaptops 按orderBy排序，逐页查询所有laptop
+func (client *LaptopClient) ListLaptops(pageSize int32, orderBy string) {
+	pageToken := ""
+	for page := 1; ; page++ {
+		req := &pb.ListLaptopsRequest{
+			PageSize:  pageSize,
+			PageToken: pageToken,
+			OrderBy:   orderBy,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		res, err := client.service.ListLaptops(ctx, req)
+		cancel()
+		if err != nil {
+			log.Fatalf("cannot list laptops: %v", err)
+		}
+
+		log.Printf("page %d:", page)
+		for _, laptop := range res.GetLaptops() {
+			log.Print("- found: ", laptop.GetId())
+			log.Print("	 + brand: ", laptop.GetBrand())
+			log.Print("	 + name: ", laptop.GetName())
+			log.Print("	 + price: ", laptop.GetPriceUsed())
+		}
+
+		pageToken = res.GetNextPageToken()
+		if pageToken == "" {
+			return
+		}
+	}
+}
+
+// WatchLaptops 持续接收符合filter的laptop变更事件，连接断开后使用最后收到的resume token重新订阅
+func (client *LaptopClient) WatchLaptops(filter *pb.Filter) {
+	resumeToken := ""
+	for {
+		req := &pb.WatchLaptopsRequest{
+			Filter:      filter,
+			ResumeToken: resumeToken,
+		}
+		stream, err := client.service.WatchLaptops(context.Background(), req)
+		if err != nil {
+			log.Fatalf("cannot watch laptops: %v", err)
+		}
+
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				st, ok := status.FromError(err)
+				if ok && st.Code() == codes.ResourceExhausted {
+					//消费过慢被服务端断开，重新订阅
+					log.Printf("watch is interrupted, resume from token %q", resumeToken)
+					break
+				}
+				if err == io.EOF {
+					return
+				}
+				log.Fatalf("cannot receive event: %v", err)
+			}
+			event := res.GetEvent()
+			laptop := event.GetLaptop()
+			log.Printf("- %v: %s", event.GetType(), laptop.GetId())
+			log.Print("	 + brand: ", laptop.GetBrand())
+			log.Print("	 + name: ", laptop.GetName())
+			log.Print("	 + price: ", laptop.GetPriceUsed())
+			resumeToken = event.GetResumeToken()
+		}
+	}
+}
+
+// UploadImage 客户端流模式，分chunk上传图片，返回服务器生成的图片id
+func (client *LaptopClient) UploadImage(laptopID, imagePath string) string {
 	file, err := os.Open(imagePath)
 	if err != nil {
 		log.Fatal("cannot open image file:", err)
 	}
 	defer file.Close()
 
+	//先计算图片的SHA-256，服务器据此校验接收的内容是否完整
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		log.Fatal("cannot read image file:", err)
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		log.Fatal("cannot seek image file:", err)
+	}
+
 	//如果server响应时间超过5秒则返回DeadlineExceeded err
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -105,6 +308,7 @@ func (client *LaptopClient) UploadImage(laptopID, imagePath string) {
 			Info: &pb.ImageInfo{
 				LaptopId:  laptopID,
 				ImageType: filepath.Ext(imagePath),
+				Checksum:  hex.EncodeToString(hash.Sum(nil)),
 			},
 		},
 	}
@@ -147,7 +351,216 @@ func (client *LaptopClient) UploadImage(laptopID, imagePath string) {
 		log.Fatal("cannot receive response:", err)
 	}
 
-	log.Printf("image uploaded with id: %s, size: %d", res.GetId(), res.GetSize())
+	log.Printf("image uploaded with id: %s, size: %d, checksum: %s", res.GetId(), res.GetSize(), res.GetChecksum())
+	return res.GetId()
+}
+
+// UploadImageResumable 断点续传上传图片，连接中断后查询服务器已接收的字节数并从该位置继续上传，返回服务器生成的图片id
+func (client *LaptopClient) UploadImageResumable(laptopID, imagePath string) string {
+	data, err := ioutil.ReadFile(imagePath)
+	if err != nil {
+		log.Fatal("cannot read image file:", err)
+	}
+	sum := sha256.Sum256(data)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	upload, err := client.service.CreateImageUpload(ctx, &pb.CreateImageUploadRequest{
+		Info: &pb.ImageInfo{
+			LaptopId:  laptopID,
+			ImageType: filepath.Ext(imagePath),
+			Checksum:  hex.EncodeToString(sum[:]),
+		},
+	})
+	if err != nil {
+		log.Fatalf("cannot create image upload: %v", err)
+	}
+	log.Printf("image upload created with id: %s", upload.GetUploadId())
+
+	offset := upload.GetOffset()
+	for attempt := 1; ; attempt++ {
+		err = client.uploadImageChunks(upload.GetUploadId(), data, offset)
+		if err == nil {
+			break
+		}
+		if attempt == _maxUploadAttempts {
+			log.Fatalf("cannot upload image chunks: %v", err)
+		}
+
+		//连接中断后从服务器已接收的位置继续上传
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		upload, err = client.service.GetImageUpload(ctx, &pb.GetImageUploadRequest{UploadId: upload.GetUploadId()})
+		cancel()
+		if err != nil {
+			log.Fatalf("cannot get image upload: %v", err)
+		}
+		offset = upload.GetOffset()
+		log.Printf("upload is interrupted, resume from offset %d", offset)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := client.service.FinishImageUpload(ctx, &pb.FinishImageUploadRequest{UploadId: upload.GetUploadId()})
+	if err != nil {
+		log.Fatalf("cannot finish image upload: %v", err)
+	}
+
+	log.Printf("image uploaded with id: %s, size: %d, checksum: %s", res.GetId(), res.GetSize(), res.GetChecksum())
+	return res.GetId()
+}
+
+// uploadImageChunks 从offset开始分chunk上传data剩余的数据
+func (client *LaptopClient) uploadImageChunks(uploadID string, data []byte, offset uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.service.UploadImageChunks(ctx)
+	if err != nil {
+		return err
+	}
+	for offset < uint64(len(data)) {
+		end := offset + 1024
+		if end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		err = stream.Send(&pb.UploadImageChunkRequest{
+			UploadId:  uploadID,
+			Offset:    offset,
+			ChunkData: data[offset:end],
+		})
+		if err != nil {
+			//服务端关闭流时Send返回EOF，具体的错误由CloseAndRecv返回
+			break
+		}
+		offset = end
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// DownloadImage 服务端流模式，分chunk下载图片并保存到imagePath
+func (client *LaptopClient) DownloadImage(laptopID, imageID, imagePath string) {
+	req := &pb.DownloadImageRequest{
+		LaptopId: laptopID,
+		ImageId:  imageID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.service.DownloadImage(ctx, req)
+	if err != nil {
+		log.Fatal("cannot download image:", err)
+	}
+
+	//第一次接收图片信息
+	res, err := stream.Recv()
+	if err != nil {
+		log.Fatal("cannot receive image info:", err)
+	}
+	info := res.GetInfo()
+
+	file, err := os.Create(imagePath)
+	if err != nil {
+		log.Fatal("cannot create image file:", err)
+	}
+	defer file.Close()
+
+	//之后接收图片chunk data，同时计算SHA-256
+	size := 0
+	hash := sha256.New()
+	writer := io.MultiWriter(file, hash)
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal("cannot receive chunk data:", err)
+		}
+		n, err := writer.Write(res.GetChunkData())
+		if err != nil {
+			log.Fatal("cannot write image file:", err)
+		}
+		size += n
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if info.GetChecksum() != "" && info.GetChecksum() != checksum {
+		log.Fatalf("downloaded image is corrupted: checksum %s != %s", checksum, info.GetChecksum())
+	}
+
+	log.Printf("image downloaded to %s, type: %s, size: %d/%d", imagePath, info.GetImageType(), size, info.GetSize())
+}
+
+// GetImageURL 获取图片的临时下载链接，服务端的图片存储器不支持时返回空字符串
+func (client *LaptopClient) GetImageURL(laptopID, imageID string, size uint32) string {
+	req := &pb.GetImageUrlRequest{
+		LaptopId: laptopID,
+		ImageId:  imageID,
+		Size:     size,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.GetImageUrl(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.Unimplemented {
+			log.Print("image download url is not supported")
+		} else {
+			log.Fatalf("cannot get image url: %v", err)
+		}
+		return ""
+	}
+
+	log.Printf("image url: %s, expires at: %v", res.GetUrl(), res.GetExpireTime().AsTime())
+	return res.GetUrl()
+}
+
+// ListLaptopImages 查询laptop的所有图片
+func (client *LaptopClient) ListLaptopImages(laptopID string) []*pb.LaptopImage {
+	req := &pb.ListLaptopImagesRequest{
+		LaptopId: laptopID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.ListLaptopImages(ctx, req)
+	if err != nil {
+		log.Fatalf("cannot list laptop images: %v", err)
+	}
+
+	for _, image := range res.GetImages() {
+		log.Printf("- image %s, type: %s, size: %d", image.GetId(), image.GetImageType(), image.GetSize())
+	}
+	return res.GetImages()
+}
+
+// DeleteImage 删除laptop的图片
+func (client *LaptopClient) DeleteImage(laptopID, imageID string) {
+	req := &pb.DeleteImageRequest{
+		LaptopId: laptopID,
+		ImageId:  imageID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.service.DeleteImage(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.NotFound {
+			log.Print("image is not exist")
+		} else {
+			log.Fatalf("cannot delete image: %v", err)
+		}
+		return
+	}
+
+	log.Printf("deleted image with id: %s", imageID)
 }
 
 // RateLaptop 双向流模式，提交laptop的评分
@@ -173,6 +586,10 @@ func (client *LaptopClient) RateLaptop(laptopIDs []string, scores []float64) {
 				waitResponse <- err
 				return
 			}
+			if res.GetError() != nil {
+				log.Printf("laptop %s is not rated: %v", res.GetLaptopId(), status.FromProto(res.GetError()).Err())
+				continue
+			}
 			log.Print("receive res:", res)
 		}
 	}()
@@ -200,3 +617,170 @@ func (client *LaptopClient) RateLaptop(laptopIDs []string, scores []float64) {
 		log.Fatal("receive response failed:", err)
 	}
 }
+
+// GetMyRating 查询当前用户对laptop的评分
+func (client *LaptopClient) GetMyRating(laptopID string) {
+	req := &pb.GetMyRatingRequest{
+		LaptopId: laptopID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.GetMyRating(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.NotFound {
+			log.Print("laptop is not rated")
+		} else {
+			log.Fatalf("cannot get my rating: %v", err)
+		}
+		return
+	}
+
+	log.Printf("my rating of laptop %s: %v", res.GetLaptopId(), res.GetScore())
+}
+
+// DeleteMyRating 删除当前用户对laptop的评分
+func (client *LaptopClient) DeleteMyRating(laptopID string) {
+	req := &pb.DeleteMyRatingRequest{
+		LaptopId: laptopID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.DeleteMyRating(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.NotFound {
+			log.Print("laptop is not rated")
+		} else {
+			log.Fatalf("cannot delete my rating: %v", err)
+		}
+		return
+	}
+
+	log.Printf("deleted my rating of laptop %s, rated count: %d, average score: %v",
+		res.GetLaptopId(), res.GetRatedCount(), res.GetAverageScore())
+}
+
+// CreateReview 新建laptop的评价
+func (client *LaptopClient) CreateReview(laptopID string, score float64, title, body string) {
+	req := &pb.CreateReviewRequest{
+		LaptopId: laptopID,
+		Score:    score,
+		Title:    title,
+		Body:     body,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.CreateReview(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.AlreadyExists {
+			log.Print("laptop is already reviewed")
+		} else {
+			log.Fatalf("cannot create review: %v", err)
+		}
+		return
+	}
+
+	log.Printf("created review with id: %s, rated count: %d, average score: %v",
+		res.GetReview().GetId(), res.GetRatedCount(), res.GetAverageScore())
+}
+
+// ListReviews 分页查询laptop的所有评价
+func (client *LaptopClient) ListReviews(laptopID string, order pb.ListReviewsRequest_Order) []*pb.Review {
+	req := &pb.ListReviewsRequest{
+		LaptopId: laptopID,
+		Order:    order,
+	}
+
+	var reviews []*pb.Review
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		res, err := client.service.ListReviews(ctx, req)
+		cancel()
+		if err != nil {
+			log.Fatalf("cannot list reviews: %v", err)
+		}
+		for _, review := range res.GetReviews() {
+			log.Printf("- review %s by %s, score: %v, helpful votes: %d, title: %s",
+				review.GetId(), review.GetAuthor(), review.GetScore(), review.GetHelpfulVotes(), review.GetTitle())
+		}
+		reviews = append(reviews, res.GetReviews()...)
+		if res.GetNextPageToken() == "" {
+			return reviews
+		}
+		req.PageToken = res.GetNextPageToken()
+	}
+}
+
+// VoteReviewHelpful 投票认为评价有帮助
+func (client *LaptopClient) VoteReviewHelpful(reviewID string) {
+	req := &pb.VoteReviewHelpfulRequest{
+		ReviewId: reviewID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.VoteReviewHelpful(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && (st.Code() == codes.AlreadyExists || st.Code() == codes.FailedPrecondition) {
+			log.Printf("cannot vote review: %s", st.Message())
+		} else {
+			log.Fatalf("cannot vote review: %v", err)
+		}
+		return
+	}
+
+	log.Printf("voted review %s, helpful votes: %d", res.GetReviewId(), res.GetHelpfulVotes())
+}
+
+// GetRatingStats 查询laptop的评分统计
+func (client *LaptopClient) GetRatingStats(laptopID string) {
+	req := &pb.GetRatingStatsRequest{
+		LaptopId: laptopID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.GetRatingStats(ctx, req)
+	if err != nil {
+		log.Fatalf("cannot get rating stats: %v", err)
+	}
+
+	stats := res.GetStats()
+	log.Printf("rating stats of laptop %s: count: %d, mean: %v, median: %v, weighted score: %v",
+		stats.GetLaptopId(), stats.GetCount(), stats.GetMean(), stats.GetMedian(), stats.GetWeightedScore())
+	for _, bucket := range stats.GetDistribution() {
+		log.Printf("- score %v: %d", bucket.GetScore(), bucket.GetCount())
+	}
+}
+
+// TopRatedLaptops 查询加权评分最高的laptop
+func (client *LaptopClient) TopRatedLaptops(filter *pb.Filter, limit uint32) {
+	req := &pb.TopRatedLaptopsRequest{
+		Filter: filter,
+		Limit:  limit,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.service.TopRatedLaptops(ctx, req)
+	if err != nil {
+		log.Fatalf("cannot get top rated laptops: %v", err)
+	}
+
+	for i, rated := range res.GetLaptops() {
+		log.Printf("%d. laptop %s, rated count: %d, weighted score: %v",
+			i+1, rated.GetLaptop().GetId(), rated.GetStats().GetCount(), rated.GetStats().GetWeightedScore())
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"google.golang.org/grpc/credentials"
 	"io/ioutil"
 	"log"
+	"pcbook/auth"
 	"pcbook/client"
 	"pcbook/pb"
 	"pcbook/sample"
@@ -17,19 +18,18 @@ import (
 )
 
 const (
-	_username          = "admin1"
-	_password          = "secret"
-	_refreshDuration   = 30 * time.Second
-	_laptopServicePath = "/LaptopService/"
+	_username        = "admin1"
+	_password        = "secret"
+	_refreshDuration = 30 * time.Second
 )
 
-// authMethods 需要鉴权验证的方法
+// authMethods 需要鉴权验证的方法，与服务端的鉴权列表一致
 func authMethods() map[string]bool {
-	return map[string]bool{
-		_laptopServicePath + "CreateLaptop": true,
-		_laptopServicePath + "UploadImage":  true,
-		_laptopServicePath + "RateLaptop":   true,
+	methods := make(map[string]bool)
+	for method := range auth.AccessibleRoles() {
+		methods[method] = true
 	}
+	return methods
 }
 
 // loadTLSCredentials 加载客户端证书，私钥，以及ca根证书
@@ -58,6 +58,8 @@ func loadTLSCredentials() (credentials.TransportCredentials, error) {
 func main() {
 	serverAddr := flag.String("address", "", "rpc server address")
 	enableTLS := flag.Bool("tls", false, "enable SSL/TLS")
+	query := flag.String("query", "", "search laptops with a query, e.g. \"brand:Apple price<2000 ram>=16GB\"")
+	watch := flag.Bool("watch", false, "watch laptop changes until interrupted")
 	flag.Parse()
 	log.Printf("dial server %s, TLS = %t", *serverAddr, *enableTLS)
 
@@ -94,7 +96,16 @@ func main() {
 		grpc.WithStreamInterceptor(interceptor.Stream()),
 	)
 	laptopClient := client.NewLaptopClient(conn2)
+	if *query != "" {
+		laptopClient.SearchLaptopByQuery(*query)
+		return
+	}
+	if *watch {
+		laptopClient.WatchLaptops(nil)
+		return
+	}
 	//testUploadImage(laptopClient)
+	//testReviewLaptop(laptopClient)
 	testRateLaptop(laptopClient)
 
 }
@@ -123,7 +134,12 @@ func testSearchLaptop(laptopClient *client.LaptopClient) {
 func testUploadImage(laptopClient *client.LaptopClient) {
 	laptop := sample.NewLaptop()
 	laptopClient.CreateLaptop(laptop)
-	laptopClient.UploadImage(laptop.Id, "tmp/laptop.png")
+	imageID := laptopClient.UploadImage(laptop.Id, "tmp/laptop.png")
+	laptopClient.UploadImageResumable(laptop.Id, "tmp/laptop.png")
+	laptopClient.DownloadImage(laptop.Id, imageID, "tmp/laptop_download.png")
+	laptopClient.GetImageURL(laptop.Id, imageID, 0)
+	laptopClient.ListLaptopImages(laptop.Id)
+	laptopClient.DeleteImage(laptop.Id, imageID)
 }
 
 func testRateLaptop(laptopClient *client.LaptopClient) {
@@ -148,8 +164,19 @@ func testRateLaptop(laptopClient *client.LaptopClient) {
 			scores[i] = sample.RandomLaptopScore()
 		}
 		laptopClient.RateLaptop(laptopIDs, scores)
+		laptopClient.GetMyRating(laptopIDs[0])
 	}
+	laptopClient.GetRatingStats(laptopIDs[0])
+	laptopClient.TopRatedLaptops(nil, uint32(count))
+	laptopClient.DeleteMyRating(laptopIDs[0])
+
+}
 
+func testReviewLaptop(laptopClient *client.LaptopClient) {
+	laptop := sample.NewLaptop()
+	laptopClient.CreateLaptop(laptop)
+	laptopClient.CreateReview(laptop.Id, sample.RandomLaptopScore(), "great laptop", "fast and light")
+	laptopClient.ListReviews(laptop.Id, pb.ListReviewsRequest_MOST_HELPFUL)
 }
 
 func testLogin(authClient *client.AuthClient) {
@@ -4,37 +4,45 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"pcbook/auth"
 	"pcbook/pb"
 	"pcbook/service"
+	goruntime "runtime"
+	"syscall"
 	"time"
 )
 
 const (
-	_secretKey         = "secret"         //用于签名和验证token的密钥
-	_tokenDuration     = 15 * time.Minute //token有效时长
-	_laptopServicePath = "/LaptopService/"
-	_serverPem         = "cert/server.pem"
-	_serverKey         = "cert/server.key"
-	_caPem             = "cert/ca.pem"
+	_secretKey        = "secret"         //用于签名和验证token的密钥
+	_tokenDuration    = 15 * time.Minute //token有效时长
+	_serverPem        = "cert/server.pem"
+	_serverKey        = "cert/server.key"
+	_caPem            = "cert/ca.pem"
+	_eventLogSize     = 1000            //保存最近的laptop变更事件数量，用于断线重连后补发
+	_snapshotInterval = 5 * time.Minute //file存储器生成快照的间隔
+	_resizeQueueSize  = 100             //等待生成缩略图的图片的最大数量
+	_uploadCleanup    = time.Minute     //清除过期的上传会话的间隔
 )
 
-// accessibleRoles 方法路径及对应的有访问权限的角色列表
-func accessibleRoles() map[string][]string {
-	return map[string][]string{
-		_laptopServicePath + "CreateLaptop": {"admin"},
-		_laptopServicePath + "UploadImage":  {"admin"},
-		_laptopServicePath + "RateLaptop":   {"admin", "user"},
-	}
-}
+// _shutdownTimeout 退出时等待处理中的请求完成的最长时间
+const _shutdownTimeout = 30 * time.Second
+
+// _gatewayMessageOverhead REST网关接收GetImage响应时，图片数据之外的消息开销
+const _gatewayMessageOverhead = 64 << 10
 
 // seedUsers 模拟生成管理员及普通用户
 func seedUsers(userStore service.UserStore) error {
@@ -51,7 +59,90 @@ func createUser(userStore service.UserStore, username, password, role string) er
 	if err != nil {
 		return err
 	}
-	return userStore.Save(user)
+	err = userStore.Save(user)
+	//使用持久化存储时，重启后用户已经存在
+	if errors.Is(err, service.ErrAlreadyExists) {
+		return nil
+	}
+	return err
+}
+
+// stores 服务端使用的存储器
+type stores struct {
+	laptop service.LaptopStore
+	user   service.UserStore
+	rate   service.RateStore
+	review service.ReviewStore
+	closer io.Closer //关闭数据库或日志文件，内存存储器为nil
+}
+
+// Close 关闭存储器使用的数据库或日志文件
+func (stores *stores) Close() error {
+	if stores.closer == nil {
+		return nil
+	}
+	return stores.closer.Close()
+}
+
+// newStores 根据storeType创建存储器，sqlite时数据保存在dbPath中，file时数据保存在dataDir中
+func newStores(storeType, dbPath, dataDir string) (*stores, error) {
+	switch storeType {
+	case "memory":
+		rateStore := service.NewInMemoryRateStore()
+		return &stores{
+			laptop: service.NewInMemoryLaptopStore(),
+			user:   service.NewInMemoryUserStore(),
+			rate:   rateStore,
+			review: service.NewInMemoryReviewStore(rateStore),
+		}, nil
+	case "sqlite":
+		db, err := service.OpenSQLite(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		return &stores{
+			laptop: service.NewSQLLaptopStore(db),
+			user:   service.NewSQLUserStore(db),
+			rate:   service.NewSQLRateStore(db),
+			review: service.NewSQLReviewStore(db),
+			closer: db,
+		}, nil
+	case "file":
+		fileStores, err := service.OpenFileStores(dataDir, _snapshotInterval)
+		if err != nil {
+			return nil, err
+		}
+		return &stores{
+			laptop: fileStores.LaptopStore,
+			user:   fileStores.UserStore,
+			rate:   fileStores.RateStore,
+			review: fileStores.ReviewStore,
+			closer: fileStores,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown store type %q", storeType)
+	}
+}
+
+// newImageStore 根据imageStoreType创建图片存储器，disk时图片保存在img文件夹中，
+// s3时保存在对象存储中，多个服务实例可以共用，访问密钥从环境变量AWS_ACCESS_KEY_ID和AWS_SECRET_ACCESS_KEY读取
+func newImageStore(imageStoreType string, s3Config service.S3Config) (service.ImageStore, error) {
+	switch imageStoreType {
+	case "disk":
+		store, err := service.OpenDiskImageStore("img")
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "s3":
+		store, err := service.OpenS3ImageStore(s3Config)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown image store type %q", imageStoreType)
+	}
 }
 
 // loadTLSCredentials 加载服务端证书，私钥，以及ca根证书
@@ -80,7 +171,7 @@ func loadTLSCredentials() (credentials.TransportCredentials, error) {
 // runGRPCServer start grpc server
 func runGRPCServer(authServer pb.AuthServiceServer, laptopServer pb.LaptopServiceServer, jwtManager *service.JWTManager, enableTLS bool, listener net.Listener) error {
 	//生成拦截器
-	interceptor := service.NewAuthInterceptor(jwtManager, accessibleRoles())
+	interceptor := service.NewAuthInterceptor(jwtManager, auth.AccessibleRoles())
 
 	serverOptions := []grpc.ServerOption{
 		grpc.UnaryInterceptor(interceptor.Unary()),   //添加普通模式拦截器
@@ -100,18 +191,33 @@ func runGRPCServer(authServer pb.AuthServiceServer, laptopServer pb.LaptopServic
 
 	pb.RegisterAuthServiceServer(grpcServer, authServer)
 
+	stopped := shutdownOnSignal(func() {
+		//WatchLaptops等流式请求不会自行结束，超时后强制关闭连接
+		timer := time.AfterFunc(_shutdownTimeout, grpcServer.Stop)
+		defer timer.Stop()
+		grpcServer.GracefulStop()
+	})
 	log.Printf("start GRPC server on port: %s, TLS = %t", listener.Addr().String(), enableTLS)
-	return grpcServer.Serve(listener)
+	err := grpcServer.Serve(listener)
+	if err != nil {
+		return err
+	}
+	<-stopped
+	return nil
 }
 
-// runRESTServer start rest server
-func runRESTServer(authServer pb.AuthServiceServer, laptopServer pb.LaptopServiceServer, enableTLS bool, listener net.Listener, grpcEndpoint string) error {
+// runRESTServer start rest server，maxImageSize为图片的最大字节数，
+// GetImage在一个响应中返回整个图片，网关接收消息的大小限制需要大于图片大小
+func runRESTServer(authServer pb.AuthServiceServer, laptopServer pb.LaptopServiceServer, enableTLS bool, listener net.Listener, grpcEndpoint string, maxImageSize int64) error {
 	mux := runtime.NewServeMux()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	//若grpc server启用了tls验证，也需要在此处添加客户端tls证书，grpc.WithTransportCredentials(creds)
-	dialOption := []grpc.DialOption{grpc.WithInsecure()}
+	dialOption := []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(int(maxImageSize) + _gatewayMessageOverhead)),
+	}
 	//err := pb.RegisterAuthServiceHandlerServer(ctx, mux, authServer) //仅支持普通模式，只需要启动http server
 	err := pb.RegisterAuthServiceHandlerFromEndpoint(ctx, mux, grpcEndpoint, dialOption) //支持普通模式和流模式，需要同时启动http server和grpc server
 	if err != nil {
@@ -124,11 +230,40 @@ func runRESTServer(authServer pb.AuthServiceServer, laptopServer pb.LaptopServic
 		return err
 	}
 
+	server := &http.Server{Handler: mux}
+	stopped := shutdownOnSignal(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), _shutdownTimeout)
+		defer cancel()
+		err := server.Shutdown(ctx)
+		if err != nil {
+			log.Printf("cannot shutdown REST server: %v", err)
+		}
+	})
 	log.Printf("start REST server on port: %s, TLS = %t", listener.Addr().String(), enableTLS)
 	if enableTLS {
-		return http.ServeTLS(listener, mux, _serverPem, _serverKey)
+		err = server.ServeTLS(listener, _serverPem, _serverKey)
+	} else {
+		err = server.Serve(listener)
 	}
-	return http.Serve(listener, mux)
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// shutdownOnSignal 收到SIGINT或SIGTERM后调用shutdown，返回的channel在shutdown完成后关闭
+func shutdownOnSignal(shutdown func()) <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.Printf("receive signal %v, shutting down", sig)
+		shutdown()
+		close(stopped)
+	}()
+	return stopped
 }
 
 func main() {
@@ -136,20 +271,70 @@ func main() {
 	enableTLS := flag.Bool("tls", false, "enable SSL/TLS")
 	serverType := flag.String("type", "grpc", "type of server (grpc/rest)")
 	endPoint := flag.String("endpoint", "", "grpc endpoint")
+	storeType := flag.String("store", "memory", "type of store (memory/sqlite/file)")
+	dbPath := flag.String("db", "pcbook.db", "sqlite database path")
+	dataDir := flag.String("data-dir", "data", "snapshot and write-ahead log directory of file store")
+	ratingMin := flag.Float64("rating-min", service.DefaultRatingScale.Min, "minimum laptop score")
+	ratingMax := flag.Float64("rating-max", service.DefaultRatingScale.Max, "maximum laptop score")
+	ratingStep := flag.Float64("rating-step", service.DefaultRatingScale.Step, "step of laptop score, 0 allows any score in range")
+	resizeWorkers := flag.Int("resize-workers", goruntime.NumCPU(), "number of goroutines generating image variants")
+	maxImageSize := flag.Int64("max-image-size", service.DefaultMaxImageSize, "maximum size of uploaded images in bytes")
+	uploadDir := flag.String("upload-dir", "img/uploads", "directory staging data of resumable image uploads")
+	uploadTTL := flag.Duration("upload-ttl", 24*time.Hour, "resumable image uploads idle longer than this are deleted")
+	imageStoreType := flag.String("image-store", "disk", "type of image store (disk/s3)")
+	s3Endpoint := flag.String("s3-endpoint", "http://localhost:9000", "endpoint of S3-compatible object storage")
+	s3PublicEndpoint := flag.String("s3-public-endpoint", "", "endpoint used in image download urls, defaults to s3-endpoint")
+	s3Bucket := flag.String("s3-bucket", "pcbook", "bucket storing images")
+	s3Region := flag.String("s3-region", "us-east-1", "region of S3 bucket")
+	s3Timeout := flag.Duration("s3-timeout", 5*time.Minute, "timeout of each S3 request, including reading the response body")
 	flag.Parse()
 
-	userStore := service.NewInMemoryUserStore()
-	err := seedUsers(userStore)
+	//去除元数据和生成缩略图不会使图片变大，图片大小加上消息开销不能超过grpc消息大小的上限
+	if *maxImageSize <= 0 || *maxImageSize > math.MaxInt32-_gatewayMessageOverhead {
+		log.Fatalf("invalid max image size: %d", *maxImageSize)
+	}
+
+	ratingScale := service.RatingScale{Min: *ratingMin, Max: *ratingMax, Step: *ratingStep}
+	err := ratingScale.Check()
+	if err != nil {
+		log.Fatalf("invalid rating scale: %v", err)
+	}
+
+	stores, err := newStores(*storeType, *dbPath, *dataDir)
+	if err != nil {
+		log.Fatalf("cannot create stores: %v", err)
+	}
+	err = seedUsers(stores.user)
 	if err != nil {
 		log.Fatal("cannot seed users")
 	}
 	jwtManager := service.NewJWTManager(_secretKey, _tokenDuration)
-	authServer := service.NewAuthServer(userStore, jwtManager)
+	authServer := service.NewAuthServer(stores.user, jwtManager)
 
-	laptopStore := service.NewInMemoryLaptopStore()
-	imageStore := service.NewDiskImageStore("img")
-	rateStore := service.NewInMemoryRateStore()
-	laptopServer := service.NewLaptopServer(laptopStore, imageStore, rateStore)
+	eventBus := service.NewLaptopEventBus(_eventLogSize)
+	imageStore, err := newImageStore(*imageStoreType, service.S3Config{
+		Endpoint:       *s3Endpoint,
+		PublicEndpoint: *s3PublicEndpoint,
+		Bucket:         *s3Bucket,
+		Region:         *s3Region,
+		AccessKey:      os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:      os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		Timeout:        *s3Timeout,
+	})
+	if err != nil {
+		log.Fatalf("cannot create image store: %v", err)
+	}
+	laptopStore := service.NewEventLaptopStore(stores.laptop, eventBus)
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, stores.rate, stores.review, eventBus)
+	laptopServer.RatingScale = ratingScale
+	laptopServer.MaxImageSize = *maxImageSize
+	imageResizer := service.NewImageResizer(imageStore, *resizeWorkers, _resizeQueueSize)
+	laptopServer.ImageResizer = imageResizer
+	uploadStore, err := service.OpenDiskUploadStore(*uploadDir, *uploadTTL, _uploadCleanup)
+	if err != nil {
+		log.Fatalf("cannot open upload store: %v", err)
+	}
+	laptopServer.UploadStore = uploadStore
 
 	address := fmt.Sprintf("0.0.0.0:%d", *port)
 	listener, err := net.Listen("tcp", address)
@@ -160,11 +345,22 @@ func main() {
 	if *serverType == "grpc" {
 		err = runGRPCServer(authServer, laptopServer, jwtManager, *enableTLS, listener)
 	} else {
-		err = runRESTServer(authServer, laptopServer, *enableTLS, listener, *endPoint)
+		err = runRESTServer(authServer, laptopServer, *enableTLS, listener, *endPoint, *maxImageSize)
 	}
 
 	if err != nil {
 		log.Fatalf("cannot start server: %v", err)
 	}
 
+	//服务已停止，按打开的逆序关闭，等待队列中的缩略图任务完成后再关闭存储器
+	err = uploadStore.Close()
+	if err != nil {
+		log.Printf("cannot close upload store: %v", err)
+	}
+	imageResizer.Close()
+	err = stores.Close()
+	if err != nil {
+		log.Fatalf("cannot close stores: %v", err)
+	}
+	log.Print("server stopped")
 }
@@ -0,0 +1,653 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.18.0
+// source: store_message.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+//持久化的用户
+type StoredUser struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Username       string `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	HashedPassword string `protobuf:"bytes,2,opt,name=hashed_password,json=hashedPassword,proto3" json:"hashed_password,omitempty"` //加密后的密码
+	Role           string `protobuf:"bytes,3,opt,name=role,proto3" json:"role,omitempty"`
+}
+
+func (x *StoredUser) Reset() {
+	*x = StoredUser{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_store_message_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StoredUser) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoredUser) ProtoMessage() {}
+
+func (x *StoredUser) ProtoReflect() protoreflect.Message {
+	mi := &file_store_message_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StoredUser.ProtoReflect.Descriptor instead.
+func (*StoredUser) Descriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *StoredUser) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *StoredUser) GetHashedPassword() string {
+	if x != nil {
+		return x.HashedPassword
+	}
+	return ""
+}
+
+func (x *StoredUser) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+//持久化的用户评分
+type StoredUserRating struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Username string  `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	LaptopId string  `protobuf:"bytes,2,opt,name=laptop_id,json=laptopId,proto3" json:"laptop_id,omitempty"`
+	Score    float64 `protobuf:"fixed64,3,opt,name=score,proto3" json:"score,omitempty"`
+}
+
+func (x *StoredUserRating) Reset() {
+	*x = StoredUserRating{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_store_message_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StoredUserRating) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoredUserRating) ProtoMessage() {}
+
+func (x *StoredUserRating) ProtoReflect() protoreflect.Message {
+	mi := &file_store_message_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StoredUserRating.ProtoReflect.Descriptor instead.
+func (*StoredUserRating) Descriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StoredUserRating) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *StoredUserRating) GetLaptopId() string {
+	if x != nil {
+		return x.LaptopId
+	}
+	return ""
+}
+
+func (x *StoredUserRating) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+//持久化的评价投票
+type StoredReviewVote struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ReviewId string `protobuf:"bytes,1,opt,name=review_id,json=reviewId,proto3" json:"review_id,omitempty"`
+	Username string `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+}
+
+func (x *StoredReviewVote) Reset() {
+	*x = StoredReviewVote{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_store_message_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StoredReviewVote) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoredReviewVote) ProtoMessage() {}
+
+func (x *StoredReviewVote) ProtoReflect() protoreflect.Message {
+	mi := &file_store_message_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StoredReviewVote.ProtoReflect.Descriptor instead.
+func (*StoredReviewVote) Descriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StoredReviewVote) GetReviewId() string {
+	if x != nil {
+		return x.ReviewId
+	}
+	return ""
+}
+
+func (x *StoredReviewVote) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+//预写日志中的一条变更记录
+type StoreMutation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Mutation:
+	//	*StoreMutation_PutLaptop
+	//	*StoreMutation_DeleteLaptopId
+	//	*StoreMutation_PutUser
+	//	*StoreMutation_PutUserRating
+	//	*StoreMutation_DeleteUserRating
+	//	*StoreMutation_PutReview
+	//	*StoreMutation_PutReviewVote
+	Mutation isStoreMutation_Mutation `protobuf_oneof:"mutation"`
+}
+
+func (x *StoreMutation) Reset() {
+	*x = StoreMutation{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_store_message_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StoreMutation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoreMutation) ProtoMessage() {}
+
+func (x *StoreMutation) ProtoReflect() protoreflect.Message {
+	mi := &file_store_message_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StoreMutation.ProtoReflect.Descriptor instead.
+func (*StoreMutation) Descriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{3}
+}
+
+func (m *StoreMutation) GetMutation() isStoreMutation_Mutation {
+	if m != nil {
+		return m.Mutation
+	}
+	return nil
+}
+
+func (x *StoreMutation) GetPutLaptop() *Laptop {
+	if x, ok := x.GetMutation().(*StoreMutation_PutLaptop); ok {
+		return x.PutLaptop
+	}
+	return nil
+}
+
+func (x *StoreMutation) GetDeleteLaptopId() string {
+	if x, ok := x.GetMutation().(*StoreMutation_DeleteLaptopId); ok {
+		return x.DeleteLaptopId
+	}
+	return ""
+}
+
+func (x *StoreMutation) GetPutUser() *StoredUser {
+	if x, ok := x.GetMutation().(*StoreMutation_PutUser); ok {
+		return x.PutUser
+	}
+	return nil
+}
+
+func (x *StoreMutation) GetPutUserRating() *StoredUserRating {
+	if x, ok := x.GetMutation().(*StoreMutation_PutUserRating); ok {
+		return x.PutUserRating
+	}
+	return nil
+}
+
+func (x *StoreMutation) GetDeleteUserRating() *StoredUserRating {
+	if x, ok := x.GetMutation().(*StoreMutation_DeleteUserRating); ok {
+		return x.DeleteUserRating
+	}
+	return nil
+}
+
+func (x *StoreMutation) GetPutReview() *Review {
+	if x, ok := x.GetMutation().(*StoreMutation_PutReview); ok {
+		return x.PutReview
+	}
+	return nil
+}
+
+func (x *StoreMutation) GetPutReviewVote() *StoredReviewVote {
+	if x, ok := x.GetMutation().(*StoreMutation_PutReviewVote); ok {
+		return x.PutReviewVote
+	}
+	return nil
+}
+
+type isStoreMutation_Mutation interface {
+	isStoreMutation_Mutation()
+}
+
+type StoreMutation_PutLaptop struct {
+	PutLaptop *Laptop `protobuf:"bytes,1,opt,name=put_laptop,json=putLaptop,proto3,oneof"` //新建或更新后的laptop
+}
+
+type StoreMutation_DeleteLaptopId struct {
+	DeleteLaptopId string `protobuf:"bytes,2,opt,name=delete_laptop_id,json=deleteLaptopId,proto3,oneof"`
+}
+
+type StoreMutation_PutUser struct {
+	PutUser *StoredUser `protobuf:"bytes,3,opt,name=put_user,json=putUser,proto3,oneof"`
+}
+
+type StoreMutation_PutUserRating struct {
+	PutUserRating *StoredUserRating `protobuf:"bytes,5,opt,name=put_user_rating,json=putUserRating,proto3,oneof"` //新建或替换的用户评分
+}
+
+type StoreMutation_DeleteUserRating struct {
+	DeleteUserRating *StoredUserRating `protobuf:"bytes,6,opt,name=delete_user_rating,json=deleteUserRating,proto3,oneof"` //只使用username和laptop_id
+}
+
+type StoreMutation_PutReview struct {
+	PutReview *Review `protobuf:"bytes,7,opt,name=put_review,json=putReview,proto3,oneof"` //重放时同时将评价的分数记录为作者的评分
+}
+
+type StoreMutation_PutReviewVote struct {
+	PutReviewVote *StoredReviewVote `protobuf:"bytes,8,opt,name=put_review_vote,json=putReviewVote,proto3,oneof"` //重放时同时增加评价的投票数
+}
+
+func (*StoreMutation_PutLaptop) isStoreMutation_Mutation() {}
+
+func (*StoreMutation_DeleteLaptopId) isStoreMutation_Mutation() {}
+
+func (*StoreMutation_PutUser) isStoreMutation_Mutation() {}
+
+func (*StoreMutation_PutUserRating) isStoreMutation_Mutation() {}
+
+func (*StoreMutation_DeleteUserRating) isStoreMutation_Mutation() {}
+
+func (*StoreMutation_PutReview) isStoreMutation_Mutation() {}
+
+func (*StoreMutation_PutReviewVote) isStoreMutation_Mutation() {}
+
+//存储器的快照
+type StoreSnapshot struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	NextSegment uint64              `protobuf:"varint,1,opt,name=next_segment,json=nextSegment,proto3" json:"next_segment,omitempty"` //快照之后的变更从该编号的日志文件开始记录
+	Laptops     []*Laptop           `protobuf:"bytes,2,rep,name=laptops,proto3" json:"laptops,omitempty"`
+	Users       []*StoredUser       `protobuf:"bytes,3,rep,name=users,proto3" json:"users,omitempty"`
+	UserRatings []*StoredUserRating `protobuf:"bytes,5,rep,name=user_ratings,json=userRatings,proto3" json:"user_ratings,omitempty"`
+	Reviews     []*Review           `protobuf:"bytes,6,rep,name=reviews,proto3" json:"reviews,omitempty"` //已包含投票数
+	ReviewVotes []*StoredReviewVote `protobuf:"bytes,7,rep,name=review_votes,json=reviewVotes,proto3" json:"review_votes,omitempty"`
+}
+
+func (x *StoreSnapshot) Reset() {
+	*x = StoreSnapshot{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_store_message_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StoreSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoreSnapshot) ProtoMessage() {}
+
+func (x *StoreSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_store_message_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StoreSnapshot.ProtoReflect.Descriptor instead.
+func (*StoreSnapshot) Descriptor() ([]byte, []int) {
+	return file_store_message_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StoreSnapshot) GetNextSegment() uint64 {
+	if x != nil {
+		return x.NextSegment
+	}
+	return 0
+}
+
+func (x *StoreSnapshot) GetLaptops() []*Laptop {
+	if x != nil {
+		return x.Laptops
+	}
+	return nil
+}
+
+func (x *StoreSnapshot) GetUsers() []*StoredUser {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+func (x *StoreSnapshot) GetUserRatings() []*StoredUserRating {
+	if x != nil {
+		return x.UserRatings
+	}
+	return nil
+}
+
+func (x *StoreSnapshot) GetReviews() []*Review {
+	if x != nil {
+		return x.Reviews
+	}
+	return nil
+}
+
+func (x *StoreSnapshot) GetReviewVotes() []*StoredReviewVote {
+	if x != nil {
+		return x.ReviewVotes
+	}
+	return nil
+}
+
+var File_store_message_proto protoreflect.FileDescriptor
+
+var file_store_message_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x73, 0x74, 0x6f, 0x72, 0x65, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x14, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x5f, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x14, 0x72, 0x65, 0x76,
+	0x69, 0x65, 0x77, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x22, 0x65, 0x0a, 0x0a, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x55, 0x73, 0x65, 0x72, 0x12,
+	0x1a, 0x0a, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x27, 0x0a, 0x0f, 0x68,
+	0x61, 0x73, 0x68, 0x65, 0x64, 0x5f, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x68, 0x61, 0x73, 0x68, 0x65, 0x64, 0x50, 0x61, 0x73, 0x73,
+	0x77, 0x6f, 0x72, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x6f, 0x6c, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x72, 0x6f, 0x6c, 0x65, 0x22, 0x61, 0x0a, 0x10, 0x53, 0x74, 0x6f, 0x72,
+	0x65, 0x64, 0x55, 0x73, 0x65, 0x72, 0x52, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x12, 0x1a, 0x0a, 0x08,
+	0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08,
+	0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x61, 0x70, 0x74,
+	0x6f, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6c, 0x61, 0x70,
+	0x74, 0x6f, 0x70, 0x49, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x22, 0x4b, 0x0a, 0x10, 0x53,
+	0x74, 0x6f, 0x72, 0x65, 0x64, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x56, 0x6f, 0x74, 0x65, 0x12,
+	0x1b, 0x0a, 0x09, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08,
+	0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08,
+	0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x88, 0x03, 0x0a, 0x0d, 0x53, 0x74, 0x6f,
+	0x72, 0x65, 0x4d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x28, 0x0a, 0x0a, 0x70, 0x75,
+	0x74, 0x5f, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x07,
+	0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x48, 0x00, 0x52, 0x09, 0x70, 0x75, 0x74, 0x4c, 0x61,
+	0x70, 0x74, 0x6f, 0x70, 0x12, 0x2a, 0x0a, 0x10, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x5f, 0x6c,
+	0x61, 0x70, 0x74, 0x6f, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00,
+	0x52, 0x0e, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x49, 0x64,
+	0x12, 0x28, 0x0a, 0x08, 0x70, 0x75, 0x74, 0x5f, 0x75, 0x73, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x55, 0x73, 0x65, 0x72, 0x48,
+	0x00, 0x52, 0x07, 0x70, 0x75, 0x74, 0x55, 0x73, 0x65, 0x72, 0x12, 0x3b, 0x0a, 0x0f, 0x70, 0x75,
+	0x74, 0x5f, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x72, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x55, 0x73, 0x65, 0x72,
+	0x52, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x48, 0x00, 0x52, 0x0d, 0x70, 0x75, 0x74, 0x55, 0x73, 0x65,
+	0x72, 0x52, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x12, 0x41, 0x0a, 0x12, 0x64, 0x65, 0x6c, 0x65, 0x74,
+	0x65, 0x5f, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x72, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x55, 0x73, 0x65, 0x72,
+	0x52, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x48, 0x00, 0x52, 0x10, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65,
+	0x55, 0x73, 0x65, 0x72, 0x52, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x12, 0x28, 0x0a, 0x0a, 0x70, 0x75,
+	0x74, 0x5f, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x07,
+	0x2e, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x48, 0x00, 0x52, 0x09, 0x70, 0x75, 0x74, 0x52, 0x65,
+	0x76, 0x69, 0x65, 0x77, 0x12, 0x3b, 0x0a, 0x0f, 0x70, 0x75, 0x74, 0x5f, 0x72, 0x65, 0x76, 0x69,
+	0x65, 0x77, 0x5f, 0x76, 0x6f, 0x74, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e,
+	0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x56, 0x6f, 0x74, 0x65,
+	0x48, 0x00, 0x52, 0x0d, 0x70, 0x75, 0x74, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x56, 0x6f, 0x74,
+	0x65, 0x42, 0x0a, 0x0a, 0x08, 0x6d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4a, 0x04, 0x08,
+	0x04, 0x10, 0x05, 0x22, 0x8d, 0x02, 0x0a, 0x0d, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x53, 0x6e, 0x61,
+	0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x21, 0x0a, 0x0c, 0x6e, 0x65, 0x78, 0x74, 0x5f, 0x73, 0x65,
+	0x67, 0x6d, 0x65, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x6e, 0x65, 0x78,
+	0x74, 0x53, 0x65, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x21, 0x0a, 0x07, 0x6c, 0x61, 0x70, 0x74,
+	0x6f, 0x70, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x07, 0x2e, 0x4c, 0x61, 0x70, 0x74,
+	0x6f, 0x70, 0x52, 0x07, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x73, 0x12, 0x21, 0x0a, 0x05, 0x75,
+	0x73, 0x65, 0x72, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x53, 0x74, 0x6f,
+	0x72, 0x65, 0x64, 0x55, 0x73, 0x65, 0x72, 0x52, 0x05, 0x75, 0x73, 0x65, 0x72, 0x73, 0x12, 0x34,
+	0x0a, 0x0c, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x72, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x73, 0x18, 0x05,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x55, 0x73, 0x65,
+	0x72, 0x52, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x52, 0x0b, 0x75, 0x73, 0x65, 0x72, 0x52, 0x61, 0x74,
+	0x69, 0x6e, 0x67, 0x73, 0x12, 0x21, 0x0a, 0x07, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x73, 0x18,
+	0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x07, 0x2e, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x52, 0x07,
+	0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x73, 0x12, 0x34, 0x0a, 0x0c, 0x72, 0x65, 0x76, 0x69, 0x65,
+	0x77, 0x5f, 0x76, 0x6f, 0x74, 0x65, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x11, 0x2e,
+	0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x56, 0x6f, 0x74, 0x65,
+	0x52, 0x0b, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x56, 0x6f, 0x74, 0x65, 0x73, 0x4a, 0x04, 0x08,
+	0x04, 0x10, 0x05, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
+}
+
+var (
+	file_store_message_proto_rawDescOnce sync.Once
+	file_store_message_proto_rawDescData = file_store_message_proto_rawDesc
+)
+
+func file_store_message_proto_rawDescGZIP() []byte {
+	file_store_message_proto_rawDescOnce.Do(func() {
+		file_store_message_proto_rawDescData = protoimpl.X.CompressGZIP(file_store_message_proto_rawDescData)
+	})
+	return file_store_message_proto_rawDescData
+}
+
+var file_store_message_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_store_message_proto_goTypes = []interface{}{
+	(*StoredUser)(nil),       // 0: StoredUser
+	(*StoredUserRating)(nil), // 1: StoredUserRating
+	(*StoredReviewVote)(nil), // 2: StoredReviewVote
+	(*StoreMutation)(nil),    // 3: StoreMutation
+	(*StoreSnapshot)(nil),    // 4: StoreSnapshot
+	(*Laptop)(nil),           // 5: Laptop
+	(*Review)(nil),           // 6: Review
+}
+var file_store_message_proto_depIdxs = []int32{
+	5,  // 0: StoreMutation.put_laptop:type_name -> Laptop
+	0,  // 1: StoreMutation.put_user:type_name -> StoredUser
+	1,  // 2: StoreMutation.put_user_rating:type_name -> StoredUserRating
+	1,  // 3: StoreMutation.delete_user_rating:type_name -> StoredUserRating
+	6,  // 4: StoreMutation.put_review:type_name -> Review
+	2,  // 5: StoreMutation.put_review_vote:type_name -> StoredReviewVote
+	5,  // 6: StoreSnapshot.laptops:type_name -> Laptop
+	0,  // 7: StoreSnapshot.users:type_name -> StoredUser
+	1,  // 8: StoreSnapshot.user_ratings:type_name -> StoredUserRating
+	6,  // 9: StoreSnapshot.reviews:type_name -> Review
+	2,  // 10: StoreSnapshot.review_votes:type_name -> StoredReviewVote
+	11, // [11:11] is the sub-list for method output_type
+	11, // [11:11] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_store_message_proto_init() }
+func file_store_message_proto_init() {
+	if File_store_message_proto != nil {
+		return
+	}
+	file_laptop_message_proto_init()
+	file_review_message_proto_init()
+	if !protoimpl.UnsafeEnabled {
+		file_store_message_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StoredUser); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_store_message_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StoredUserRating); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_store_message_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StoredReviewVote); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_store_message_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StoreMutation); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_store_message_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StoreSnapshot); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_store_message_proto_msgTypes[3].OneofWrappers = []interface{}{
+		(*StoreMutation_PutLaptop)(nil),
+		(*StoreMutation_DeleteLaptopId)(nil),
+		(*StoreMutation_PutUser)(nil),
+		(*StoreMutation_PutUserRating)(nil),
+		(*StoreMutation_DeleteUserRating)(nil),
+		(*StoreMutation_PutReview)(nil),
+		(*StoreMutation_PutReviewVote)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_store_message_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_store_message_proto_goTypes,
+		DependencyIndexes: file_store_message_proto_depIdxs,
+		MessageInfos:      file_store_message_proto_msgTypes,
+	}.Build()
+	File_store_message_proto = out.File
+	file_store_message_proto_rawDesc = nil
+	file_store_message_proto_goTypes = nil
+	file_store_message_proto_depIdxs = nil
+}
@@ -0,0 +1,283 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"pcbook/pb"
+	"strconv"
+	"strings"
+)
+
+// KgPerLb 1磅等于多少千克
+const KgPerLb = 0.45359237
+
+var errUnsupportedOp = errors.New("operator is not supported for this field")
+
+// field 可查询的字段，compile根据运算符和值生成判断方法
+type field interface {
+	compile(op, value string) (func(laptop *pb.Laptop) bool, error)
+}
+
+// _fields 支持查询的字段，字段名不区分大小写
+var _fields = map[string]field{
+	"brand":             stringField(func(l *pb.Laptop) []string { return []string{l.GetBrand()} }),
+	"name":              stringField(func(l *pb.Laptop) []string { return []string{l.GetName()} }),
+	"price":             numberField{get: func(l *pb.Laptop) []float64 { return []float64{l.GetPriceUsed()} }},
+	"year":              numberField{get: func(l *pb.Laptop) []float64 { return []float64{float64(l.GetReleaseYear())} }},
+	"release_year":      numberField{get: func(l *pb.Laptop) []float64 { return []float64{float64(l.GetReleaseYear())} }},
+	"weight":            numberField{get: laptopWeight, parse: parseWeight},
+	"cpu.brand":         stringField(func(l *pb.Laptop) []string { return []string{l.GetCpu().GetBrand()} }),
+	"cpu.name":          stringField(func(l *pb.Laptop) []string { return []string{l.GetCpu().GetName()} }),
+	"cpu.cores":         numberField{get: func(l *pb.Laptop) []float64 { return []float64{float64(l.GetCpu().GetNumberCores())} }},
+	"cpu.threads":       numberField{get: func(l *pb.Laptop) []float64 { return []float64{float64(l.GetCpu().GetNumberThreads())} }},
+	"cpu.ghz":           numberField{get: func(l *pb.Laptop) []float64 { return []float64{l.GetCpu().GetMinGhz()} }},
+	"cpu.min_ghz":       numberField{get: func(l *pb.Laptop) []float64 { return []float64{l.GetCpu().GetMinGhz()} }},
+	"cpu.max_ghz":       numberField{get: func(l *pb.Laptop) []float64 { return []float64{l.GetCpu().GetMaxGhz()} }},
+	"ram":               numberField{get: func(l *pb.Laptop) []float64 { return []float64{toBit(l.GetRam())} }, parse: parseMemory},
+	"gpu.brand":         stringField(gpuBrands),
+	"gpu.name":          stringField(gpuNames),
+	"gpu.memory":        numberField{get: gpuMemories, parse: parseMemory},
+	"ssd":               numberField{get: storageTotal(pb.Storage_SSD), parse: parseMemory},
+	"hdd":               numberField{get: storageTotal(pb.Storage_HDD), parse: parseMemory},
+	"screen.size":       numberField{get: func(l *pb.Laptop) []float64 { return []float64{float64(l.GetScreen().GetSizeInch())} }},
+	"screen.width":      numberField{get: func(l *pb.Laptop) []float64 { return []float64{float64(l.GetScreen().GetResolution().GetWidth())} }},
+	"screen.height":     numberField{get: func(l *pb.Laptop) []float64 { return []float64{float64(l.GetScreen().GetResolution().GetHeight())} }},
+	"screen.panel":      enumField{get: func(l *pb.Laptop) string { return l.GetScreen().GetPanel().String() }, values: pb.Screen_Panel_value},
+	"screen.multitouch": boolField(func(l *pb.Laptop) bool { return l.GetScreen().GetMultitouch() }),
+	"keyboard.layout":   enumField{get: func(l *pb.Laptop) string { return l.GetKeyborad().GetLayout().String() }, values: pb.Keyborad_Layout_value},
+	"keyboard.backlit":  boolField(func(l *pb.Laptop) bool { return l.GetKeyborad().GetBacklit() }),
+}
+
+// stringField 字符串字段，不区分大小写，有多个值时(如多个gpu)任意一个相等即可
+type stringField func(laptop *pb.Laptop) []string
+
+func (get stringField) compile(op, value string) (func(laptop *pb.Laptop) bool, error) {
+	equal := func(laptop *pb.Laptop) bool {
+		for _, v := range get(laptop) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	}
+	switch op {
+	case ":", "=":
+		return equal, nil
+	case "!=":
+		return func(laptop *pb.Laptop) bool { return !equal(laptop) }, nil
+	default:
+		return nil, errUnsupportedOp
+	}
+}
+
+// enumField 枚举字段，值为枚举名称，不区分大小写
+type enumField struct {
+	get    func(laptop *pb.Laptop) string
+	values map[string]int32
+}
+
+func (f enumField) compile(op, value string) (func(laptop *pb.Laptop) bool, error) {
+	name := strings.ToUpper(value)
+	if _, ok := f.values[name]; !ok {
+		return nil, fmt.Errorf("unknown value %q", value)
+	}
+	return stringField(func(laptop *pb.Laptop) []string { return []string{f.get(laptop)} }).compile(op, name)
+}
+
+// boolField 布尔字段，值为true/false
+type boolField func(laptop *pb.Laptop) bool
+
+func (get boolField) compile(op, value string) (func(laptop *pb.Laptop) bool, error) {
+	expected, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid boolean %q", value)
+	}
+	switch op {
+	case ":", "=":
+		return func(laptop *pb.Laptop) bool { return get(laptop) == expected }, nil
+	case "!=":
+		return func(laptop *pb.Laptop) bool { return get(laptop) != expected }, nil
+	default:
+		return nil, errUnsupportedOp
+	}
+}
+
+// numberField 数值字段，有多个值时任意一个满足即可，没有值时不满足
+type numberField struct {
+	get   func(laptop *pb.Laptop) []float64
+	parse func(value string) (float64, error) //为nil时按普通数字解析
+}
+
+func (f numberField) compile(op, value string) (func(laptop *pb.Laptop) bool, error) {
+	parse := f.parse
+	if parse == nil {
+		parse = parseNumber
+	}
+	expected, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var compare func(v float64) bool
+	switch op {
+	case ":", "=":
+		compare = func(v float64) bool { return v == expected }
+	case "<":
+		compare = func(v float64) bool { return v < expected }
+	case "<=":
+		compare = func(v float64) bool { return v <= expected }
+	case ">":
+		compare = func(v float64) bool { return v > expected }
+	case ">=":
+		compare = func(v float64) bool { return v >= expected }
+	case "!=":
+		equal, _ := f.compile("=", value)
+		return func(laptop *pb.Laptop) bool { return !equal(laptop) }, nil
+	default:
+		return nil, errUnsupportedOp
+	}
+	return func(laptop *pb.Laptop) bool {
+		for _, v := range f.get(laptop) {
+			if compare(v) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func parseNumber(value string) (float64, error) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return number, nil
+}
+
+// _memoryUnits 内存单位对应的bit数，与pb.Memory_Unit一致，1KB=1024B
+var _memoryUnits = []struct {
+	suffix string
+	bits   float64
+}{
+	{"TB", 1 << 43},
+	{"GB", 1 << 33},
+	{"MB", 1 << 23},
+	{"KB", 1 << 13},
+	{"B", 1 << 3},
+}
+
+// parseMemory 解析带单位的容量，如16GB、512mb，返回bit数
+func parseMemory(value string) (float64, error) {
+	upper := strings.ToUpper(value)
+	for _, unit := range _memoryUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			number, err := strconv.ParseFloat(strings.TrimSuffix(upper, unit.suffix), 64)
+			if err != nil || number < 0 {
+				break
+			}
+			return number * unit.bits, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid memory size %q, expected a number with unit B/KB/MB/GB/TB", value)
+}
+
+// parseWeight 解析重量，支持kg和lb单位，没有单位时为kg，返回千克数
+func parseWeight(value string) (float64, error) {
+	lower := strings.ToLower(value)
+	factor := 1.0
+	if strings.HasSuffix(lower, "lb") {
+		lower = strings.TrimSuffix(lower, "lb")
+		factor = KgPerLb
+	} else {
+		lower = strings.TrimSuffix(lower, "kg")
+	}
+	number, err := strconv.ParseFloat(lower, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid weight %q", value)
+	}
+	return number * factor, nil
+}
+
+// MemoryBits 将内存大小换算为bit，查询和存储器的索引使用相同的换算，结果才能一致
+func MemoryBits(memory *pb.Memory) uint64 {
+	value := memory.GetValue()
+	switch memory.GetUnit() {
+	case pb.Memory_BIT:
+		return value
+	case pb.Memory_BYTE:
+		return value << 3
+	case pb.Memory_KILOBYTE:
+		return value << 13
+	case pb.Memory_MEGABYTE:
+		return value << 23
+	case pb.Memory_GIGABYTE:
+		return value << 33
+	case pb.Memory_TERABYTE:
+		return value << 43
+	default:
+		return 0
+	}
+}
+
+// WeightKg 将重量统一换算为千克，未设置重量时返回false
+func WeightKg(laptop *pb.Laptop) (float64, bool) {
+	switch weight := laptop.GetWeight().(type) {
+	case *pb.Laptop_WeightKg:
+		return weight.WeightKg, true
+	case *pb.Laptop_WeightLb:
+		return weight.WeightLb * KgPerLb, true
+	default:
+		return 0, false
+	}
+}
+
+// toBit 将内存大小换算为bit，用于比较
+func toBit(memory *pb.Memory) float64 {
+	return float64(MemoryBits(memory))
+}
+
+// laptopWeight 将重量统一换算为千克，未设置重量时没有值
+func laptopWeight(laptop *pb.Laptop) []float64 {
+	weight, ok := WeightKg(laptop)
+	if !ok {
+		return nil
+	}
+	return []float64{weight}
+}
+
+func gpuBrands(laptop *pb.Laptop) []string {
+	var brands []string
+	for _, gpu := range laptop.GetGpus() {
+		brands = append(brands, gpu.GetBrand())
+	}
+	return brands
+}
+
+func gpuNames(laptop *pb.Laptop) []string {
+	var names []string
+	for _, gpu := range laptop.GetGpus() {
+		names = append(names, gpu.GetName())
+	}
+	return names
+}
+
+func gpuMemories(laptop *pb.Laptop) []float64 {
+	var memories []float64
+	for _, gpu := range laptop.GetGpus() {
+		memories = append(memories, toBit(gpu.GetMemory()))
+	}
+	return memories
+}
+
+// storageTotal 返回指定类型硬盘的总容量
+func storageTotal(driver pb.Storage_Driver) func(laptop *pb.Laptop) []float64 {
+	return func(laptop *pb.Laptop) []float64 {
+		var total float64
+		for _, storage := range laptop.GetStorages() {
+			if storage.GetDriver() == driver {
+				total += toBit(storage.GetMemory())
+			}
+		}
+		return []float64{total}
+	}
+}
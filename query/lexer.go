@@ -0,0 +1,108 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenWord             //字段名、值或关键字AND/OR/NOT
+	tokenString           //双引号包裹的字符串
+	tokenOp               //比较运算符 : = != < <= > >=
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int //从1开始的字符位置
+}
+
+// SyntaxError 查询语句的语法错误，Pos为出错的位置(从1开始的字符位置)
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// isSpecial 判断是否为分隔单词的特殊字符
+func isSpecial(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`()"<>=!:`, r)
+}
+
+// tokenize 将查询语句拆分为token，最后一个token总是tokenEOF
+func tokenize(input string) ([]token, error) {
+	runes := []rune(input)
+	var tokens []token
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenLParen, "(", pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRParen, ")", pos})
+			i++
+		case r == '"':
+			//字符串，支持\"和\\转义
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, errorf(pos, "unterminated string")
+			}
+			tokens = append(tokens, token{tokenString, sb.String(), pos})
+		case r == ':' || r == '=':
+			tokens = append(tokens, token{tokenOp, string(r), pos})
+			i++
+		case r == '<' || r == '>' || r == '!':
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, errorf(pos, "unexpected '!', did you mean '!='")
+			}
+			tokens = append(tokens, token{tokenOp, op, pos})
+			i += len(op)
+		default:
+			start := i
+			for i < len(runes) && !isSpecial(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, string(runes[start:i]), pos})
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, "", len(runes) + 1})
+	return tokens, nil
+}
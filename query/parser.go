@@ -0,0 +1,222 @@
+// Package query 实现laptop的文本查询语言，例如：
+//
+//	brand:Apple price<2000 ram>=16GB gpu.memory>=4GB screen.panel=OLED
+//	(brand:Dell OR brand:Lenovo) AND NOT keyboard.backlit=false
+//
+// 多个条件之间默认为AND，支持AND/OR/NOT及括号，NOT优先级最高，其次为AND，最后为OR
+package query
+
+import (
+	"pcbook/pb"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	_maxQueryLength  = 1000 //查询语句的最大字符数
+	_maxNestingDepth = 100  //括号和NOT的最大嵌套层数，避免递归解析时栈溢出
+)
+
+// Expr 编译后的查询表达式
+type Expr interface {
+	//Match 判断laptop是否满足查询条件
+	Match(laptop *pb.Laptop) bool
+}
+
+type andExpr struct {
+	left, right Expr
+}
+
+func (expr *andExpr) Match(laptop *pb.Laptop) bool {
+	return expr.left.Match(laptop) && expr.right.Match(laptop)
+}
+
+type orExpr struct {
+	left, right Expr
+}
+
+func (expr *orExpr) Match(laptop *pb.Laptop) bool {
+	return expr.left.Match(laptop) || expr.right.Match(laptop)
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+func (expr *notExpr) Match(laptop *pb.Laptop) bool {
+	return !expr.expr.Match(laptop)
+}
+
+// compareExpr 单个比较条件，如price<2000
+type compareExpr struct {
+	match func(laptop *pb.Laptop) bool
+}
+
+func (expr *compareExpr) Match(laptop *pb.Laptop) bool {
+	return expr.match(laptop)
+}
+
+// Parse 解析查询语句，语法错误时返回*SyntaxError
+func Parse(input string) (Expr, error) {
+	if utf8.RuneCountInString(input) > _maxQueryLength {
+		return nil, errorf(_maxQueryLength+1, "query is longer than %d characters", _maxQueryLength)
+	}
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, errorf(p.peek().pos, "empty query")
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, errorf(tok.pos, "unexpected %q", tok.text)
+	}
+	return expr, nil
+}
+
+type parser struct {
+	tokens []token
+	index  int
+	depth  int //当前括号和NOT的嵌套层数
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.index]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.index]
+	if tok.kind != tokenEOF {
+		p.index++
+	}
+	return tok
+}
+
+// enter 进入一层括号或NOT，超过最大嵌套层数时返回错误，调用方解析完成后需要减少depth
+func (p *parser) enter(tok token) error {
+	if p.depth >= _maxNestingDepth {
+		return errorf(tok.pos, "query is nested more than %d levels", _maxNestingDepth)
+	}
+	p.depth++
+	return nil
+}
+
+// isKeyword 判断当前token是否为指定的关键字
+func (p *parser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokenWord && tok.text == keyword
+}
+
+// parseOr or := and ("OR" and)*
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd and := not (["AND"] not)*，省略AND时默认为AND
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.isKeyword("AND") {
+			p.next()
+		} else if tok := p.peek(); tok.kind == tokenEOF || tok.kind == tokenRParen || p.isKeyword("OR") {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left, right}
+	}
+}
+
+// parseNot not := "NOT" not | primary
+func (p *parser) parseNot() (Expr, error) {
+	if p.isKeyword("NOT") {
+		err := p.enter(p.next())
+		if err != nil {
+			return nil, err
+		}
+		expr, err := p.parseNot()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary primary := "(" or ")" | field op value
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenLParen:
+		err := p.enter(tok)
+		if err != nil {
+			return nil, err
+		}
+		expr, err := p.parseOr()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, errorf(tok.pos, "missing closing parenthesis")
+		}
+		return expr, nil
+	case tokenWord:
+		if tok.text == "AND" || tok.text == "OR" {
+			return nil, errorf(tok.pos, "expected condition before %s", tok.text)
+		}
+		return p.parseComparison(tok)
+	case tokenEOF:
+		return nil, errorf(tok.pos, "unexpected end of query")
+	default:
+		return nil, errorf(tok.pos, "unexpected %q", tok.text)
+	}
+}
+
+// parseComparison 解析field op value
+func (p *parser) parseComparison(name token) (Expr, error) {
+	f, ok := _fields[strings.ToLower(name.text)]
+	if !ok {
+		return nil, errorf(name.pos, "unknown field %q", name.text)
+	}
+	op := p.next()
+	if op.kind != tokenOp {
+		return nil, errorf(op.pos, "expected operator after %q", name.text)
+	}
+	value := p.next()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, errorf(value.pos, "expected value after %q", name.text+op.text)
+	}
+	match, err := f.compile(op.text, value.text)
+	if err != nil {
+		pos := value.pos
+		if err == errUnsupportedOp {
+			pos = op.pos
+		}
+		return nil, errorf(pos, "%s%s%s: %v", name.text, op.text, value.text, err)
+	}
+	return &compareExpr{match}, nil
+}
@@ -0,0 +1,144 @@
+package query
+
+import (
+	"github.com/stretchr/testify/require"
+	"pcbook/pb"
+	"strings"
+	"testing"
+)
+
+func newTestLaptop() *pb.Laptop {
+	return &pb.Laptop{
+		Brand: "Apple",
+		Name:  "Macbook Pro",
+		Cpu:   &pb.CPU{Brand: "Intel", NumberCores: 8, MinGhz: 2.6, MaxGhz: 4.8},
+		Ram:   &pb.Memory{Value: 16, Unit: pb.Memory_GIGABYTE},
+		Gpus: []*pb.GPU{
+			{Brand: "AMD", Name: "RX 5500M", Memory: &pb.Memory{Value: 4096, Unit: pb.Memory_MEGABYTE}},
+		},
+		Storages: []*pb.Storage{
+			{Driver: pb.Storage_SSD, Memory: &pb.Memory{Value: 512, Unit: pb.Memory_GIGABYTE}},
+		},
+		Screen: &pb.Screen{
+			SizeInch:   16,
+			Resolution: &pb.Screen_Resolution{Width: 3072, Height: 1920},
+			Panel:      pb.Screen_OLED,
+		},
+		Keyborad:    &pb.Keyborad{Layout: pb.Keyborad_QWERTY, Backlit: true},
+		Weight:      &pb.Laptop_WeightLb{WeightLb: 4.3},
+		PriceUsed:   1999,
+		ReleaseYear: 2019,
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		query string
+		match bool
+	}{
+		{`brand:Apple price<2000 ram>=16GB gpu.memory>=4GB screen.panel=OLED`, true},
+		{`brand:apple AND price<1999`, false},
+		{`brand:Dell OR brand:Apple`, true},
+		{`brand:Dell OR brand:Lenovo`, false},
+		{`NOT brand:Dell`, true},
+		{`NOT NOT brand:Dell`, false},
+		{`(brand:Dell OR brand:Apple) AND (ram>16GB OR cpu.cores>=8)`, true},
+		{`brand:Dell OR brand:Apple price>2000`, false},
+		{`name="Macbook Pro"`, true},
+		{`name!="Macbook Pro"`, false},
+		{`gpu.brand:amd gpu.name:"RX 5500M"`, true},
+		{`ssd>=512GB ssd<0.5TB`, false},
+		{`hdd=0B`, true},
+		{`weight<2kg weight>4lb`, true},
+		{`weight<=1.9`, false},
+		{`keyboard.backlit=true keyboard.layout:qwerty`, true},
+		{`screen.multitouch:true`, false},
+		{`screen.size>=15 screen.width>=3000 screen.height<2000`, true},
+		{`cpu.ghz>2.5 cpu.max_ghz=4.8 cpu.brand!=AMD year:2019`, true},
+	}
+
+	laptop := newTestLaptop()
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.query, func(t *testing.T) {
+			t.Parallel()
+			expr, err := Parse(tc.query)
+			require.NoError(t, err)
+			require.Equal(t, tc.match, expr.Match(laptop))
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		query string
+		pos   int
+	}{
+		{``, 1},
+		{`brand`, 6},
+		{`brand:`, 7},
+		{`color:red`, 1},
+		{`price<cheap`, 7},
+		{`brand<Apple`, 6},
+		{`ram>=16`, 6},
+		{`screen.panel=TN`, 14},
+		{`(brand:Apple`, 1},
+		{`brand:Apple)`, 12},
+		{`brand:Apple OR`, 15},
+		{`AND brand:Apple`, 1},
+		{`name:"Macbook`, 6},
+		{`price!2000`, 6},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.query, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse(tc.query)
+			require.Error(t, err)
+			syntaxErr, ok := err.(*SyntaxError)
+			require.True(t, ok)
+			require.Equal(t, tc.pos, syntaxErr.Pos, err.Error())
+		})
+	}
+}
+
+// TestParseLimits 过长或嵌套过深的查询返回语法错误，不会导致栈溢出
+func TestParseLimits(t *testing.T) {
+	t.Parallel()
+
+	nested := func(prefix, suffix string, depth int) string {
+		return strings.Repeat(prefix, depth) + "brand:Apple" + strings.Repeat(suffix, depth)
+	}
+	_, err := Parse(nested("(", ")", 100))
+	require.NoError(t, err)
+	_, err = Parse(nested("NOT ", "", 100))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		query string
+		pos   int
+	}{
+		{"nested_parentheses", nested("(", ")", 101), 101},
+		{"nested_not", nested("NOT ", "", 101), 401},
+		{"nested_mixed", nested("NOT (", ")", 51), 251},
+		{"too_long", strings.Repeat("(", 3500000), 1001},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse(tc.query)
+			require.Error(t, err)
+			syntaxErr, ok := err.(*SyntaxError)
+			require.True(t, ok)
+			require.Equal(t, tc.pos, syntaxErr.Pos, err.Error())
+		})
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"log"
 )
 
-// AuthInterceptor 服务端用于鉴权的拦截器
+// AuthInterceptor 服务端用于鉴权的拦截器，accessibleRoles通常为auth.AccessibleRoles()
 type AuthInterceptor struct {
 	jwtManager      *JWTManager
 	accessibleRoles map[string][]string
@@ -23,7 +23,7 @@ func NewAuthInterceptor(jwtManager *JWTManager, accessibleRoles map[string][]str
 func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		log.Print("--> unary interceptor: ", info.FullMethod)
-		err := interceptor.authorize(ctx, info.FullMethod)
+		ctx, err := interceptor.authorize(ctx, info.FullMethod)
 		if err != nil {
 			return nil, err
 		}
@@ -36,43 +36,68 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 func (interceptor *AuthInterceptor) Stream() grpc.StreamServerInterceptor {
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		log.Print("--> stream interceptor: ", info.FullMethod)
-		err := interceptor.authorize(stream.Context(), info.FullMethod)
+		ctx, err := interceptor.authorize(stream.Context(), info.FullMethod)
 		if err != nil {
 			return err
 		}
-		return handler(srv, stream)
+		return handler(srv, &authServerStream{ServerStream: stream, ctx: ctx})
 	}
 }
 
-func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) error {
+// authorize 鉴权验证，通过后返回包含用户信息的context
+func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) (context.Context, error) {
 	//不在授权角色列表中的方法，则不需要进行鉴权验证
 	accessibleRoles, ok := interceptor.accessibleRoles[method]
 	if !ok {
-		return nil
+		return ctx, nil
 	}
 
 	//从context中获取jwt
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
-		return status.Errorf(codes.Unauthenticated, "metadata is not provided")
+		return nil, status.Errorf(codes.Unauthenticated, "metadata is not provided")
 	}
 	values := md["authorization"]
 	if len(values) == 0 {
-		return status.Errorf(codes.Unauthenticated, "authorization token is not provided")
+		return nil, status.Errorf(codes.Unauthenticated, "authorization token is not provided")
 	}
 	accessToken := values[0]
 
 	//解析jwt
 	claims, err := interceptor.jwtManager.Verify(accessToken)
 	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "access token is invalid: %v", err)
+		return nil, status.Errorf(codes.Unauthenticated, "access token is invalid: %v", err)
 	}
 
 	//判断token中对应的用户角色，是否有该方法的访问权限
 	for _, role := range accessibleRoles {
 		if role == claims.Role {
-			return nil
+			return ContextWithClaims(ctx, claims), nil
 		}
 	}
-	return status.Errorf(codes.PermissionDenied, "no permission to access this rpc")
+	return nil, status.Errorf(codes.PermissionDenied, "no permission to access this rpc")
+}
+
+// authServerStream 替换了context的ServerStream，用于将用户信息传递给流模式的handler
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authServerStream) Context() context.Context {
+	return stream.ctx
+}
+
+// claimsContextKey context中保存用户信息的key
+type claimsContextKey struct{}
+
+// ContextWithClaims 返回保存了claims的context
+func ContextWithClaims(ctx context.Context, claims *UserClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext 获取鉴权通过后保存在context中的用户信息，不需要鉴权的方法中不存在
+func ClaimsFromContext(ctx context.Context) (*UserClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*UserClaims)
+	return claims, ok && claims != nil
 }
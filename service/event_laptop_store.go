@@ -0,0 +1,73 @@
+package service
+
+import (
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"pcbook/pb"
+	"sync"
+)
+
+// EventLaptopStore 包装LaptopStore，写操作成功后向事件总线发布变更事件
+type EventLaptopStore struct {
+	LaptopStore
+	mutex sync.Mutex //串行化写操作，保证事件顺序与写入顺序一致
+	bus   *LaptopEventBus
+}
+
+func NewEventLaptopStore(store LaptopStore, bus *LaptopEventBus) *EventLaptopStore {
+	return &EventLaptopStore{
+		LaptopStore: store,
+		bus:         bus,
+	}
+}
+
+// Save 保存laptop，并发布CREATED事件
+func (store *EventLaptopStore) Save(laptop *pb.Laptop) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := store.LaptopStore.Save(laptop)
+	if err != nil {
+		return err
+	}
+	//重新查询，事件中包含服务端维护的字段
+	saved, err := store.LaptopStore.Find(laptop.GetId())
+	if err != nil {
+		return err
+	}
+	store.bus.Publish(pb.LaptopEvent_CREATED, saved, nil)
+	return nil
+}
+
+// Update 更新laptop，并发布UPDATED事件
+func (store *EventLaptopStore) Update(laptop *pb.Laptop, mask *fieldmaskpb.FieldMask, revision uint64) (*pb.Laptop, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	previous, err := store.LaptopStore.Find(laptop.GetId())
+	if err != nil {
+		return nil, err
+	}
+	updated, err := store.LaptopStore.Update(laptop, mask, revision)
+	if err != nil {
+		return nil, err
+	}
+	store.bus.Publish(pb.LaptopEvent_UPDATED, updated, previous)
+	return updated, nil
+}
+
+// Delete 删除laptop，并发布DELETED事件
+func (store *EventLaptopStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	previous, err := store.LaptopStore.Find(id)
+	if err != nil {
+		return err
+	}
+	err = store.LaptopStore.Delete(id)
+	if err != nil {
+		return err
+	}
+	store.bus.Publish(pb.LaptopEvent_DELETED, previous, nil)
+	return nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"strings"
+)
+
+var ErrInvalidFieldMask = errors.New("invalid field mask")
+
+// applyFieldMask 将src中mask指定的字段复制到dst中，支持嵌套路径(cpu.max_ghz)和oneof名称(weight)
+// dst和src必须为同一类型的proto对象，路径不合法时返回ErrInvalidFieldMask
+func applyFieldMask(dst, src proto.Message, mask *fieldmaskpb.FieldMask) error {
+	//先校验所有路径，避免只更新了一部分字段
+	for _, path := range mask.GetPaths() {
+		if err := checkFieldPath(dst.ProtoReflect().Descriptor(), path); err != nil {
+			return err
+		}
+	}
+
+	//复制一份src，防止dst与src共享repeated字段或子对象
+	src = proto.Clone(src)
+	for _, path := range mask.GetPaths() {
+		applyFieldPath(dst.ProtoReflect(), src.ProtoReflect(), strings.Split(path, "."))
+	}
+	return nil
+}
+
+// checkFieldPath 校验字段路径是否存在于message定义中
+func checkFieldPath(md protoreflect.MessageDescriptor, path string) error {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		last := i == len(names)-1
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			//最后一级允许为oneof名称
+			if last && md.Oneofs().ByName(protoreflect.Name(name)) != nil {
+				return nil
+			}
+			return fmt.Errorf("%w: unknown path %q", ErrInvalidFieldMask, path)
+		}
+		if last {
+			return nil
+		}
+		//中间路径必须为非repeated的message类型
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("%w: path %q cannot traverse field %s", ErrInvalidFieldMask, path, name)
+		}
+		md = fd.Message()
+	}
+	return fmt.Errorf("%w: empty path", ErrInvalidFieldMask)
+}
+
+// applyFieldPath 按路径逐级复制字段，调用前路径已经过checkFieldPath校验
+func applyFieldPath(dst, src protoreflect.Message, names []string) {
+	md := dst.Descriptor()
+	name := protoreflect.Name(names[0])
+
+	//oneof：先清除dst中已设置的字段，再复制src中已设置的字段
+	if od := md.Oneofs().ByName(name); od != nil && md.Fields().ByName(name) == nil {
+		if fd := dst.WhichOneof(od); fd != nil {
+			dst.Clear(fd)
+		}
+		if fd := src.WhichOneof(od); fd != nil {
+			dst.Set(fd, cloneValue(dst, fd, src.Get(fd)))
+		}
+		return
+	}
+
+	fd := md.Fields().ByName(name)
+	if len(names) > 1 {
+		//src中未设置的子对象当作空对象处理，对应字段会被清除
+		applyFieldPath(dst.Mutable(fd).Message(), src.Get(fd).Message(), names[1:])
+		return
+	}
+
+	if src.Has(fd) {
+		dst.Set(fd, cloneValue(dst, fd, src.Get(fd)))
+	} else {
+		dst.Clear(fd)
+	}
+}
+
+// cloneValue 深拷贝字段的值，Set不会复制子对象，直接设置会导致dst和src共享同一个对象
+func cloneValue(dst protoreflect.Message, fd protoreflect.FieldDescriptor, v protoreflect.Value) protoreflect.Value {
+	cloneItem := func(item protoreflect.Value, md protoreflect.MessageDescriptor) protoreflect.Value {
+		if md == nil {
+			return item
+		}
+		return protoreflect.ValueOfMessage(proto.Clone(item.Message().Interface()).ProtoReflect())
+	}
+
+	switch {
+	case fd.IsList():
+		list := dst.NewField(fd).List()
+		for i := 0; i < v.List().Len(); i++ {
+			list.Append(cloneItem(v.List().Get(i), fd.Message()))
+		}
+		return protoreflect.ValueOfList(list)
+	case fd.IsMap():
+		m := dst.NewField(fd).Map()
+		v.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			m.Set(key, cloneItem(value, fd.MapValue().Message()))
+			return true
+		})
+		return protoreflect.ValueOfMap(m)
+	default:
+		return cloneItem(v, fd.Message())
+	}
+}
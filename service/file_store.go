@@ -0,0 +1,260 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"pcbook/pb"
+	"pcbook/serializer"
+	"sync"
+	"time"
+)
+
+const _snapshotFile = "snapshot.bin"
+
+// FileStores 使用快照和预写日志持久化到dir目录的内存存储器，不依赖外部数据库
+// 每次修改都会先写入日志，定期将全部数据写入快照并删除快照之前的日志，启动时先读取快照再重放日志
+type FileStores struct {
+	LaptopStore *InMemoryLaptopStore
+	UserStore   *InMemoryUserStore
+	RateStore   *InMemoryRateStore
+	ReviewStore *InMemoryReviewStore
+
+	dir           string
+	wal           *writeAheadLog
+	snapshotMutex sync.Mutex //同一时间只生成一个快照
+	done          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// OpenFileStores 从dir中恢复数据，snapshotInterval大于0时按该间隔在后台生成快照
+func OpenFileStores(dir string, snapshotInterval time.Duration) (*FileStores, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create data directory: %w", err)
+	}
+
+	rateStore := NewInMemoryRateStore()
+	stores := &FileStores{
+		LaptopStore: NewInMemoryLaptopStore(),
+		UserStore:   NewInMemoryUserStore(),
+		RateStore:   rateStore,
+		ReviewStore: NewInMemoryReviewStore(rateStore),
+		dir:         dir,
+		done:        make(chan struct{}),
+	}
+	segment, err := stores.recover()
+	if err != nil {
+		return nil, err
+	}
+
+	stores.wal, err = openWriteAheadLog(dir, segment)
+	if err != nil {
+		return nil, err
+	}
+	stores.LaptopStore.wal = stores.wal
+	stores.UserStore.wal = stores.wal
+	stores.RateStore.wal = stores.wal
+	stores.ReviewStore.wal = stores.wal
+
+	if snapshotInterval > 0 {
+		stores.wg.Add(1)
+		go stores.snapshotLoop(snapshotInterval)
+	}
+	return stores, nil
+}
+
+// recover 读取快照并重放之后的日志，返回之后继续写入的日志编号
+func (stores *FileStores) recover() (uint64, error) {
+	var segment uint64
+	path := filepath.Join(stores.dir, _snapshotFile)
+	if _, err := os.Stat(path); err == nil {
+		snapshot := &pb.StoreSnapshot{}
+		err := serializer.ReadProtobufFromBinaryFile(path, snapshot)
+		if err != nil {
+			return 0, fmt.Errorf("cannot read snapshot: %w", err)
+		}
+		stores.restore(snapshot)
+		segment = snapshot.GetNextSegment()
+	}
+
+	segments, err := listSegments(stores.dir)
+	if err != nil {
+		return 0, fmt.Errorf("cannot list write-ahead logs: %w", err)
+	}
+	for i, s := range segments {
+		//快照之前的日志已经包含在快照中，可能是删除日志前崩溃遗留的
+		if s < segment {
+			continue
+		}
+		err := replaySegment(segmentPath(stores.dir, s), i == len(segments)-1, stores.apply)
+		if err != nil {
+			return 0, err
+		}
+		segment = s
+	}
+	return segment, nil
+}
+
+// restore 将快照中的数据加载到存储器
+func (stores *FileStores) restore(snapshot *pb.StoreSnapshot) {
+	for _, laptop := range snapshot.GetLaptops() {
+		stores.LaptopStore.put(laptop)
+	}
+	for _, user := range snapshot.GetUsers() {
+		stores.UserStore.users[user.GetUsername()] = userFromProto(user)
+	}
+	for _, rating := range snapshot.GetUserRatings() {
+		stores.RateStore.put(rating.GetUsername(), rating.GetLaptopId(), rating.GetScore())
+	}
+	for _, review := range snapshot.GetReviews() {
+		stores.ReviewStore.put(review)
+	}
+	for _, vote := range snapshot.GetReviewVotes() {
+		stores.ReviewStore.addVoter(vote.GetReviewId(), vote.GetUsername())
+	}
+}
+
+// apply 重放一条变更记录
+func (stores *FileStores) apply(mutation *pb.StoreMutation) {
+	switch m := mutation.GetMutation().(type) {
+	case *pb.StoreMutation_PutLaptop:
+		stores.LaptopStore.put(m.PutLaptop)
+	case *pb.StoreMutation_DeleteLaptopId:
+		stores.LaptopStore.remove(m.DeleteLaptopId)
+	case *pb.StoreMutation_PutUser:
+		stores.UserStore.users[m.PutUser.GetUsername()] = userFromProto(m.PutUser)
+	case *pb.StoreMutation_PutUserRating:
+		rating := m.PutUserRating
+		stores.RateStore.put(rating.GetUsername(), rating.GetLaptopId(), rating.GetScore())
+	case *pb.StoreMutation_DeleteUserRating:
+		stores.RateStore.remove(m.DeleteUserRating.GetUsername(), m.DeleteUserRating.GetLaptopId())
+	case *pb.StoreMutation_PutReview:
+		review := m.PutReview
+		stores.ReviewStore.put(review)
+		stores.RateStore.put(review.GetAuthor(), review.GetLaptopId(), review.GetScore())
+	case *pb.StoreMutation_PutReviewVote:
+		stores.ReviewStore.vote(m.PutReviewVote.GetReviewId(), m.PutReviewVote.GetUsername())
+	}
+}
+
+// Snapshot 将全部数据写入快照，并删除快照之前的日志
+func (stores *FileStores) Snapshot() error {
+	stores.snapshotMutex.Lock()
+	defer stores.snapshotMutex.Unlock()
+
+	snapshot, err := stores.capture()
+	if err != nil {
+		return err
+	}
+
+	//先写入临时文件再重命名，写入过程中崩溃不会破坏已有的快照
+	path := filepath.Join(stores.dir, _snapshotFile)
+	tmpPath := path + ".tmp"
+	err = serializer.WriteProtobufToBinaryFile(snapshot, tmpPath)
+	if err != nil {
+		return fmt.Errorf("cannot write snapshot: %w", err)
+	}
+	err = syncFile(tmpPath)
+	if err != nil {
+		return fmt.Errorf("cannot sync snapshot: %w", err)
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return fmt.Errorf("cannot rename snapshot: %w", err)
+	}
+	err = syncFile(stores.dir)
+	if err != nil {
+		return fmt.Errorf("cannot sync data directory: %w", err)
+	}
+	return stores.wal.removeBefore(snapshot.GetNextSegment())
+}
+
+// capture 在所有存储器的读锁内复制数据并切换到新的日志文件，保证快照与之后的日志不重叠也不遗漏
+func (stores *FileStores) capture() (*pb.StoreSnapshot, error) {
+	stores.LaptopStore.mutex.RLock()
+	defer stores.LaptopStore.mutex.RUnlock()
+	stores.UserStore.mutex.RLock()
+	defer stores.UserStore.mutex.RUnlock()
+	//与写操作的加锁顺序相同，先锁定评价再锁定评分
+	stores.ReviewStore.mutex.RLock()
+	defer stores.ReviewStore.mutex.RUnlock()
+	stores.RateStore.mutex.RLock()
+	defer stores.RateStore.mutex.RUnlock()
+
+	segment, err := stores.wal.rotate()
+	if err != nil {
+		return nil, err
+	}
+
+	//存储的laptop和review写入后不会被修改，可以直接引用
+	snapshot := &pb.StoreSnapshot{NextSegment: segment}
+	for _, laptop := range stores.LaptopStore.data {
+		snapshot.Laptops = append(snapshot.Laptops, laptop)
+	}
+	for _, user := range stores.UserStore.users {
+		snapshot.Users = append(snapshot.Users, user.toProto())
+	}
+	for laptopID, scores := range stores.RateStore.scores {
+		for username, score := range scores {
+			snapshot.UserRatings = append(snapshot.UserRatings, &pb.StoredUserRating{
+				Username: username,
+				LaptopId: laptopID,
+				Score:    score,
+			})
+		}
+	}
+	for _, review := range stores.ReviewStore.data {
+		snapshot.Reviews = append(snapshot.Reviews, review)
+	}
+	for reviewID, voters := range stores.ReviewStore.votes {
+		for username := range voters {
+			snapshot.ReviewVotes = append(snapshot.ReviewVotes, &pb.StoredReviewVote{
+				ReviewId: reviewID,
+				Username: username,
+			})
+		}
+	}
+	return snapshot, nil
+}
+
+// snapshotLoop 定期生成快照，直到Close
+func (stores *FileStores) snapshotLoop(interval time.Duration) {
+	defer stores.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stores.done:
+			return
+		case <-ticker.C:
+			err := stores.Snapshot()
+			if err != nil {
+				log.Printf("cannot snapshot stores: %v", err)
+			}
+		}
+	}
+}
+
+// Close 停止后台快照，生成最后一个快照并关闭日志文件
+func (stores *FileStores) Close() error {
+	close(stores.done)
+	stores.wg.Wait()
+
+	err := stores.Snapshot()
+	if err != nil {
+		return err
+	}
+	return stores.wal.close()
+}
+
+// syncFile 将文件或目录同步到磁盘
+func syncFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
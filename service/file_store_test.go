@@ -0,0 +1,196 @@
+package service
+
+import (
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io/ioutil"
+	"os"
+	"pcbook/pb"
+	"pcbook/sample"
+	"testing"
+)
+
+func TestFileStoresReopen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	stores, err := OpenFileStores(dir, 0)
+	require.NoError(t, err)
+
+	laptop1 := sample.NewLaptop()
+	laptop2 := sample.NewLaptop()
+	require.NoError(t, stores.LaptopStore.Save(laptop1))
+	require.NoError(t, stores.LaptopStore.Save(laptop2))
+	user, err := NewUser("user1", "secret", "user")
+	require.NoError(t, err)
+	require.NoError(t, stores.UserStore.Save(user))
+	//评价的分数同时记录为user1的评分
+	review := &pb.Review{Id: "review1", LaptopId: laptop1.Id, Author: "user1", Score: 8, Title: "good", CreatedAt: timestamppb.Now()}
+	_, err = stores.ReviewStore.Save(review)
+	require.NoError(t, err)
+	_, err = stores.ReviewStore.Vote(review.Id, "user2")
+	require.NoError(t, err)
+
+	//未生成快照时只依赖日志恢复
+	stores = reopenFileStores(t, stores, dir, false)
+	requireLaptop(t, stores, laptop1, 1)
+	requireLaptop(t, stores, laptop2, 1)
+	found, err := stores.UserStore.Find("user1")
+	require.NoError(t, err)
+	require.True(t, found.IsCorrectPassword("secret"))
+	require.Equal(t, "user", found.Role)
+	foundReview, err := stores.ReviewStore.Find(review.Id)
+	require.NoError(t, err)
+	require.Equal(t, "good", foundReview.GetTitle())
+	require.EqualValues(t, 1, foundReview.GetHelpfulVotes())
+	userRating, err := stores.RateStore.FindUserRating("user1", laptop1.Id)
+	require.NoError(t, err)
+	require.Equal(t, 8.0, userRating.Score)
+
+	//快照之后的修改写入新的日志
+	require.NoError(t, stores.Snapshot())
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"price_used"}}
+	_, err = stores.LaptopStore.Update(&pb.Laptop{Id: laptop1.Id, PriceUsed: 999}, mask, 1)
+	require.NoError(t, err)
+	require.NoError(t, stores.LaptopStore.Delete(laptop2.Id))
+	_, err = stores.RateStore.Rate("user2", laptop1.Id, 6)
+	require.NoError(t, err)
+	_, err = stores.RateStore.Rate("user3", laptop1.Id, 1)
+	require.NoError(t, err)
+	_, err = stores.RateStore.Delete("user3", laptop1.Id)
+	require.NoError(t, err)
+	_, err = stores.ReviewStore.Vote(review.Id, "user3")
+	require.NoError(t, err)
+
+	stores = reopenFileStores(t, stores, dir, false)
+	found1, err := stores.LaptopStore.Find(laptop1.Id)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, found1.GetRevision())
+	require.Equal(t, 999.0, found1.GetPriceUsed())
+	found2, err := stores.LaptopStore.Find(laptop2.Id)
+	require.NoError(t, err)
+	require.Nil(t, found2)
+	rating, err := stores.RateStore.Find(laptop1.Id)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, rating.Count)
+	require.Equal(t, 14.0, rating.Sum)
+	//快照中的投票不会重复计数，快照之后的投票重放后增加计数
+	foundReview, err = stores.ReviewStore.Find(review.Id)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, foundReview.GetHelpfulVotes())
+	_, err = stores.ReviewStore.Vote(review.Id, "user2")
+	require.ErrorIs(t, err, ErrAlreadyExists)
+
+	//Close生成快照并删除之前的日志
+	stores = reopenFileStores(t, stores, dir, true)
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	requireLaptop(t, stores, found1, 2)
+	require.NoError(t, stores.Close())
+}
+
+func TestFileStoresTruncatedRecord(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	stores, err := OpenFileStores(dir, 0)
+	require.NoError(t, err)
+	laptop := sample.NewLaptop()
+	require.NoError(t, stores.LaptopStore.Save(laptop))
+	require.NoError(t, stores.wal.close())
+
+	//模拟写入最后一条记录时崩溃
+	path := segmentPath(dir, stores.wal.segment)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	stores, err = OpenFileStores(dir, 0)
+	require.NoError(t, err)
+	requireLaptop(t, stores, laptop, 1)
+	truncated, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, info.Size(), truncated.Size())
+
+	//截断后继续写入的记录可以正常恢复
+	other := sample.NewLaptop()
+	require.NoError(t, stores.LaptopStore.Save(other))
+	stores = reopenFileStores(t, stores, dir, false)
+	requireLaptop(t, stores, laptop, 1)
+	requireLaptop(t, stores, other, 1)
+	require.NoError(t, stores.Close())
+}
+
+func TestFileStoresCorruptLog(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	stores, err := OpenFileStores(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, stores.LaptopStore.Save(sample.NewLaptop()))
+	require.NoError(t, stores.LaptopStore.Save(sample.NewLaptop()))
+	require.NoError(t, stores.wal.close())
+
+	//不是最后一条记录的校验失败不能当作写入未完成处理
+	path := segmentPath(dir, stores.wal.segment)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	data[_walRecordHeaderSize] ^= 0xff
+	require.NoError(t, ioutil.WriteFile(path, data, 0644))
+
+	_, err = OpenFileStores(dir, 0)
+	require.ErrorIs(t, err, ErrCorruptLog)
+}
+
+func TestFileStoresStaleSegment(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	stores, err := OpenFileStores(dir, 0)
+	require.NoError(t, err)
+	laptop := sample.NewLaptop()
+	require.NoError(t, stores.LaptopStore.Save(laptop))
+	stale, err := ioutil.ReadFile(segmentPath(dir, stores.wal.segment))
+	require.NoError(t, err)
+	require.NoError(t, stores.LaptopStore.Delete(laptop.Id))
+	require.NoError(t, stores.Close())
+
+	//模拟删除旧日志之前崩溃，快照中已包含的记录不能再次重放
+	require.NoError(t, ioutil.WriteFile(segmentPath(dir, 0), stale, 0644))
+	stores, err = OpenFileStores(dir, 0)
+	require.NoError(t, err)
+	found, err := stores.LaptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, found)
+	require.NoError(t, stores.Close())
+}
+
+// reopenFileStores 关闭stores后重新打开，snapshot为false时模拟未生成快照就退出
+func reopenFileStores(t *testing.T, stores *FileStores, dir string, snapshot bool) *FileStores {
+	if snapshot {
+		require.NoError(t, stores.Close())
+	} else {
+		require.NoError(t, stores.wal.close())
+	}
+	stores, err := OpenFileStores(dir, 0)
+	require.NoError(t, err)
+	return stores
+}
+
+// requireLaptop 检查stores中保存的laptop与expected一致，且版本号为revision，忽略服务端维护的更新时间
+func requireLaptop(t *testing.T, stores *FileStores, expected *pb.Laptop, revision uint64) {
+	found, err := stores.LaptopStore.Find(expected.Id)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	require.EqualValues(t, revision, found.GetRevision())
+	found.Revision = expected.GetRevision()
+	found.UpdateAt = expected.GetUpdateAt()
+	require.True(t, proto.Equal(expected, found))
+}
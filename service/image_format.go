@@ -0,0 +1,463 @@
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	_ "golang.org/x/image/webp" //注册webp解码器
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ErrInvalidImage 图片内容不合法：不是支持的图片格式、与图片类型不一致或尺寸超出限制
+var ErrInvalidImage = errors.New("invalid image")
+
+// imageFormat 支持的图片格式
+type imageFormat struct {
+	mimeType   string
+	extensions []string                                     //该格式允许的图片类型
+	strip      func(dst io.Writer, src io.ReadSeeker) error //去除EXIF等元数据和图片结束后附加的数据后写入dst
+}
+
+// _imageFormats image.DecodeConfig返回的格式名称 -> 图片格式
+var _imageFormats = map[string]imageFormat{
+	"png":  {mimeType: "image/png", extensions: []string{".png"}, strip: stripPNGMetadata},
+	"jpeg": {mimeType: "image/jpeg", extensions: []string{".jpg", ".jpeg"}, strip: stripJPEGMetadata},
+	"gif":  {mimeType: "image/gif", extensions: []string{".gif"}, strip: stripGIFMetadata},
+	"webp": {mimeType: "image/webp", extensions: []string{".webp"}, strip: stripWebPMetadata},
+}
+
+// normalizeImage 根据图片内容识别格式，检查是否与imageType一致、宽高是否超过maxDimension，
+// 返回读取去除元数据后的图片数据的reader和MIME类型。数据在读取时才从src中处理，
+// 处理出错时读取返回ErrInvalidImage，调用方读取完成前不能使用src，读取后需要关闭返回的reader
+func normalizeImage(imageType string, src io.ReadSeeker, maxDimension int) (io.ReadCloser, string, error) {
+	config, name, err := image.DecodeConfig(src)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: unsupported image format", ErrInvalidImage)
+	}
+	format, ok := _imageFormats[name]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: unsupported image format %s", ErrInvalidImage, name)
+	}
+	if !containsString(format.extensions, strings.ToLower(imageType)) {
+		return nil, "", fmt.Errorf("%w: image type %q does not match content %s", ErrInvalidImage, imageType, format.mimeType)
+	}
+	if config.Width > maxDimension || config.Height > maxDimension {
+		return nil, "", fmt.Errorf("%w: image size %dx%d exceeds %dx%d",
+			ErrInvalidImage, config.Width, config.Height, maxDimension, maxDimension)
+	}
+
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot seek image: %w", err)
+	}
+	//边读取边去除元数据，不需要将整个图片读入内存
+	reader, writer := io.Pipe()
+	go func() {
+		err := format.strip(writer, src)
+		if err != nil {
+			err = fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader, format.mimeType, nil
+}
+
+// imageExtension 根据MIME类型获取图片类型(扩展名)，未知类型时为空
+func imageExtension(mimeType string) string {
+	for _, format := range _imageFormats {
+		if format.mimeType == mimeType {
+			return format.extensions[0]
+		}
+	}
+	return ""
+}
+
+// imageMIMEType 根据图片类型(扩展名)获取MIME类型，未知类型时为空
+func imageMIMEType(imageType string) string {
+	for _, format := range _imageFormats {
+		if containsString(format.extensions, strings.ToLower(imageType)) {
+			return format.mimeType
+		}
+	}
+	return ""
+}
+
+// containsString 判断values中是否包含value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// stripPNGMetadata 去除PNG中的eXIf和文本chunk
+func stripPNGMetadata(dst io.Writer, src io.ReadSeeker) error {
+	signature := make([]byte, 8)
+	_, err := io.ReadFull(src, signature)
+	if err != nil {
+		return errors.New("truncated png")
+	}
+	_, err = dst.Write(signature)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	for {
+		//每个chunk为4字节长度、4字节类型、数据和4字节CRC
+		_, err = io.ReadFull(src, header)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New("truncated png chunk")
+		}
+		chunkType := string(header[4:])
+		size := int64(binary.BigEndian.Uint32(header)) + 4
+		switch chunkType {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+			err = skipBytes(src, size)
+		default:
+			err = copyBytes(dst, src, header, size)
+		}
+		if err != nil {
+			return err
+		}
+		if chunkType == "IEND" {
+			return nil
+		}
+	}
+}
+
+// stripJPEGMetadata 去除JPEG中的APP1(EXIF、XMP)和APP13(IPTC)段，图像数据不变，EOI之后的数据被丢弃
+func stripJPEGMetadata(dst io.Writer, src io.ReadSeeker) error {
+	reader := bufio.NewReader(src)
+	writer := bufio.NewWriter(dst)
+	soi := make([]byte, 2)
+	_, err := io.ReadFull(reader, soi)
+	if err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return errors.New("missing jpeg start of image")
+	}
+	_, err = writer.Write(soi)
+	if err != nil {
+		return err
+	}
+
+	for {
+		prefix, err := reader.ReadByte()
+		if err == io.EOF {
+			return errors.New("missing jpeg end of image")
+		}
+		if err != nil {
+			return err
+		}
+		if prefix != 0xFF {
+			return errors.New("invalid jpeg marker")
+		}
+		marker, err := reader.ReadByte()
+		//填充字节
+		for err == nil && marker == 0xFF {
+			marker, err = reader.ReadByte()
+		}
+		if err == io.EOF {
+			return errors.New("missing jpeg end of image")
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case marker == 0xD9:
+			//图像结束，之后附加的数据不属于图片
+			_, err = writer.Write([]byte{0xFF, marker})
+			if err == nil {
+				err = writer.Flush()
+			}
+			return err
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			//没有长度字段的marker
+			_, err = writer.Write([]byte{0xFF, marker})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		header := []byte{0xFF, marker, 0, 0}
+		_, err = io.ReadFull(reader, header[2:])
+		if err != nil {
+			return errors.New("truncated jpeg segment")
+		}
+		size := int64(binary.BigEndian.Uint16(header[2:])) - 2
+		if size < 0 {
+			return errors.New("truncated jpeg segment")
+		}
+		if marker == 0xE1 || marker == 0xED {
+			err = skipBytes(reader, size)
+		} else {
+			err = copyBytes(writer, reader, header, size)
+		}
+		if err == nil && marker == 0xDA {
+			err = copyJPEGScan(writer, reader)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyJPEGScan 复制扫描开始段之后的图像数据，遇到下一个marker时停止，该marker留在src中
+func copyJPEGScan(dst *bufio.Writer, src *bufio.Reader) error {
+	for {
+		next, err := src.Peek(2)
+		if err == io.EOF {
+			return errors.New("missing jpeg end of image")
+		}
+		if err != nil {
+			return err
+		}
+		//0xFF00是转义的0xFF，RSTn在图像数据中间，其他都是marker
+		n := 1
+		if next[0] == 0xFF {
+			if next[1] != 0x00 && (next[1] < 0xD0 || next[1] > 0xD7) {
+				return nil
+			}
+			n = 2
+		}
+		_, err = dst.Write(next[:n])
+		if err == nil {
+			_, err = src.Discard(n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// stripGIFMetadata 去除GIF中的注释扩展和XMP应用扩展，结束符之后的数据被丢弃
+func stripGIFMetadata(dst io.Writer, src io.ReadSeeker) error {
+	reader := bufio.NewReader(src)
+	writer := bufio.NewWriter(dst)
+	//6字节签名和版本、7字节逻辑屏幕描述符
+	header := make([]byte, 13)
+	_, err := io.ReadFull(reader, header)
+	if err != nil || string(header[:3]) != "GIF" {
+		return errors.New("invalid gif header")
+	}
+	err = copyBytes(writer, reader, header, gifColorTableSize(header[10]))
+	if err != nil {
+		return err
+	}
+
+	for {
+		introducer, err := reader.ReadByte()
+		if err == io.EOF {
+			return errors.New("missing gif trailer")
+		}
+		if err != nil {
+			return err
+		}
+
+		switch introducer {
+		case 0x3B:
+			//结束符，之后附加的数据不属于图片
+			err = writer.WriteByte(introducer)
+			if err == nil {
+				err = writer.Flush()
+			}
+			return err
+		case 0x2C:
+			//图像描述符为9字节，之后是局部颜色表、LZW最小码长和图像数据子块
+			descriptor := make([]byte, 10)
+			descriptor[0] = introducer
+			_, err = io.ReadFull(reader, descriptor[1:])
+			if err != nil {
+				return errors.New("truncated gif image")
+			}
+			err = copyBytes(writer, reader, descriptor, gifColorTableSize(descriptor[9])+1)
+			if err == nil {
+				err = copyGIFSubBlocks(writer, reader)
+			}
+		case 0x21:
+			err = copyGIFExtension(writer, reader)
+		default:
+			return errors.New("invalid gif block")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// gifColorTableSize 根据描述符中的标志计算颜色表的字节数，没有颜色表时为0
+func gifColorTableSize(flags byte) int64 {
+	if flags&0x80 == 0 {
+		return 0
+	}
+	return 3 << (flags&0x07 + 1)
+}
+
+// copyGIFExtension 复制扩展块，注释扩展和XMP应用扩展被丢弃
+func copyGIFExtension(dst io.Writer, src *bufio.Reader) error {
+	label, err := src.ReadByte()
+	if err != nil {
+		return errors.New("truncated gif extension")
+	}
+	if label == 0xFE {
+		return copyGIFSubBlocks(ioutil.Discard, src)
+	}
+	header := []byte{0x21, label}
+	if label == 0xFF {
+		//应用扩展的第一个子块为应用标识
+		identifier, err := src.Peek(12)
+		if err != nil {
+			return errors.New("truncated gif extension")
+		}
+		if string(identifier) == "\x0bXMP DataXMP" {
+			return copyGIFSubBlocks(ioutil.Discard, src)
+		}
+	}
+	_, err = dst.Write(header)
+	if err != nil {
+		return err
+	}
+	return copyGIFSubBlocks(dst, src)
+}
+
+// copyGIFSubBlocks 复制数据子块直到长度为0的结束块
+func copyGIFSubBlocks(dst io.Writer, src *bufio.Reader) error {
+	for {
+		size, err := src.ReadByte()
+		if err != nil {
+			return errors.New("truncated gif block")
+		}
+		err = copyBytes(dst, src, []byte{size}, int64(size))
+		if err != nil || size == 0 {
+			return err
+		}
+	}
+}
+
+// stripWebPMetadata 去除WebP中的EXIF和XMP chunk，并清除VP8X中对应的标志位，RIFF大小之后的数据被丢弃。
+// RIFF头中的文件大小位于所有chunk之前，需要先扫描一遍计算去除后的大小
+func stripWebPMetadata(dst io.Writer, src io.ReadSeeker) error {
+	const headerSize = 12
+	header := make([]byte, headerSize)
+	_, err := io.ReadFull(src, header)
+	if err != nil || string(header[:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return errors.New("invalid webp header")
+	}
+	//RIFF大小包括"WEBP"和所有chunk
+	chunksSize := int64(binary.LittleEndian.Uint32(header[4:])) - 4
+
+	//第一遍只读取chunk头，计算保留的chunk的大小
+	riffSize := int64(4)
+	err = walkWebPChunks(src, chunksSize, func(chunkHeader []byte, size int64) error {
+		if !isWebPMetadata(chunkHeader) {
+			riffSize += 8 + size
+		}
+		_, err := src.Seek(size, io.SeekCurrent)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	end, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	fileSize, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if end > fileSize {
+		return errors.New("truncated webp chunk")
+	}
+
+	//第二遍写入保留的chunk
+	_, err = src.Seek(headerSize, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(header[4:], uint32(riffSize))
+	_, err = dst.Write(header)
+	if err != nil {
+		return err
+	}
+	return walkWebPChunks(src, chunksSize, func(chunkHeader []byte, size int64) error {
+		switch {
+		case isWebPMetadata(chunkHeader):
+			return skipBytes(src, size)
+		case string(chunkHeader[:4]) == "VP8X" && size > 0:
+			flags := make([]byte, 1)
+			_, err := io.ReadFull(src, flags)
+			if err != nil {
+				return errors.New("truncated webp chunk")
+			}
+			flags[0] &^= 0x08 | 0x04 //EXIF和XMP标志位
+			return copyBytes(dst, src, append(chunkHeader, flags...), size-1)
+		default:
+			return copyBytes(dst, src, chunkHeader, size)
+		}
+	})
+}
+
+// walkWebPChunks 依次读取chunksSize字节内每个chunk的头，调用handle处理之后的size字节，handle需要读取或跳过这些字节
+func walkWebPChunks(src io.Reader, chunksSize int64, handle func(chunkHeader []byte, size int64) error) error {
+	for chunksSize > 0 {
+		//每个chunk为4字节类型、4字节长度(小端)和数据，数据长度为奇数时补一个字节
+		chunkHeader := make([]byte, 8)
+		_, err := io.ReadFull(src, chunkHeader)
+		if err != nil {
+			return errors.New("truncated webp chunk")
+		}
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+		size += size & 1
+		chunksSize -= 8 + size
+		if chunksSize < 0 {
+			return errors.New("webp chunk exceeds riff size")
+		}
+		err = handle(chunkHeader, size)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isWebPMetadata 判断是否为EXIF或XMP chunk
+func isWebPMetadata(chunkHeader []byte) bool {
+	chunkType := string(chunkHeader[:4])
+	return chunkType == "EXIF" || chunkType == "XMP "
+}
+
+// copyBytes 写入header后从src复制size字节到dst，src中不足size字节时返回错误
+func copyBytes(dst io.Writer, src io.Reader, header []byte, size int64) error {
+	_, err := dst.Write(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(dst, src, size)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// skipBytes 跳过src中的size字节，不足size字节时返回错误
+func skipBytes(src io.Reader, size int64) error {
+	_, err := io.CopyN(ioutil.Discard, src, size)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNormalizeImage(t *testing.T) {
+	t.Parallel()
+
+	const maxDimension = 16
+	pngData := encodeTestImage(t, "png", 16, 10)
+	jpegData := encodeTestImage(t, "jpeg", 16, 10)
+	webpData := testWebPWithExif(t)
+	gifData := encodeTestImage(t, "gif", 10, 16)
+	testCases := []struct {
+		name      string //用例的名称
+		imageType string //客户端提供的图片类型
+		data      []byte //图片内容
+		mimeType  string //识别的MIME类型，为空时图片不合法
+		metadata  string //原图片中包含、处理后不应包含的元数据
+	}{
+		{name: "png", imageType: ".png", data: withPNGExif(t, pngData), mimeType: "image/png", metadata: "eXIf"},
+		{name: "jpeg", imageType: ".JPG", data: withJPEGExif(t, jpegData), mimeType: "image/jpeg", metadata: "Exif"},
+		{name: "gif", imageType: ".gif", data: withGIFComment(t, encodeTestImage(t, "gif", 10, 16)), mimeType: "image/gif", metadata: "comment"},
+		{name: "webp", imageType: ".webp", data: webpData, mimeType: "image/webp", metadata: "EXIF"},
+		{name: "zip_as_png", imageType: ".png", data: []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00")},
+		{name: "empty", imageType: ".png"},
+		{name: "type_mismatch", imageType: ".jpg", data: pngData},
+		{name: "unknown_type", imageType: ".exe", data: pngData},
+		{name: "too_large", imageType: ".png", data: encodeTestImage(t, "png", 16, 17)},
+		{name: "truncated", imageType: ".png", data: pngData[:len(pngData)-5]},
+		{name: "truncated_jpeg", imageType: ".jpg", data: jpegData[:200]},
+		{name: "truncated_webp", imageType: ".webp", data: webpData[:len(webpData)-4]},
+		{name: "truncated_gif", imageType: ".gif", data: gifData[:len(gifData)-1]},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			data, mimeType, err := normalizeTestImage(tc.imageType, tc.data, maxDimension)
+			if tc.mimeType == "" {
+				require.ErrorIs(t, err, ErrInvalidImage)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.mimeType, mimeType)
+			if tc.metadata != "" {
+				require.Contains(t, string(tc.data), tc.metadata)
+				require.NotContains(t, string(data), tc.metadata)
+			}
+
+			//去除元数据后仍然是完整的图片
+			_, format, err := image.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			require.Equal(t, tc.mimeType, _imageFormats[format].mimeType)
+		})
+	}
+}
+
+func TestNormalizeImageAppendedData(t *testing.T) {
+	t.Parallel()
+
+	//图片之后附加的ZIP或HTML内容可以使文件同时被识别为其他格式，保存时需要去除
+	payloads := []string{
+		"PK\x03\x04\x14\x00\x00\x00\x08\x00payload.html",
+		"<html><script>alert(1)</script></html>",
+	}
+	testCases := []struct {
+		imageType string
+		data      []byte
+	}{
+		{imageType: ".png", data: encodeTestImage(t, "png", 16, 10)},
+		{imageType: ".jpg", data: encodeTestImage(t, "jpeg", 16, 10)},
+		{imageType: ".gif", data: encodeTestImage(t, "gif", 16, 10)},
+		{imageType: ".webp", data: testWebPWithExif(t)},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.imageType, func(t *testing.T) {
+			t.Parallel()
+			expected, _, err := normalizeTestImage(tc.imageType, tc.data, 16)
+			require.NoError(t, err)
+			for _, payload := range payloads {
+				data := append(append([]byte{}, tc.data...), payload...)
+				normalized, _, err := normalizeTestImage(tc.imageType, data, 16)
+				require.NoError(t, err)
+				require.Equal(t, expected, normalized)
+			}
+		})
+	}
+}
+
+// normalizeTestImage 处理图片并读取全部结果，去除元数据时的错误在读取时才返回
+func normalizeTestImage(imageType string, data []byte, maxDimension int) ([]byte, string, error) {
+	reader, mimeType, err := normalizeImage(imageType, bytes.NewReader(data), maxDimension)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+	normalized, err := ioutil.ReadAll(reader)
+	return normalized, mimeType, err
+}
+
+// encodeTestImage 生成指定格式和尺寸的图片
+func encodeTestImage(t *testing.T, format string, width, height int) []byte {
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.Black, color.White})
+	for x := 0; x < width; x++ {
+		img.SetColorIndex(x, x%height, 1)
+	}
+	var buffer bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buffer, img)
+	case "jpeg":
+		err = jpeg.Encode(&buffer, img, nil)
+	case "gif":
+		err = gif.Encode(&buffer, img, nil)
+	}
+	require.NoError(t, err)
+	return buffer.Bytes()
+}
+
+// withPNGExif 在IHDR之后插入eXIf chunk
+func withPNGExif(t *testing.T, data []byte) []byte {
+	const ihdrEnd = 8 + 12 + 13
+	require.Equal(t, "IHDR", string(data[12:16]))
+	payload := []byte("eXIfMM\x00\x2a\x00\x00\x00\x08\x00\x00")
+	chunk := make([]byte, 4, 8+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)-4))
+	chunk = append(chunk, payload...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(payload))
+	chunk = append(chunk, crc...)
+
+	result := append([]byte{}, data[:ihdrEnd]...)
+	result = append(result, chunk...)
+	return append(result, data[ihdrEnd:]...)
+}
+
+// withJPEGExif 在SOI之后插入APP1 EXIF段
+func withJPEGExif(t *testing.T, data []byte) []byte {
+	require.Equal(t, []byte{0xFF, 0xD8}, data[:2])
+	payload := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x00")
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	result := append([]byte{}, data[:2]...)
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+// withGIFComment 在全局颜色表之后插入注释扩展
+func withGIFComment(t *testing.T, data []byte) []byte {
+	require.Equal(t, "GIF", string(data[:3]))
+	headerEnd := 13 + gifColorTableSize(data[10])
+	comment := []byte("\x21\xfe\x07comment\x00")
+
+	result := append([]byte{}, data[:headerEnd]...)
+	result = append(result, comment...)
+	return append(result, data[headerEnd:]...)
+}
+
+// testWebPWithExif 1x1的无损WebP图片，使用VP8X扩展格式并带有EXIF chunk
+func testWebPWithExif(t *testing.T) []byte {
+	simple, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	require.NoError(t, err)
+	vp8l := simple[12:]
+
+	//VP8X: 标志位、3字节保留、宽度-1和高度-1各3字节
+	result := []byte("RIFF\x00\x00\x00\x00WEBP")
+	result = append(result, "VP8X\x0a\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00"...)
+	result = append(result, vp8l...)
+	result = append(result, "EXIF\x06\x00\x00\x00MM\x00\x2a\x00\x00"...)
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result
+}
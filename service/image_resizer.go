@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/image/draw"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"sync"
+)
+
+// ImageVariantSizes 上传图片后生成的缩略图的最大边长，从小到大排列
+var ImageVariantSizes = []int{128, 512, 1024}
+
+// isVariantSize 判断size是否为支持的缩略图尺寸
+func isVariantSize(size int) bool {
+	for _, variantSize := range ImageVariantSizes {
+		if variantSize == size {
+			return true
+		}
+	}
+	return false
+}
+
+const _variantJPEGQuality = 85 //JPEG缩略图的质量
+
+// ImageResizer 使用固定数量的协程异步生成缩略图，待处理的图片数量超过队列长度时不再生成
+type ImageResizer struct {
+	store  ImageStore
+	jobs   chan string  //待生成缩略图的图片id
+	mutex  sync.RWMutex //保证Close之后不再向jobs发送
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewImageResizer 启动workers个生成缩略图的协程，queueSize为等待处理的图片的最大数量
+func NewImageResizer(store ImageStore, workers, queueSize int) *ImageResizer {
+	resizer := &ImageResizer{
+		store: store,
+		jobs:  make(chan string, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		resizer.wg.Add(1)
+		go resizer.work()
+	}
+	return resizer
+}
+
+// Submit 提交生成缩略图的任务，不会阻塞，队列已满或已关闭时返回false
+func (resizer *ImageResizer) Submit(imageID string) bool {
+	resizer.mutex.RLock()
+	defer resizer.mutex.RUnlock()
+	if resizer.closed {
+		return false
+	}
+	select {
+	case resizer.jobs <- imageID:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close 不再接受新的任务，等待队列中的任务全部完成
+func (resizer *ImageResizer) Close() {
+	resizer.mutex.Lock()
+	if !resizer.closed {
+		resizer.closed = true
+		close(resizer.jobs)
+	}
+	resizer.mutex.Unlock()
+	resizer.wg.Wait()
+}
+
+func (resizer *ImageResizer) work() {
+	defer resizer.wg.Done()
+	for imageID := range resizer.jobs {
+		err := resizer.resize(imageID)
+		if err != nil {
+			log.Printf("cannot generate variants of image %s: %v", imageID, err)
+		}
+	}
+}
+
+// resize 为图片生成所有比原图小的缩略图，JPEG图片的缩略图为JPEG，其他格式为PNG
+func (resizer *ImageResizer) resize(imageID string) error {
+	info, reader, err := resizer.store.Open(imageID)
+	if err != nil {
+		return err
+	}
+	src, _, err := image.Decode(reader)
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("cannot decode image: %w", err)
+	}
+
+	for _, size := range ImageVariantSizes {
+		bounds, ok := variantBounds(src.Bounds(), size)
+		if !ok {
+			break
+		}
+		if containsInt(info.Variants, size) {
+			//相同内容的图片已经生成过该尺寸的缩略图
+			continue
+		}
+		dst := image.NewRGBA(bounds)
+		draw.CatmullRom.Scale(dst, bounds, src, src.Bounds(), draw.Over, nil)
+
+		var data bytes.Buffer
+		mimeType := "image/png"
+		if info.MIMEType == "image/jpeg" {
+			mimeType = info.MIMEType
+			err = jpeg.Encode(&data, dst, &jpeg.Options{Quality: _variantJPEGQuality})
+		} else {
+			err = png.Encode(&data, dst)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot encode variant: %w", err)
+		}
+
+		err = resizer.store.SaveVariant(imageID, size, mimeType, &data)
+		if err != nil {
+			return fmt.Errorf("cannot save variant: %w", err)
+		}
+	}
+	return nil
+}
+
+// variantBounds 按比例缩放到最大边长为size后的尺寸，原图不大于size时不需要生成缩略图
+func variantBounds(src image.Rectangle, size int) (image.Rectangle, bool) {
+	width, height := src.Dx(), src.Dy()
+	if width <= size && height <= size {
+		return image.Rectangle{}, false
+	}
+	if width >= height {
+		height = maxInt(1, height*size/width)
+		width = size
+	} else {
+		width = maxInt(1, width*size/height)
+		height = size
+	}
+	return image.Rect(0, 0, width, height), true
+}
+
+// containsInt 判断values中是否包含value
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// maxInt 返回a和b中较大的值
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"image"
+	"pcbook/sample"
+	"testing"
+)
+
+func TestImageResizer(t *testing.T) {
+	t.Parallel()
+
+	store := openTestDiskImageStore(t, t.TempDir())
+	laptopID := sample.NewLaptop().Id
+	largeID, err := store.Save(laptopID, ".png", "image/png", bytes.NewReader(encodeTestImage(t, "png", 1500, 600)))
+	require.NoError(t, err)
+	mediumID, err := store.Save(laptopID, ".jpg", "image/jpeg", bytes.NewReader(encodeTestImage(t, "jpeg", 300, 600)))
+	require.NoError(t, err)
+	smallID, err := store.Save(laptopID, ".gif", "image/gif", bytes.NewReader(encodeTestImage(t, "gif", 100, 50)))
+	require.NoError(t, err)
+
+	resizer := NewImageResizer(store, 2, 10)
+	for _, id := range []string{largeID, mediumID, smallID, "missing"} {
+		require.True(t, resizer.Submit(id))
+	}
+	resizer.Close()
+	require.False(t, resizer.Submit(largeID))
+
+	//只生成比原图小的缩略图，保持宽高比
+	requireVariants := func(imageID string, mimeType string, expected map[int]image.Point) {
+		info, err := store.Find(imageID)
+		require.NoError(t, err)
+		var sizes []int
+		for size, dimension := range expected {
+			sizes = append(sizes, size)
+			variant, reader, err := store.OpenVariant(imageID, size)
+			require.NoError(t, err)
+			config, format, err := image.DecodeConfig(reader)
+			reader.Close()
+			require.NoError(t, err)
+			require.Equal(t, mimeType, variant.MIMEType)
+			require.Equal(t, mimeType, _imageFormats[format].mimeType)
+			require.Equal(t, dimension, image.Pt(config.Width, config.Height))
+		}
+		require.ElementsMatch(t, sizes, info.Variants)
+	}
+	requireVariants(largeID, "image/png", map[int]image.Point{
+		128:  image.Pt(128, 51),
+		512:  image.Pt(512, 204),
+		1024: image.Pt(1024, 409),
+	})
+	requireVariants(mediumID, "image/jpeg", map[int]image.Point{
+		128: image.Pt(64, 128),
+		512: image.Pt(256, 512),
+	})
+	requireVariants(smallID, "image/png", nil)
+}
+
+func TestImageResizer_QueueFull(t *testing.T) {
+	t.Parallel()
+
+	//没有处理任务的协程，队列满后不再接受任务
+	resizer := NewImageResizer(openTestDiskImageStore(t, t.TempDir()), 0, 1)
+	require.True(t, resizer.Submit("image1"))
+	require.False(t, resizer.Submit("image2"))
+}
@@ -2,67 +2,450 @@ package service
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+const _imageInfoExt = ".image.json" //保存图片信息的文件扩展名
+
 // ImageStore 图片存储器接口
 type ImageStore interface {
-	Save(laptopID string, imageType string, imageData bytes.Buffer) (string, error)
+	// Save 保存图片，读取imageData直到EOF，读取出错时不保存任何数据
+	Save(laptopID string, imageType string, mimeType string, imageData io.Reader) (string, error)
+	// Open 打开图片用于读取，图片不存在时返回ErrNotFound，调用方需要关闭返回的reader
+	Open(imageID string) (*ImageInfo, io.ReadCloser, error)
+	// Find 查询图片信息，不存在时返回nil
+	Find(imageID string) (*ImageInfo, error)
+	// ListByLaptop 查询laptop的所有图片，按上传时间从早到晚排列
+	ListByLaptop(laptopID string) ([]*ImageInfo, error)
+	// Delete 删除图片及其所有缩略图，不存在时返回ErrNotFound
+	Delete(imageID string) error
+	// SaveVariant 保存图片的缩略图，size为缩略图的最大边长，原图不存在时返回ErrNotFound
+	SaveVariant(imageID string, size int, mimeType string, imageData io.Reader) error
+	// OpenVariant 打开图片的缩略图，原图或该尺寸的缩略图不存在时返回ErrNotFound
+	OpenVariant(imageID string, size int) (*ImageInfo, io.ReadCloser, error)
+}
+
+// ImagePresigner 可以生成图片下载链接的ImageStore，客户端使用链接直接从存储服务下载图片
+type ImagePresigner interface {
+	// PresignImage 生成在expires内有效的下载链接，size为0时为原图，原图或该尺寸的缩略图不存在时返回ErrNotFound
+	PresignImage(imageID string, size int, expires time.Duration) (string, error)
 }
 
-// DiskImageStore 硬盘存储器实现
+// DiskImageStore 硬盘存储器实现，相同内容的图片只保存一份文件，文件名为内容的SHA-256，
+// 每张图片的信息保存在同一文件夹的"图片id.image.json"中，重启后重新读取
 type DiskImageStore struct {
 	mutex       sync.RWMutex
 	imageFolder string                //图片保存文件夹路径
 	images      map[string]*ImageInfo //图片的信息
+	blobs       map[string]*imageBlob //图片内容的SHA-256 -> 保存的文件
 }
 
 // ImageInfo 图片信息
 type ImageInfo struct {
-	LaptopID string
-	Type     string
-	Path     string
+	ID        string
+	LaptopID  string
+	Type      string
+	MIMEType  string //根据图片内容识别的MIME类型
+	Path      string
+	Size      int64     //图片大小，字节
+	CreatedAt time.Time //上传时间
+	Checksum  string    //图片内容的SHA-256(十六进制)，缩略图为空
+	Variants  []int     //已生成的缩略图的最大边长，从小到大排列
+	Variant   int       //缩略图的最大边长，原图为0
+}
+
+// imageBlob 硬盘上保存的图片内容，引用它的图片全部删除后才删除文件
+type imageBlob struct {
+	path     string
+	refs     int                //引用该内容的图片数量
+	variants map[int]*ImageInfo //缩略图的最大边长 -> 缩略图的文件信息，同一内容的图片共用缩略图
+}
+
+// diskImageRecord 保存在"图片id.image.json"中的图片信息
+type diskImageRecord struct {
+	ID        string    `json:"id"`
+	LaptopID  string    `json:"laptop_id"`
+	Type      string    `json:"type"`
+	MIMEType  string    `json:"mime_type"`
+	File      string    `json:"file"` //图片文件名，与信息文件在同一文件夹
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Checksum  string    `json:"checksum"`
 }
 
-func NewDiskImageStore(imageFolder string) *DiskImageStore {
-	return &DiskImageStore{
+// OpenDiskImageStore 创建图片文件夹并读取已保存的图片信息及缩略图
+func OpenDiskImageStore(imageFolder string) (*DiskImageStore, error) {
+	err := os.MkdirAll(imageFolder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create image folder: %w", err)
+	}
+	store := &DiskImageStore{
 		imageFolder: imageFolder,
 		images:      make(map[string]*ImageInfo),
+		blobs:       make(map[string]*imageBlob),
+	}
+
+	//1.读取图片信息，引用相同内容的图片共用一个文件
+	paths, err := filepath.Glob(filepath.Join(imageFolder, "*"+_imageInfoExt))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list image folder: %w", err)
 	}
+	for _, path := range paths {
+		info, err := store.readImageInfo(path)
+		if err != nil {
+			return nil, err
+		}
+		blob := store.blobs[info.Checksum]
+		if blob == nil {
+			blob = &imageBlob{
+				path:     info.Path,
+				variants: make(map[int]*ImageInfo),
+			}
+			store.blobs[info.Checksum] = blob
+		}
+		blob.refs++
+		store.images[info.ID] = info
+	}
+
+	//2.缩略图的文件名为"SHA-256_尺寸.扩展名"，忽略没有被引用的内容的缩略图
+	paths, err = filepath.Glob(filepath.Join(imageFolder, "*_*"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list image folder: %w", err)
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		imageType := filepath.Ext(name)
+		parts := strings.SplitN(strings.TrimSuffix(name, imageType), "_", 2)
+		if len(parts) != 2 || store.blobs[parts[0]] == nil {
+			continue
+		}
+		size, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+		blob := store.blobs[parts[0]]
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot stat image file: %w", err)
+		}
+		blob.variants[size] = &ImageInfo{
+			Type:      imageType,
+			MIMEType:  imageMIMEType(imageType),
+			Path:      fmt.Sprintf("%s/%s", imageFolder, name),
+			Size:      stat.Size(),
+			CreatedAt: stat.ModTime(),
+			Variant:   size,
+		}
+	}
+	return store, nil
 }
 
-func (store *DiskImageStore) Save(laptopID string, imageType string, imageData bytes.Buffer) (string, error) {
-	//1.将图片写入文件中
+// readImageInfo 读取信息文件中的图片信息
+func (store *DiskImageStore) readImageInfo(path string) (*ImageInfo, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image info: %w", err)
+	}
+	record := &diskImageRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image info %s: %w", path, err)
+	}
+	return &ImageInfo{
+		ID:        record.ID,
+		LaptopID:  record.LaptopID,
+		Type:      record.Type,
+		MIMEType:  record.MIMEType,
+		Path:      fmt.Sprintf("%s/%s", store.imageFolder, record.File),
+		Size:      record.Size,
+		CreatedAt: record.CreatedAt,
+		Checksum:  record.Checksum,
+	}, nil
+}
 
+// infoPath 图片信息文件的路径
+func (store *DiskImageStore) infoPath(imageID string) string {
+	return fmt.Sprintf("%s/%s%s", store.imageFolder, imageID, _imageInfoExt)
+}
+
+// writeImageInfo 先写入临时文件再重命名，重启时不会读取到不完整的图片信息
+func (store *DiskImageStore) writeImageInfo(info *ImageInfo) error {
+	data, err := json.Marshal(&diskImageRecord{
+		ID:        info.ID,
+		LaptopID:  info.LaptopID,
+		Type:      info.Type,
+		MIMEType:  info.MIMEType,
+		File:      filepath.Base(info.Path),
+		Size:      info.Size,
+		CreatedAt: info.CreatedAt,
+		Checksum:  info.Checksum,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot encode image info: %w", err)
+	}
+	tempPath, _, _, err := store.writeTempFile(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tempPath, store.infoPath(info.ID))
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("cannot save image info: %w", err)
+	}
+	return nil
+}
+
+func (store *DiskImageStore) Save(laptopID string, imageType string, mimeType string, imageData io.Reader) (string, error) {
 	//先使用uuid随机生成图片id
 	imageID, err := uuid.NewRandom()
 	if err != nil {
 		return "", fmt.Errorf("cannot generate image id: %w", err)
 	}
 
-	imagePath := fmt.Sprintf("%s/%s%s", store.imageFolder, imageID, imageType)
+	//1.将图片写入临时文件，同时计算图片内容的SHA-256
+	tempPath, checksum, imageSize, err := store.writeTempFile(imageData)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempPath)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	//同一个laptop重复上传相同的内容时返回已有的图片
+	for _, info := range store.images {
+		if info.LaptopID == laptopID && info.Checksum == checksum {
+			return info.ID, nil
+		}
+	}
+
+	//2.内容第一次上传时将临时文件重命名为正式文件，已存在时直接丢弃临时文件
+	blob := store.blobs[checksum]
+	newBlob := blob == nil
+	if newBlob {
+		imagePath := fmt.Sprintf("%s/%s%s", store.imageFolder, checksum, imageType)
+		err = os.Rename(tempPath, imagePath)
+		if err != nil {
+			return "", fmt.Errorf("cannot rename image file: %w", err)
+		}
+		blob = &imageBlob{
+			path:     imagePath,
+			variants: make(map[int]*ImageInfo),
+		}
+	}
+
+	//3.保存图片信息文件后再将图片信息存储到map中，保存失败时删除新的文件
+	info := &ImageInfo{
+		ID:        imageID.String(),
+		LaptopID:  laptopID,
+		Type:      imageType,
+		MIMEType:  mimeType,
+		Path:      blob.path,
+		Size:      imageSize,
+		CreatedAt: time.Now(),
+		Checksum:  checksum,
+	}
+	err = store.writeImageInfo(info)
+	if err != nil {
+		if newBlob {
+			os.Remove(blob.path)
+		}
+		return "", err
+	}
+	if newBlob {
+		store.blobs[checksum] = blob
+	}
+	blob.refs++
+	store.images[info.ID] = info
+
+	return info.ID, nil
+}
+
+// writeTempFile 将图片数据写入图片文件夹中的临时文件，返回临时文件路径、内容的SHA-256和字节数，
+// 写入失败时删除临时文件，成功时由调用方重命名或删除
+func (store *DiskImageStore) writeTempFile(imageData io.Reader) (string, string, int64, error) {
+	file, err := ioutil.TempFile(store.imageFolder, "*.tmp")
+	if err != nil {
+		return "", "", 0, fmt.Errorf("cannot create image file: %w", err)
+	}
 
-	file, err := os.Create(imagePath)
+	hash := sha256.New()
+	imageSize, err := io.Copy(io.MultiWriter(file, hash), imageData)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
 	if err != nil {
-		return "", fmt.Errorf("cannot create image file: %w", err)
+		os.Remove(file.Name())
+		return "", "", 0, fmt.Errorf("cannot write image to file: %w", err)
 	}
+	return file.Name(), hex.EncodeToString(hash.Sum(nil)), imageSize, nil
+}
 
-	_, err = imageData.WriteTo(file)
+func (store *DiskImageStore) Open(imageID string) (*ImageInfo, io.ReadCloser, error) {
+	info, err := store.Find(imageID)
 	if err != nil {
-		return "", fmt.Errorf("cannot write image to file: %w", err)
+		return nil, nil, err
 	}
+	if info == nil {
+		return nil, nil, ErrNotFound
+	}
+	return openImageFile(info)
+}
 
-	//2.将图片信息存储到map中
+// openImageFile 打开图片文件，文件不存在时返回ErrNotFound
+func openImageFile(info *ImageInfo) (*ImageInfo, io.ReadCloser, error) {
+	file, err := os.Open(info.Path)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open image file: %w", err)
+	}
+	return info, file, nil
+}
+
+// imageInfo 复制图片信息并填充已生成的缩略图，避免调用方修改存储器中的数据，调用方需要持有锁
+func (store *DiskImageStore) imageInfo(info *ImageInfo) *ImageInfo {
+	other := *info
+	other.Variants = nil
+	for size := range store.blobs[info.Checksum].variants {
+		other.Variants = append(other.Variants, size)
+	}
+	sort.Ints(other.Variants)
+	return &other
+}
+
+func (store *DiskImageStore) Find(imageID string) (*ImageInfo, error) {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
-	store.images[imageID.String()] = &ImageInfo{
-		LaptopID: laptopID,
-		Type:     imageType,
-		Path:     imagePath,
+	info := store.images[imageID]
+	if info == nil {
+		return nil, nil
 	}
+	return store.imageInfo(info), nil
+}
 
-	return imageID.String(), nil
+func (store *DiskImageStore) ListByLaptop(laptopID string) ([]*ImageInfo, error) {
+	store.mutex.RLock()
+	var images []*ImageInfo
+	for _, info := range store.images {
+		if info.LaptopID == laptopID {
+			images = append(images, store.imageInfo(info))
+		}
+	}
+	store.mutex.RUnlock()
+
+	sort.Slice(images, func(i, j int) bool {
+		if !images[i].CreatedAt.Equal(images[j].CreatedAt) {
+			return images[i].CreatedAt.Before(images[j].CreatedAt)
+		}
+		return images[i].ID < images[j].ID
+	})
+	return images, nil
+}
+
+func (store *DiskImageStore) Delete(imageID string) error {
+	//删除文件时也需要持有锁，避免删除同时上传的相同内容
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	info := store.images[imageID]
+	if info == nil {
+		return ErrNotFound
+	}
+	err := os.Remove(store.infoPath(imageID))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove image info: %w", err)
+	}
+	delete(store.images, imageID)
+
+	blob := store.blobs[info.Checksum]
+	blob.refs--
+	if blob.refs > 0 {
+		return nil
+	}
+	delete(store.blobs, info.Checksum)
+
+	paths := []string{blob.path}
+	for _, variant := range blob.variants {
+		paths = append(paths, variant.Path)
+	}
+	for _, path := range paths {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove image file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (store *DiskImageStore) SaveVariant(imageID string, size int, mimeType string, imageData io.Reader) error {
+	tempPath, _, imageSize, err := store.writeTempFile(imageData)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempPath)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	info := store.images[imageID]
+	if info == nil {
+		return ErrNotFound
+	}
+
+	//缩略图与原图保存在同一个文件夹，文件名为"SHA-256_尺寸.扩展名"
+	imageType := imageExtension(mimeType)
+	imagePath := fmt.Sprintf("%s/%s_%d%s", store.imageFolder, info.Checksum, size, imageType)
+	err = os.Rename(tempPath, imagePath)
+	if err != nil {
+		return fmt.Errorf("cannot rename image file: %w", err)
+	}
+
+	store.blobs[info.Checksum].variants[size] = &ImageInfo{
+		Type:      imageType,
+		MIMEType:  mimeType,
+		Path:      imagePath,
+		Size:      imageSize,
+		CreatedAt: time.Now(),
+		Variant:   size,
+	}
+	return nil
+}
+
+func (store *DiskImageStore) OpenVariant(imageID string, size int) (*ImageInfo, io.ReadCloser, error) {
+	store.mutex.RLock()
+	var variant *ImageInfo
+	if info := store.images[imageID]; info != nil {
+		if file := store.blobs[info.Checksum].variants[size]; file != nil {
+			variant = &ImageInfo{
+				ID:        imageID,
+				LaptopID:  info.LaptopID,
+				Type:      file.Type,
+				MIMEType:  file.MIMEType,
+				Path:      file.Path,
+				Size:      file.Size,
+				CreatedAt: file.CreatedAt,
+				Variant:   size,
+			}
+		}
+	}
+	store.mutex.RUnlock()
+	if variant == nil {
+		return nil, nil, ErrNotFound
+	}
+	return openImageFile(variant)
 }
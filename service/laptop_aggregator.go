@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"pcbook/pb"
+	"pcbook/query"
+	"sort"
+)
+
+// _ramBuckets 内存分桶的下限，单位GB
+var _ramBuckets = []uint64{0, 8, 16, 32, 64}
+
+// _priceBuckets 价格分桶的下限
+var _priceBuckets = []float64{0, 1000, 1500, 2000, 2500, 3000}
+
+// LaptopAggregator 统计laptop的分面数量及价格，供LaptopStore实现Aggregate时使用
+type LaptopAggregator struct {
+	count        uint32
+	brands       map[string]uint32
+	cpuBrands    map[string]uint32
+	ramBuckets   []uint32
+	priceBuckets []uint32
+	panels       map[string]uint32
+	minPrice     float64
+	maxPrice     float64
+	sumPrice     float64
+}
+
+func NewLaptopAggregator() *LaptopAggregator {
+	return &LaptopAggregator{
+		brands:       make(map[string]uint32),
+		cpuBrands:    make(map[string]uint32),
+		ramBuckets:   make([]uint32, len(_ramBuckets)),
+		priceBuckets: make([]uint32, len(_priceBuckets)),
+		panels:       make(map[string]uint32),
+	}
+}
+
+// Add 将laptop计入统计
+func (aggregator *LaptopAggregator) Add(laptop *pb.Laptop) {
+	price := laptop.GetPriceUsed()
+	if aggregator.count == 0 || price < aggregator.minPrice {
+		aggregator.minPrice = price
+	}
+	if aggregator.count == 0 || price > aggregator.maxPrice {
+		aggregator.maxPrice = price
+	}
+	aggregator.count++
+	aggregator.sumPrice += price
+
+	aggregator.brands[laptop.GetBrand()]++
+	aggregator.cpuBrands[laptop.GetCpu().GetBrand()]++
+	aggregator.panels[laptop.GetScreen().GetPanel().String()]++
+
+	ramGB := query.MemoryBits(laptop.GetRam()) >> 33
+	for i := len(_ramBuckets) - 1; i >= 0; i-- {
+		if ramGB >= _ramBuckets[i] {
+			aggregator.ramBuckets[i]++
+			break
+		}
+	}
+	for i := len(_priceBuckets) - 1; i >= 0; i-- {
+		if price >= _priceBuckets[i] {
+			aggregator.priceBuckets[i]++
+			break
+		}
+	}
+}
+
+// Result 返回统计结果，分面按数量降序排列，分桶按区间升序排列，数量为0的分桶不返回
+func (aggregator *LaptopAggregator) Result() *pb.LaptopAggregation {
+	result := &pb.LaptopAggregation{
+		TotalCount:   aggregator.count,
+		Brands:       facetCounts(aggregator.brands),
+		CpuBrands:    facetCounts(aggregator.cpuBrands),
+		ScreenPanels: facetCounts(aggregator.panels),
+		MinPrice:     aggregator.minPrice,
+		MaxPrice:     aggregator.maxPrice,
+	}
+	if aggregator.count > 0 {
+		result.AvgPrice = aggregator.sumPrice / float64(aggregator.count)
+	}
+
+	for i, count := range aggregator.ramBuckets {
+		if count == 0 {
+			continue
+		}
+		value := fmt.Sprintf("%dGB+", _ramBuckets[i])
+		if i+1 < len(_ramBuckets) {
+			value = fmt.Sprintf("%d-%dGB", _ramBuckets[i], _ramBuckets[i+1])
+		}
+		result.RamBuckets = append(result.RamBuckets, &pb.FacetCount{Value: value, Count: count})
+	}
+	for i, count := range aggregator.priceBuckets {
+		if count == 0 {
+			continue
+		}
+		value := fmt.Sprintf("%g+", _priceBuckets[i])
+		if i+1 < len(_priceBuckets) {
+			value = fmt.Sprintf("%g-%g", _priceBuckets[i], _priceBuckets[i+1])
+		}
+		result.PriceBuckets = append(result.PriceBuckets, &pb.FacetCount{Value: value, Count: count})
+	}
+	return result
+}
+
+// facetCounts 将map转换为按数量降序排列的分面列表，数量相同时按值升序
+func facetCounts(counts map[string]uint32) []*pb.FacetCount {
+	facets := make([]*pb.FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facets = append(facets, &pb.FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	return facets
+}
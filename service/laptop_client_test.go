@@ -2,21 +2,43 @@ package service
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"image"
+	"image/png"
 	"io"
+	"io/ioutil"
+	"math"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"pcbook/pb"
 	"pcbook/sample"
 	"pcbook/serializer"
+	"pcbook/service/s3test"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+var _testJWTManager = NewJWTManager("secret", time.Minute)
+
 func TestLaptopClient_CreateLaptop(t *testing.T) {
 	t.Parallel()
 
@@ -44,10 +66,189 @@ func TestLaptopClient_CreateLaptop(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, other)
 
+	//update_at和revision由服务端设置
+	require.EqualValues(t, 1, other.GetRevision())
+	require.NotNil(t, other.GetUpdateAt())
+	laptop.UpdateAt = other.UpdateAt
+	laptop.Revision = other.Revision
+
 	//验证两个laptop是否相等
 	requireSameLaptop(t, laptop, other)
 }
 
+func TestLaptopClient_GetLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	expected, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+
+	res, err := laptopClient.GetLaptop(context.Background(), &pb.GetLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+	requireSameLaptop(t, expected, res.GetLaptop())
+
+	//不存在的id返回NotFound
+	_, err = laptopClient.GetLaptop(context.Background(), &pb.GetLaptopRequest{Id: sample.NewLaptop().Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestLaptopClient_UpdateLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	laptop.Name = "updated name"
+	laptop.PriceUsed = 1999
+	res, err := laptopClient.UpdateLaptop(context.Background(), &pb.UpdateLaptopRequest{Laptop: laptop})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, res.GetLaptop().GetRevision())
+	laptop.UpdateAt = res.GetLaptop().GetUpdateAt()
+	laptop.Revision = 2
+	requireSameLaptop(t, laptop, res.GetLaptop())
+
+	//验证存储器中的laptop已被更新
+	other, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	requireSameLaptop(t, laptop, other)
+
+	//不存在的id返回NotFound
+	_, err = laptopClient.UpdateLaptop(context.Background(), &pb.UpdateLaptopRequest{Laptop: sample.NewLaptop()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestLaptopClient_UpdateLaptopWithFieldMask(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	laptop.Weight = &pb.Laptop_WeightKg{WeightKg: 2}
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	//请求中除了mask指定的字段外，其他字段都与存储的不同
+	patch := sample.NewLaptop()
+	patch.Id = laptop.Id
+	patch.PriceUsed = 1234.5
+	patch.Cpu.MaxGhz = 4.8
+	patch.Weight = &pb.Laptop_WeightLb{WeightLb: 4.4}
+	patch.Storages = []*pb.Storage{sample.NewSSD()}
+
+	req := &pb.UpdateLaptopRequest{
+		Laptop:     patch,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price_used", "cpu.max_ghz", "weight", "storages"}},
+	}
+	res, err := laptopClient.UpdateLaptop(context.Background(), req)
+	require.NoError(t, err)
+
+	expected := proto.Clone(laptop).(*pb.Laptop)
+	expected.UpdateAt = res.GetLaptop().GetUpdateAt()
+	expected.Revision = 2
+	expected.PriceUsed = patch.PriceUsed
+	expected.Cpu.MaxGhz = patch.Cpu.MaxGhz
+	expected.Weight = &pb.Laptop_WeightLb{WeightLb: 4.4}
+	expected.Storages = patch.Storages
+	requireSameLaptop(t, expected, res.GetLaptop())
+
+	other, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	requireSameLaptop(t, expected, other)
+
+	//不存在的路径返回InvalidArgument，且不影响已存储的数据
+	for _, path := range []string{"unknown", "cpu.unknown", "gpus.memory", "price_used.value"} {
+		req.UpdateMask = &fieldmaskpb.FieldMask{Paths: []string{"name", path}}
+		_, err = laptopClient.UpdateLaptop(context.Background(), req)
+		require.Equal(t, codes.InvalidArgument, status.Code(err), path)
+	}
+	other, err = laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	requireSameLaptop(t, expected, other)
+}
+
+func TestLaptopClient_UpdateLaptopWithRevision(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	//两个管理员同时基于revision 1修改价格
+	stored, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, stored.GetRevision())
+
+	req := &pb.UpdateLaptopRequest{
+		Laptop:           &pb.Laptop{Id: laptop.Id, PriceUsed: 1800},
+		UpdateMask:       &fieldmaskpb.FieldMask{Paths: []string{"price_used"}},
+		ExpectedRevision: stored.GetRevision(),
+	}
+	res, err := laptopClient.UpdateLaptop(context.Background(), req)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, res.GetLaptop().GetRevision())
+	require.False(t, res.GetLaptop().GetUpdateAt().AsTime().Before(stored.GetUpdateAt().AsTime()))
+
+	//第二个管理员使用过期的revision，返回Aborted
+	req.Laptop.PriceUsed = 1700
+	_, err = laptopClient.UpdateLaptop(context.Background(), req)
+	require.Equal(t, codes.Aborted, status.Code(err))
+
+	other, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Equal(t, 1800.0, other.GetPriceUsed())
+	require.EqualValues(t, 2, other.GetRevision())
+
+	//使用最新的revision可以更新成功
+	req.ExpectedRevision = other.GetRevision()
+	res, err = laptopClient.UpdateLaptop(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, 1700.0, res.GetLaptop().GetPriceUsed())
+	require.EqualValues(t, 3, res.GetLaptop().GetRevision())
+}
+
+func TestLaptopClient_DeleteLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	res, err := laptopClient.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+	require.Equal(t, laptop.Id, res.GetId())
+
+	//验证存储器中的laptop已被删除
+	other, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, other)
+
+	//重复删除返回NotFound
+	_, err = laptopClient.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
 func TestLaptopClient_SearchLaptop(t *testing.T) {
 	t.Parallel()
 
@@ -112,6 +313,344 @@ func TestLaptopClient_SearchLaptop(t *testing.T) {
 	require.Equal(t, len(expectedIDs), count)
 }
 
+func TestLaptopClient_SearchLaptopSorted(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	rateStore := NewInMemoryRateStore()
+	prices := []float64{2500, 1500, 2000, 1000, 3000}
+	scores := []float64{6, 9, 7, 8, 10}
+	ids := make([]string, len(prices))
+	for i, price := range prices {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsed = price
+		err := laptopStore.Save(laptop)
+		require.NoError(t, err)
+		_, err = rateStore.Rate("user1", laptop.Id, scores[i])
+		require.NoError(t, err)
+		ids[i] = laptop.Id
+	}
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, rateStore)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	search := func(req *pb.SearchLaptopRequest) []string {
+		stream, err := laptopClient.SearchLaptop(context.Background(), req)
+		require.NoError(t, err)
+		var result []string
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return result
+			}
+			require.NoError(t, err)
+			result = append(result, res.GetLaptop().GetId())
+		}
+	}
+
+	//价格最低的前3个
+	result := search(&pb.SearchLaptopRequest{
+		Filter:     &pb.Filter{MaxPriceUsed: 3000},
+		SortBy:     []*pb.SortBy{{Field: pb.SortBy_PRICE}},
+		MaxResults: 3,
+	})
+	require.Equal(t, []string{ids[3], ids[1], ids[2]}, result)
+
+	//评分最高的排在前面
+	result = search(&pb.SearchLaptopRequest{
+		Filter: &pb.Filter{MaxPriceUsed: 3000},
+		SortBy: []*pb.SortBy{{Field: pb.SortBy_RATING, Descending: true}},
+	})
+	require.Equal(t, []string{ids[4], ids[1], ids[3], ids[2], ids[0]}, result)
+
+	//不排序时也限制数量
+	result = search(&pb.SearchLaptopRequest{
+		Filter:     &pb.Filter{MaxPriceUsed: 3000},
+		MaxResults: 2,
+	})
+	require.Len(t, result, 2)
+
+	//不支持的排序字段
+	stream, err := laptopClient.SearchLaptop(context.Background(), &pb.SearchLaptopRequest{
+		SortBy: []*pb.SortBy{{Field: pb.SortBy_UNKNOWN}},
+	})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestLaptopClient_SearchLaptopByQuery(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	expectedIDs := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		laptop := sample.NewLaptop()
+		laptop.Brand = "Dell"
+		laptop.PriceUsed = 2500
+		switch i {
+		case 0:
+			laptop.Brand = "Apple"
+			laptop.PriceUsed = 1800
+			expectedIDs[laptop.Id] = true
+		case 1:
+			laptop.PriceUsed = 1500
+			expectedIDs[laptop.Id] = true
+		case 2:
+			laptop.Brand = "Apple"
+		}
+		err := laptopStore.Save(laptop)
+		require.NoError(t, err)
+	}
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	stream, err := laptopClient.SearchLaptop(context.Background(), &pb.SearchLaptopRequest{
+		Query: "(brand:Apple OR brand:Dell) price<2000",
+	})
+	require.NoError(t, err)
+	count := 0
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Contains(t, expectedIDs, res.GetLaptop().GetId())
+		count++
+	}
+	require.Equal(t, len(expectedIDs), count)
+
+	//语法错误返回InvalidArgument，并包含出错位置
+	stream, err = laptopClient.SearchLaptop(context.Background(), &pb.SearchLaptopRequest{
+		Query: "brand:Apple price<cheap",
+	})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Contains(t, status.Convert(err).Message(), "position 19")
+
+	//filter和query不能同时使用
+	stream, err = laptopClient.SearchLaptop(context.Background(), &pb.SearchLaptopRequest{
+		Filter: &pb.Filter{MaxPriceUsed: 3000},
+		Query:  "brand:Apple",
+	})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestLaptopClient_AggregateLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	laptops := []struct {
+		brand    string
+		cpuBrand string
+		ramGB    uint64
+		price    float64
+		panel    pb.Screen_Panel
+	}{
+		{"Apple", "Intel", 16, 2400, pb.Screen_IPS},
+		{"Apple", "Intel", 8, 1900, pb.Screen_OLED},
+		{"Dell", "AMD", 32, 1200, pb.Screen_IPS},
+		{"Lenovo", "Intel", 64, 2900, pb.Screen_IPS},
+		{"Dell", "Intel", 4, 3500, pb.Screen_OLED}, //价格超出filter
+	}
+	for _, item := range laptops {
+		laptop := sample.NewLaptop()
+		laptop.Brand = item.brand
+		laptop.Cpu.Brand = item.cpuBrand
+		laptop.Ram = &pb.Memory{Value: item.ramGB, Unit: pb.Memory_GIGABYTE}
+		laptop.PriceUsed = item.price
+		laptop.Screen.Panel = item.panel
+		err := laptopStore.Save(laptop)
+		require.NoError(t, err)
+	}
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	res, err := laptopClient.AggregateLaptops(context.Background(), &pb.AggregateLaptopsRequest{
+		Filter: &pb.Filter{MaxPriceUsed: 3000},
+	})
+	require.NoError(t, err)
+
+	aggregation := res.GetAggregation()
+	facets := func(values ...interface{}) []*pb.FacetCount {
+		var result []*pb.FacetCount
+		for i := 0; i < len(values); i += 2 {
+			result = append(result, &pb.FacetCount{Value: values[i].(string), Count: uint32(values[i+1].(int))})
+		}
+		return result
+	}
+	require.EqualValues(t, 4, aggregation.GetTotalCount())
+	require.True(t, proto.Equal(&pb.LaptopAggregation{
+		TotalCount:   4,
+		Brands:       facets("Apple", 2, "Dell", 1, "Lenovo", 1),
+		CpuBrands:    facets("Intel", 3, "AMD", 1),
+		RamBuckets:   facets("8-16GB", 1, "16-32GB", 1, "32-64GB", 1, "64GB+", 1),
+		PriceBuckets: facets("1000-1500", 1, "1500-2000", 1, "2000-2500", 1, "2500-3000", 1),
+		ScreenPanels: facets("IPS", 3, "OLED", 1),
+		MinPrice:     1200,
+		MaxPrice:     2900,
+		AvgPrice:     2100,
+	}, aggregation), aggregation.String())
+}
+
+func TestLaptopClient_ListLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	for i := 0; i < 7; i++ {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsed = float64(1000 + i*100)
+		err := laptopStore.Save(laptop)
+		require.NoError(t, err)
+	}
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	req := &pb.ListLaptopsRequest{
+		PageSize: 3,
+		OrderBy:  "price_used desc",
+	}
+	var prices []float64
+	for page := 0; ; page++ {
+		res, err := laptopClient.ListLaptops(context.Background(), req)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(res.GetLaptops()), 3)
+		for _, laptop := range res.GetLaptops() {
+			prices = append(prices, laptop.GetPriceUsed())
+		}
+
+		if page == 0 {
+			//翻页过程中插入新数据，排在游标之前的不会出现，之后的会出现，已返回的数据不会重复
+			before := sample.NewLaptop()
+			before.PriceUsed = 9000
+			require.NoError(t, laptopStore.Save(before))
+			after := sample.NewLaptop()
+			after.PriceUsed = 500
+			require.NoError(t, laptopStore.Save(after))
+		}
+
+		if res.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = res.GetNextPageToken()
+	}
+	require.Equal(t, []float64{1600, 1500, 1400, 1300, 1200, 1100, 1000, 500}, prices)
+
+	//翻页时修改排序规则
+	res, err := laptopClient.ListLaptops(context.Background(), &pb.ListLaptopsRequest{PageSize: 1})
+	require.NoError(t, err)
+	require.NotEmpty(t, res.GetNextPageToken())
+	_, err = laptopClient.ListLaptops(context.Background(), &pb.ListLaptopsRequest{
+		PageToken: res.GetNextPageToken(),
+		OrderBy:   "price_used",
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	//不合法的参数
+	invalidReqs := []*pb.ListLaptopsRequest{
+		{PageSize: -1},
+		{OrderBy: "unknown"},
+		{OrderBy: "price_used up"},
+		{PageToken: "not-a-token"},
+	}
+	for _, req := range invalidReqs {
+		_, err := laptopClient.ListLaptops(context.Background(), req)
+		require.Equal(t, codes.InvalidArgument, status.Code(err), req.String())
+	}
+}
+
+func TestLaptopClient_WatchLaptops(t *testing.T) {
+	t.Parallel()
+
+	//变更日志只保存最近4个事件
+	eventBus := NewLaptopEventBus(4)
+	laptopStore := NewEventLaptopStore(NewInMemoryLaptopStore(), eventBus)
+	serverAddr := serveTestLaptopServer(t, NewLaptopServer(laptopStore, nil, nil, nil, eventBus))
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	filter := &pb.Filter{MaxPriceUsed: 2000}
+	stream, err := laptopClient.WatchLaptops(ctx, &pb.WatchLaptopsRequest{Filter: filter})
+	require.NoError(t, err)
+	//等待服务端完成订阅，避免错过之后的事件
+	require.Eventually(t, func() bool {
+		eventBus.mutex.Lock()
+		defer eventBus.mutex.Unlock()
+		return len(eventBus.subscribers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	cheap := sample.NewLaptop()
+	cheap.PriceUsed = 1500
+	expensive := sample.NewLaptop()
+	expensive.PriceUsed = 2500
+	require.NoError(t, laptopStore.Save(cheap))
+	require.NoError(t, laptopStore.Save(expensive))
+
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"price_used"}}
+	_, err = laptopStore.Update(&pb.Laptop{Id: cheap.Id, PriceUsed: 1800}, mask, 0)
+	require.NoError(t, err)
+	//价格超出filter范围的更新也需要通知，客户端才能知道laptop已不再符合条件
+	_, err = laptopStore.Update(&pb.Laptop{Id: cheap.Id, PriceUsed: 2600}, mask, 0)
+	require.NoError(t, err)
+	require.NoError(t, laptopStore.Delete(expensive.Id))
+
+	expected := []struct {
+		eventType pb.LaptopEvent_Type
+		price     float64
+	}{
+		{pb.LaptopEvent_CREATED, 1500},
+		{pb.LaptopEvent_UPDATED, 1800},
+		{pb.LaptopEvent_UPDATED, 2600},
+	}
+	var events []*pb.LaptopEvent
+	for _, e := range expected {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		event := res.GetEvent()
+		require.Equal(t, e.eventType, event.GetType())
+		require.Equal(t, cheap.Id, event.GetLaptop().GetId())
+		require.Equal(t, e.price, event.GetLaptop().GetPriceUsed())
+		require.NotEmpty(t, event.GetResumeToken())
+		events = append(events, event)
+	}
+	cancel()
+
+	//使用第一个事件的token重新订阅，补发之后错过的事件
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	req := &pb.WatchLaptopsRequest{Filter: filter, ResumeToken: events[0].GetResumeToken()}
+	stream, err = laptopClient.WatchLaptops(ctx, req)
+	require.NoError(t, err)
+	for _, event := range events[1:] {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.True(t, proto.Equal(event, res.GetEvent()))
+	}
+	cancel()
+
+	//token之后的事件已被移出变更日志
+	require.NoError(t, laptopStore.Save(sample.NewLaptop()))
+	stream, err = laptopClient.WatchLaptops(context.Background(), req)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+
+	//无效的token
+	req.ResumeToken = "invalid"
+	stream, err = laptopClient.WatchLaptops(context.Background(), req)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
 func TestLaptopClient_UploadImage(t *testing.T) {
 	t.Parallel()
 
@@ -119,7 +658,7 @@ func TestLaptopClient_UploadImage(t *testing.T) {
 
 	//新建存储器
 	laptopStore := NewInMemoryLaptopStore()
-	imageStore := NewDiskImageStore(testImageFolder)
+	imageStore := openTestDiskImageStore(t, testImageFolder)
 
 	//存储一个laptop
 	laptop := sample.NewLaptop()
@@ -177,66 +716,901 @@ func TestLaptopClient_UploadImage(t *testing.T) {
 	res, err := stream.CloseAndRecv()
 	require.NoError(t, err)
 	require.NotEmpty(t, res.GetId())
-	//qual必须二者类型和值都相等，才符合;EqualValues，值相等即符合;
-	require.EqualValues(t, size, res.GetSize())
+	imageData, err := ioutil.ReadFile(imagePath)
+	require.NoError(t, err)
+	require.Equal(t, size, len(imageData))
+	sum := sha256.Sum256(imageData)
+	require.Equal(t, hex.EncodeToString(sum[:]), res.GetReceivedChecksum())
 
-	targetImagePath := fmt.Sprintf("%s/%s%s", testImageFolder, res.GetId(), imageExt)
+	//图片文件以去除元数据后的内容的SHA-256命名，响应中的大小和checksum与保存的内容一致
+	info, err := imageStore.Find(res.GetId())
+	require.NoError(t, err)
+	//qual必须二者类型和值都相等，才符合;EqualValues，值相等即符合;
+	require.EqualValues(t, info.Size, res.GetSize())
+	require.Equal(t, info.Checksum, res.GetChecksum())
+	require.NotEqual(t, res.GetReceivedChecksum(), res.GetChecksum())
+	targetImagePath := fmt.Sprintf("%s/%s%s", testImageFolder, info.Checksum, imageExt)
+	require.Equal(t, targetImagePath, info.Path)
 	require.FileExists(t, targetImagePath)
 
-	//删除测试图片
-	err = os.Remove(targetImagePath)
+	//删除测试图片及图片信息文件
+	err = imageStore.Delete(res.GetId())
 	require.NoError(t, err)
+	require.NoFileExists(t, targetImagePath)
 }
 
-func TestLaptopClient_RateLaptop(t *testing.T) {
+func TestLaptopClient_UploadImageValidation(t *testing.T) {
 	t.Parallel()
 
-	//新建存储器
 	laptopStore := NewInMemoryLaptopStore()
-	rateStore := NewInMemoryRateStore()
-
-	//存储一个laptop
+	imageStore := openTestDiskImageStore(t, t.TempDir())
 	laptop := sample.NewLaptop()
-	err := laptopStore.Save(laptop)
-	require.NoError(t, err)
+	require.NoError(t, laptopStore.Save(laptop))
 
-	//开启服务器和客户端
-	serverAddr := startTestLaptopServer(t, laptopStore, nil, rateStore)
+	serverAddr := startTestLaptopServer(t, laptopStore, imageStore, nil)
 	laptopClient := newTestLaptopClient(t, serverAddr)
 
-	stream, err := laptopClient.RateLaptop(context.Background())
+	//扩展名与内容不一致或不是图片时拒绝上传
+	imageData, err := ioutil.ReadFile("../tmp/laptop.png")
+	require.NoError(t, err)
+	_, err = uploadTestImage(t, laptopClient, laptop.Id, ".png", []byte("PK\x03\x04 not an image"))
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = uploadTestImage(t, laptopClient, laptop.Id, ".jpg", imageData)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = uploadTestImage(t, laptopClient, laptop.Id, "/../../laptop.png", imageData)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	images, err := imageStore.ListByLaptop(laptop.Id)
 	require.NoError(t, err)
+	require.Empty(t, images)
 
-	//三次提交的分数
-	scores := []float64{8, 7.5, 10}
-	//预期每次提交后的平均得分
-	averages := []float64{8, 7.75, 8.5}
+	//保存的图片去除了EXIF
+	res, err := uploadTestImage(t, laptopClient, laptop.Id, ".PNG", imageData)
+	require.NoError(t, err)
+	info, reader, err := imageStore.Open(res.GetId())
+	require.NoError(t, err)
+	defer reader.Close()
+	stored, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, ".png", info.Type)
+	require.Equal(t, "image/png", info.MIMEType)
+	require.Contains(t, string(imageData), "eXIf")
+	require.NotContains(t, string(stored), "eXIf")
+	require.EqualValues(t, len(stored), info.Size)
+}
 
-	for _, score := range scores {
-		req := &pb.RateLaptopRequest{
-			LaptopId: laptop.GetId(),
-			Score:    score,
-		}
-		err := stream.Send(req)
-		require.NoError(t, err)
-	}
+func TestLaptopClient_UploadLargeImage(t *testing.T) {
+	t.Parallel()
 
-	for i, avg := range averages {
-		res, err := stream.Recv()
-		require.NoError(t, err)
-		require.Equal(t, laptop.GetId(), res.GetLaptopId())
-		require.EqualValues(t, i+1, res.GetRatedCount())
-		require.Equal(t, avg, res.GetAverageScore())
+	laptopStore := NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := openTestDiskImageStore(t, imageFolder)
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	//随机像素的图片几乎无法压缩，大于默认的最大字节数
+	img := image.NewRGBA(image.Rect(0, 0, 800, 800))
+	_, err := rand.Read(img.Pix)
+	require.NoError(t, err)
+	var buffer bytes.Buffer
+	require.NoError(t, png.Encode(&buffer, img))
+	imageData := buffer.Bytes()
+	require.Greater(t, len(imageData), DefaultMaxImageSize)
+
+	laptopServer := NewLaptopServer(laptopStore, imageStore, nil, nil, nil)
+	laptopServer.MaxImageSize = int64(len(imageData))
+	serverAddr := serveTestLaptopServer(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	_, err = uploadTestImage(t, laptopClient, laptop.Id, ".png", append(imageData, 0))
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	//图片数据不完整时在保存过程中才会发现，不会留下临时文件
+	_, err = uploadTestImage(t, laptopClient, laptop.Id, ".png", imageData[:len(imageData)-100])
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	files, err := ioutil.ReadDir(imageFolder)
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	res, err := uploadTestImage(t, laptopClient, laptop.Id, ".png", imageData)
+	require.NoError(t, err)
+	require.EqualValues(t, len(imageData), res.GetSize())
+	info, reader, err := imageStore.Open(res.GetId())
+	require.NoError(t, err)
+	defer reader.Close()
+	stored, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, imageData, stored)
+	require.EqualValues(t, len(imageData), info.Size)
+	//图片文件和图片信息文件
+	files, err = ioutil.ReadDir(imageFolder)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+}
+
+func TestLaptopClient_UploadImageDeduplication(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := openTestDiskImageStore(t, imageFolder)
+	laptop1 := sample.NewLaptop()
+	laptop2 := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop1))
+	require.NoError(t, laptopStore.Save(laptop2))
+
+	laptopServer := NewLaptopServer(laptopStore, imageStore, nil, nil, nil)
+	serverAddr := serveTestLaptopServer(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	imageData, err := ioutil.ReadFile("../tmp/laptop.png")
+	require.NoError(t, err)
+	sum := sha256.Sum256(imageData)
+	checksum := hex.EncodeToString(sum[:])
+
+	//checksum与接收的内容不一致时拒绝上传
+	corrupted := append([]byte{}, imageData...)
+	corrupted[len(corrupted)/2] ^= 0xFF
+	_, err = uploadTestImageInfo(t, laptopClient, &pb.ImageInfo{LaptopId: laptop1.Id, ImageType: ".png", Checksum: checksum}, corrupted)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	//相同的内容只保存一个文件，同一个laptop重复上传时返回已有的图片
+	res1, err := uploadTestImageInfo(t, laptopClient, &pb.ImageInfo{LaptopId: laptop1.Id, ImageType: ".png", Checksum: strings.ToUpper(checksum)}, imageData)
+	require.NoError(t, err)
+	require.Equal(t, checksum, res1.GetReceivedChecksum())
+	res2, err := uploadTestImage(t, laptopClient, laptop1.Id, ".png", imageData)
+	require.NoError(t, err)
+	require.Equal(t, res1.GetId(), res2.GetId())
+	res3, err := uploadTestImage(t, laptopClient, laptop2.Id, ".png", imageData)
+	require.NoError(t, err)
+	require.NotEqual(t, res1.GetId(), res3.GetId())
+	//不统计图片信息文件
+	requireImageFiles := func(count int) {
+		files, err := filepath.Glob(filepath.Join(imageFolder, "*.png"))
+		require.NoError(t, err)
+		require.Len(t, files, count)
+	}
+	requireImageFiles(1)
+
+	//所有引用的图片都删除后才删除文件
+	ctx := testRoleContext(t, "admin1", "admin")
+	_, err = laptopClient.DeleteImage(ctx, &pb.DeleteImageRequest{LaptopId: laptop1.Id, ImageId: res1.GetId()})
+	require.NoError(t, err)
+	requireImageFiles(1)
+	stream, err := laptopClient.DownloadImage(context.Background(), &pb.DownloadImageRequest{LaptopId: laptop2.Id, ImageId: res3.GetId()})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	var downloaded []byte
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		downloaded = append(downloaded, res.GetChunkData()...)
+	}
+	//下载时的checksum与上传响应中的一致
+	storedSum := sha256.Sum256(downloaded)
+	require.Equal(t, hex.EncodeToString(storedSum[:]), res.GetInfo().GetChecksum())
+	require.Equal(t, res3.GetChecksum(), res.GetInfo().GetChecksum())
+
+	_, err = laptopClient.DeleteImage(ctx, &pb.DeleteImageRequest{LaptopId: laptop2.Id, ImageId: res3.GetId()})
+	require.NoError(t, err)
+	requireImageFiles(0)
+	files, err := ioutil.ReadDir(imageFolder)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestLaptopClient_ResumableUpload(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	imageStore := openTestDiskImageStore(t, t.TempDir())
+	uploadStore, err := OpenDiskUploadStore(t.TempDir(), time.Hour, 0)
+	require.NoError(t, err)
+	defer uploadStore.Close()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := NewLaptopServer(laptopStore, imageStore, nil, nil, nil)
+	laptopServer.UploadStore = uploadStore
+	serverAddr := serveTestLaptopServer(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	imageData, err := ioutil.ReadFile("../tmp/laptop.png")
+	require.NoError(t, err)
+	sum := sha256.Sum256(imageData)
+	checksum := hex.EncodeToString(sum[:])
+
+	_, err = laptopClient.CreateImageUpload(context.Background(), &pb.CreateImageUploadRequest{
+		Info: &pb.ImageInfo{LaptopId: sample.NewLaptop().Id, ImageType: ".png"},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	upload, err := laptopClient.CreateImageUpload(context.Background(), &pb.CreateImageUploadRequest{
+		Info: &pb.ImageInfo{LaptopId: laptop.Id, ImageType: ".png", Checksum: checksum},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, upload.GetUploadId())
+	require.Zero(t, upload.GetOffset())
+
+	//第一次只上传一半数据后中断，查询已接收的字节数后继续上传
+	half := uint64(len(imageData) / 2)
+	res, err := uploadTestChunks(t, laptopClient, upload.GetUploadId(), imageData[:half], 0)
+	require.NoError(t, err)
+	require.Equal(t, half, res.GetOffset())
+	upload, err = laptopClient.GetImageUpload(context.Background(), &pb.GetImageUploadRequest{UploadId: upload.GetUploadId()})
+	require.NoError(t, err)
+	require.Equal(t, half, upload.GetOffset())
+
+	//未完整上传时校验失败，上传会话保留
+	_, err = laptopClient.FinishImageUpload(context.Background(), &pb.FinishImageUploadRequest{UploadId: upload.GetUploadId()})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	//起始位置与已接收的字节数不一致时拒绝，已接收的数据不变
+	_, err = uploadTestChunks(t, laptopClient, upload.GetUploadId(), imageData, 0)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = uploadTestChunks(t, laptopClient, "missing", imageData, 0)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	res, err = uploadTestChunks(t, laptopClient, upload.GetUploadId(), imageData, half)
+	require.NoError(t, err)
+	require.EqualValues(t, len(imageData), res.GetOffset())
+
+	finished, err := laptopClient.FinishImageUpload(context.Background(), &pb.FinishImageUploadRequest{UploadId: upload.GetUploadId()})
+	require.NoError(t, err)
+	require.Equal(t, checksum, finished.GetReceivedChecksum())
+	info, err := imageStore.Find(finished.GetId())
+	require.NoError(t, err)
+	require.Equal(t, info.Checksum, finished.GetChecksum())
+	require.EqualValues(t, info.Size, finished.GetSize())
+	require.Equal(t, laptop.Id, info.LaptopID)
+	require.Equal(t, "image/png", info.MIMEType)
+
+	//完成上传后删除上传会话
+	_, err = laptopClient.GetImageUpload(context.Background(), &pb.GetImageUploadRequest{UploadId: upload.GetUploadId()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = laptopClient.FinishImageUpload(context.Background(), &pb.FinishImageUploadRequest{UploadId: upload.GetUploadId()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// uploadTestChunks 从offset开始分chunk上传data剩余的数据
+func uploadTestChunks(t *testing.T, laptopClient pb.LaptopServiceClient, uploadID string, data []byte, offset uint64) (*pb.ImageUpload, error) {
+	stream, err := laptopClient.UploadImageChunks(context.Background())
+	require.NoError(t, err)
+	for offset < uint64(len(data)) {
+		end := offset + 1024
+		if end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		err = stream.Send(&pb.UploadImageChunkRequest{UploadId: uploadID, Offset: offset, ChunkData: data[offset:end]})
+		if err != nil {
+			break
+		}
+		offset = end
+	}
+	return stream.CloseAndRecv()
+}
+
+// uploadTestImage 分chunk上传图片数据
+func uploadTestImage(t *testing.T, laptopClient pb.LaptopServiceClient, laptopID, imageType string, data []byte) (*pb.UploadImageResponse, error) {
+	return uploadTestImageInfo(t, laptopClient, &pb.ImageInfo{LaptopId: laptopID, ImageType: imageType}, data)
+}
+
+// uploadTestImageInfo 发送图片信息后分chunk上传图片数据
+func uploadTestImageInfo(t *testing.T, laptopClient pb.LaptopServiceClient, info *pb.ImageInfo, data []byte) (*pb.UploadImageResponse, error) {
+	stream, err := laptopClient.UploadImage(context.Background())
+	require.NoError(t, err)
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{Info: info},
+	})
+	require.NoError(t, err)
+	for len(data) > 0 {
+		n := 1024
+		if n > len(data) {
+			n = len(data)
+		}
+		err = stream.Send(&pb.UploadImageRequest{
+			Data: &pb.UploadImageRequest_ChunkData{ChunkData: data[:n]},
+		})
+		if err != nil {
+			break
+		}
+		data = data[n:]
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestLaptopClient_DownloadImage(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	imageStore := openTestDiskImageStore(t, t.TempDir())
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	imageData, err := ioutil.ReadFile("../tmp/laptop.png")
+	require.NoError(t, err)
+	imageID, err := imageStore.Save(laptop.Id, ".png", "image/png", bytes.NewReader(imageData))
+	require.NoError(t, err)
+
+	laptopServer := NewLaptopServer(laptopStore, imageStore, nil, nil, nil)
+	serverAddr := serveTestLaptopServer(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	//第一条消息为图片信息，之后的chunk拼接后与原图片相同
+	stream, err := laptopClient.DownloadImage(context.Background(), &pb.DownloadImageRequest{LaptopId: laptop.Id, ImageId: imageID})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, laptop.Id, res.GetInfo().GetLaptopId())
+	require.Equal(t, ".png", res.GetInfo().GetImageType())
+	require.EqualValues(t, len(imageData), res.GetInfo().GetSize())
+	var downloaded []byte
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Nil(t, res.GetInfo())
+		downloaded = append(downloaded, res.GetChunkData()...)
+	}
+	require.Equal(t, imageData, downloaded)
+
+	//图片不存在或不属于该laptop
+	for _, req := range []*pb.DownloadImageRequest{
+		{LaptopId: laptop.Id, ImageId: "missing"},
+		{LaptopId: sample.NewLaptop().Id, ImageId: imageID},
+	} {
+		stream, err := laptopClient.DownloadImage(context.Background(), req)
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.NotFound, status.Code(err))
+	}
+
+	//REST接口直接返回图片内容
+	mux := runtime.NewServeMux()
+	err = pb.RegisterLaptopServiceHandlerServer(context.Background(), mux, laptopServer)
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/laptop/"+laptop.Id+"/images/"+imageID, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "image/png", recorder.Header().Get("Content-Type"))
+	require.Equal(t, imageData, recorder.Body.Bytes())
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/laptop/"+laptop.Id+"/images/missing", nil))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestLaptopClient_DownloadImageVariant(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	imageStore := openTestDiskImageStore(t, t.TempDir())
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	imageData := encodeTestImage(t, "png", 600, 300)
+	imageID, err := imageStore.Save(laptop.Id, ".png", "image/png", bytes.NewReader(imageData))
+	require.NoError(t, err)
+	resizer := NewImageResizer(imageStore, 1, 1)
+	require.True(t, resizer.Submit(imageID))
+	resizer.Close()
+
+	laptopServer := NewLaptopServer(laptopStore, imageStore, nil, nil, nil)
+	serverAddr := serveTestLaptopServer(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	testCases := []struct {
+		name        string //用例的名称
+		size        uint32 //请求的缩略图尺寸
+		variantSize uint32 //返回的缩略图尺寸，原图为0
+		code        codes.Code
+	}{
+		{name: "original", size: 0, variantSize: 0, code: codes.OK},
+		{name: "thumbnail", size: 128, variantSize: 128, code: codes.OK},
+		{name: "larger_than_original", size: 1024, variantSize: 0, code: codes.OK},
+		{name: "unsupported_size", size: 100, code: codes.InvalidArgument},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req := &pb.DownloadImageRequest{LaptopId: laptop.Id, ImageId: imageID, Size: tc.size}
+			stream, err := laptopClient.DownloadImage(context.Background(), req)
+			require.NoError(t, err)
+			res, err := stream.Recv()
+			if tc.code != codes.OK {
+				require.Equal(t, tc.code, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.variantSize, res.GetInfo().GetVariantSize())
+			require.Equal(t, "image/png", res.GetInfo().GetMimeType())
+
+			var downloaded []byte
+			for {
+				res, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				downloaded = append(downloaded, res.GetChunkData()...)
+			}
+			config, _, err := image.DecodeConfig(bytes.NewReader(downloaded))
+			require.NoError(t, err)
+			if tc.variantSize == 0 {
+				require.Equal(t, imageData, downloaded)
+			} else {
+				require.Equal(t, int(tc.variantSize), config.Width)
+				require.Equal(t, int(tc.variantSize)/2, config.Height)
+			}
+		})
+	}
+}
+
+func TestLaptopClient_GetImageURL(t *testing.T) {
+	t.Parallel()
+
+	s3Server := s3test.NewServer()
+	t.Cleanup(s3Server.Close)
+	imageStore, err := OpenS3ImageStore(S3Config{Endpoint: s3Server.URL, Bucket: "images", AccessKey: "access", SecretKey: "secret"})
+	require.NoError(t, err)
+	laptopStore := NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	imageData := encodeTestImage(t, "png", 600, 300)
+	imageID, err := imageStore.Save(laptop.Id, ".png", "image/png", bytes.NewReader(imageData))
+	require.NoError(t, err)
+	resizer := NewImageResizer(imageStore, 1, 1)
+	require.True(t, resizer.Submit(imageID))
+	resizer.Close()
+
+	serverAddr := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	testCases := []struct {
+		name        string //用例的名称
+		laptopID    string
+		size        uint32 //请求的缩略图尺寸
+		variantSize uint32 //返回的缩略图尺寸，原图为0
+		code        codes.Code
+	}{
+		{name: "original", laptopID: laptop.Id, size: 0, variantSize: 0, code: codes.OK},
+		{name: "thumbnail", laptopID: laptop.Id, size: 512, variantSize: 512, code: codes.OK},
+		{name: "larger_than_original", laptopID: laptop.Id, size: 1024, variantSize: 0, code: codes.OK},
+		{name: "unsupported_size", laptopID: laptop.Id, size: 100, code: codes.InvalidArgument},
+		{name: "other_laptop", laptopID: sample.NewLaptop().Id, code: codes.NotFound},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req := &pb.GetImageUrlRequest{LaptopId: tc.laptopID, ImageId: imageID, Size: tc.size}
+			res, err := laptopClient.GetImageUrl(context.Background(), req)
+			if tc.code != codes.OK {
+				require.Equal(t, tc.code, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.variantSize, res.GetVariantSize())
+			require.True(t, res.GetExpireTime().AsTime().After(time.Now()))
+
+			//不经过服务端直接从对象存储下载
+			httpRes, err := http.Get(res.GetUrl())
+			require.NoError(t, err)
+			defer httpRes.Body.Close()
+			require.Equal(t, http.StatusOK, httpRes.StatusCode)
+			downloaded, err := ioutil.ReadAll(httpRes.Body)
+			require.NoError(t, err)
+			if tc.variantSize == 0 {
+				require.Equal(t, imageData, downloaded)
+			} else {
+				config, _, err := image.DecodeConfig(bytes.NewReader(downloaded))
+				require.NoError(t, err)
+				require.Equal(t, int(tc.variantSize), config.Width)
+			}
+		})
+	}
+
+	//硬盘存储器不支持下载链接
+	diskAddr := startTestLaptopServer(t, laptopStore, openTestDiskImageStore(t, t.TempDir()), nil)
+	_, err = newTestLaptopClient(t, diskAddr).GetImageUrl(context.Background(), &pb.GetImageUrlRequest{LaptopId: laptop.Id, ImageId: imageID})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestLaptopClient_ManageImages(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	imageStore := openTestDiskImageStore(t, t.TempDir())
+	laptop := sample.NewLaptop()
+	other := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	require.NoError(t, laptopStore.Save(other))
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := imageStore.Save(laptop.Id, ".png", "image/png", strings.NewReader(fmt.Sprintf("image %d", i)))
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	otherID, err := imageStore.Save(other.Id, ".jpg", "image/jpeg", strings.NewReader("other image"))
+	require.NoError(t, err)
+
+	serverAddr := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+	adminCtx := testRoleContext(t, "admin1", "admin")
+
+	listIDs := func(laptopID string) []string {
+		res, err := laptopClient.ListLaptopImages(context.Background(), &pb.ListLaptopImagesRequest{LaptopId: laptopID})
+		require.NoError(t, err)
+		var result []string
+		for _, image := range res.GetImages() {
+			require.Equal(t, laptopID, image.GetLaptopId())
+			require.NotNil(t, image.GetCreatedAt())
+			result = append(result, image.GetId())
+		}
+		return result
 	}
+	require.ElementsMatch(t, ids, listIDs(laptop.Id))
+	require.Equal(t, []string{otherID}, listIDs(other.Id))
+	_, err = laptopClient.ListLaptopImages(context.Background(), &pb.ListLaptopImagesRequest{LaptopId: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
 
-	err = stream.CloseSend()
+	//只有管理员可以删除图片，图片必须属于该laptop
+	_, err = laptopClient.DeleteImage(testUserContext(t, "user1"), &pb.DeleteImageRequest{LaptopId: laptop.Id, ImageId: ids[0]})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = laptopClient.DeleteImage(adminCtx, &pb.DeleteImageRequest{LaptopId: laptop.Id, ImageId: otherID})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	info, err := imageStore.Find(ids[0])
+	require.NoError(t, err)
+	res, err := laptopClient.DeleteImage(adminCtx, &pb.DeleteImageRequest{LaptopId: laptop.Id, ImageId: ids[0]})
+	require.NoError(t, err)
+	require.Equal(t, ids[0], res.GetImageId())
+	require.NoFileExists(t, info.Path)
+	require.ElementsMatch(t, ids[1:], listIDs(laptop.Id))
+	_, err = laptopClient.DeleteImage(adminCtx, &pb.DeleteImageRequest{LaptopId: laptop.Id, ImageId: ids[0]})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	//删除laptop时同时删除其所有图片，其他laptop的图片不受影响
+	_, err = laptopClient.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+	images, err := imageStore.ListByLaptop(laptop.Id)
+	require.NoError(t, err)
+	require.Empty(t, images)
+	found, err := imageStore.Find(ids[1])
+	require.NoError(t, err)
+	require.Nil(t, found)
+	require.Equal(t, []string{otherID}, listIDs(other.Id))
+}
+
+func TestLaptopClient_RateLaptop(t *testing.T) {
+	t.Parallel()
+
+	//新建存储器
+	laptopStore := NewInMemoryLaptopStore()
+	rateStore := NewInMemoryRateStore()
+
+	//存储一个laptop
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	//开启服务器和客户端
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, rateStore)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	//未登录时不能评分
+	stream, err := laptopClient.RateLaptop(context.Background())
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	//提交评分的用户及分数，user1第二次评分会替换第一次的分数
+	usernames := []string{"user1", "user2", "user1"}
+	scores := []float64{8, 7.5, 10}
+	//预期每次提交后的评分次数和平均得分
+	counts := []uint32{1, 2, 2}
+	averages := []float64{8, 7.75, 8.75}
+
+	for i, score := range scores {
+		stream, err := laptopClient.RateLaptop(testUserContext(t, usernames[i]))
+		require.NoError(t, err)
+		req := &pb.RateLaptopRequest{
+			LaptopId: laptop.GetId(),
+			Score:    score,
+		}
+		err = stream.Send(req)
+		require.NoError(t, err)
+
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, laptop.GetId(), res.GetLaptopId())
+		require.Equal(t, counts[i], res.GetRatedCount())
+		require.Equal(t, averages[i], res.GetAverageScore())
+
+		err = stream.CloseSend()
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, io.EOF, err)
+	}
+}
+
+func TestLaptopClient_RateLaptopInvalidScore(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	rateStore := NewInMemoryRateStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, rateStore)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+	stream, err := laptopClient.RateLaptop(testUserContext(t, "user1"))
+	require.NoError(t, err)
+
+	//不合法的分数返回错误详情，流保持打开，之后的合法分数正常记录
+	for _, score := range []float64{-1, math.NaN(), 1e308, 7.3} {
+		err = stream.Send(&pb.RateLaptopRequest{LaptopId: laptop.Id, Score: score})
+		require.NoError(t, err)
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.NotNil(t, res.GetError())
+
+		st := status.FromProto(res.GetError())
+		require.Equal(t, codes.InvalidArgument, st.Code())
+		require.Len(t, st.Details(), 1)
+		badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+		require.True(t, ok)
+		require.Equal(t, "score", badRequest.GetFieldViolations()[0].GetField())
+	}
+
+	err = stream.Send(&pb.RateLaptopRequest{LaptopId: laptop.Id, Score: 7.5})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Nil(t, res.GetError())
+	require.EqualValues(t, 1, res.GetRatedCount())
+	require.Equal(t, 7.5, res.GetAverageScore())
+	require.NoError(t, stream.CloseSend())
+
+	rating, err := rateStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, rating.Count)
+}
+
+func TestLaptopClient_MyRating(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	rateStore := NewInMemoryRateStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	_, err := rateStore.Rate("user1", laptop.Id, 6)
+	require.NoError(t, err)
+	_, err = rateStore.Rate("user2", laptop.Id, 9)
+	require.NoError(t, err)
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, rateStore)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+	ctx := testUserContext(t, "user1")
+
+	_, err = laptopClient.GetMyRating(context.Background(), &pb.GetMyRatingRequest{LaptopId: laptop.Id})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	res, err := laptopClient.GetMyRating(ctx, &pb.GetMyRatingRequest{LaptopId: laptop.Id})
+	require.NoError(t, err)
+	require.Equal(t, laptop.Id, res.GetLaptopId())
+	require.Equal(t, 6.0, res.GetScore())
+
+	deleteRes, err := laptopClient.DeleteMyRating(ctx, &pb.DeleteMyRatingRequest{LaptopId: laptop.Id})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, deleteRes.GetRatedCount())
+	require.Equal(t, 9.0, deleteRes.GetAverageScore())
+
+	//删除后不能再次查询或删除，其他用户的评分不受影响
+	_, err = laptopClient.GetMyRating(ctx, &pb.GetMyRatingRequest{LaptopId: laptop.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = laptopClient.DeleteMyRating(ctx, &pb.DeleteMyRatingRequest{LaptopId: laptop.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	res, err = laptopClient.GetMyRating(testUserContext(t, "user2"), &pb.GetMyRatingRequest{LaptopId: laptop.Id})
 	require.NoError(t, err)
+	require.Equal(t, 9.0, res.GetScore())
+}
+
+func TestLaptopClient_ConcurrentCreateReview(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	rateStore := NewInMemoryRateStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	_, err := rateStore.Rate("user1", laptop.Id, 4)
+	require.NoError(t, err)
+
+	laptopServer := NewLaptopServer(laptopStore, nil, rateStore, NewInMemoryReviewStore(rateStore), nil)
+	serverAddr := serveTestLaptopServer(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+	ctx := testUserContext(t, "user1")
+
+	//同一用户同时提交多条评价，只有一条成功，评分与成功的评价一致
+	const requests = 10
+	var wg sync.WaitGroup
+	responses := make(chan *pb.CreateReviewResponse, requests)
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := laptopClient.CreateReview(ctx, &pb.CreateReviewRequest{LaptopId: laptop.Id, Score: float64(i + 1), Title: "good"})
+			if err != nil {
+				errs <- err
+				return
+			}
+			responses <- res
+		}(i)
+	}
+	wg.Wait()
+	close(responses)
+	close(errs)
+
+	require.Len(t, responses, 1)
+	res := <-responses
+	require.EqualValues(t, 1, res.GetRatedCount())
+	require.Equal(t, res.GetReview().GetScore(), res.GetAverageScore())
+	for err := range errs {
+		require.Equal(t, codes.AlreadyExists, status.Code(err))
+	}
+	myRating, err := laptopClient.GetMyRating(ctx, &pb.GetMyRatingRequest{LaptopId: laptop.Id})
+	require.NoError(t, err)
+	require.Equal(t, res.GetReview().GetScore(), myRating.GetScore())
+
+	//评价后不能再单独修改评分，流保持打开
+	stream, err := laptopClient.RateLaptop(ctx)
+	require.NoError(t, err)
+	err = stream.Send(&pb.RateLaptopRequest{LaptopId: laptop.Id, Score: 1})
+	require.NoError(t, err)
+	rateRes, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, codes.FailedPrecondition, status.FromProto(rateRes.GetError()).Code())
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	require.Equal(t, io.EOF, err)
+
+	myRating, err = laptopClient.GetMyRating(ctx, &pb.GetMyRatingRequest{LaptopId: laptop.Id})
+	require.NoError(t, err)
+	require.Equal(t, res.GetReview().GetScore(), myRating.GetScore())
+}
+
+func TestLaptopClient_Reviews(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	rateStore := NewInMemoryRateStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	_, err := rateStore.Rate("user1", laptop.Id, 4)
+	require.NoError(t, err)
+
+	laptopServer := NewLaptopServer(laptopStore, nil, rateStore, NewInMemoryReviewStore(rateStore), nil)
+	serverAddr := serveTestLaptopServer(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	//不合法的字段全部在BadRequest详情中返回
+	_, err = laptopClient.CreateReview(testUserContext(t, "user1"), &pb.CreateReviewRequest{LaptopId: laptop.Id, Score: 11})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	details := status.Convert(err).Details()
+	require.Len(t, details, 1)
+	require.Len(t, details[0].(*errdetails.BadRequest).GetFieldViolations(), 2)
+
+	_, err = laptopClient.CreateReview(testUserContext(t, "user1"), &pb.CreateReviewRequest{LaptopId: "missing", Score: 8, Title: "good"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	//评价的分数替换user1之前的评分
+	var ids []string
+	for i, username := range []string{"user1", "user2", "user3"} {
+		res, err := laptopClient.CreateReview(testUserContext(t, username), &pb.CreateReviewRequest{
+			LaptopId: laptop.Id,
+			Score:    float64(6 + i),
+			Title:    "review by " + username,
+			Body:     "body",
+		})
+		require.NoError(t, err)
+		require.Equal(t, username, res.GetReview().GetAuthor())
+		require.NotEmpty(t, res.GetReview().GetId())
+		require.NotNil(t, res.GetReview().GetCreatedAt())
+		require.EqualValues(t, i+1, res.GetRatedCount())
+		require.Equal(t, 6+float64(i)/2, res.GetAverageScore())
+		ids = append(ids, res.GetReview().GetId())
+	}
+	_, err = laptopClient.CreateReview(testUserContext(t, "user1"), &pb.CreateReviewRequest{LaptopId: laptop.Id, Score: 8, Title: "again"})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	myRating, err := rateStore.FindUserRating("user1", laptop.Id)
+	require.NoError(t, err)
+	require.Equal(t, 6.0, myRating.Score)
+
+	//评价中的分数不能单独删除
+	_, err = laptopClient.DeleteMyRating(testUserContext(t, "user1"), &pb.DeleteMyRatingRequest{LaptopId: laptop.Id})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	//投票
+	voteRes, err := laptopClient.VoteReviewHelpful(testUserContext(t, "user2"), &pb.VoteReviewHelpfulRequest{ReviewId: ids[0]})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, voteRes.GetHelpfulVotes())
+	_, err = laptopClient.VoteReviewHelpful(testUserContext(t, "user2"), &pb.VoteReviewHelpfulRequest{ReviewId: ids[0]})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = laptopClient.VoteReviewHelpful(testUserContext(t, "user1"), &pb.VoteReviewHelpfulRequest{ReviewId: ids[0]})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = laptopClient.VoteReviewHelpful(testUserContext(t, "user1"), &pb.VoteReviewHelpfulRequest{ReviewId: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	//分页查询，不需要登录
+	listIDs := func(order pb.ListReviewsRequest_Order) []string {
+		var result []string
+		req := &pb.ListReviewsRequest{LaptopId: laptop.Id, PageSize: 2, Order: order}
+		for {
+			res, err := laptopClient.ListReviews(context.Background(), req)
+			require.NoError(t, err)
+			for _, review := range res.GetReviews() {
+				result = append(result, review.GetId())
+			}
+			if res.GetNextPageToken() == "" {
+				return result
+			}
+			req.PageToken = res.GetNextPageToken()
+		}
+	}
+	newest := listIDs(pb.ListReviewsRequest_NEWEST)
+	require.ElementsMatch(t, ids, newest)
+	helpful := listIDs(pb.ListReviewsRequest_MOST_HELPFUL)
+	require.Equal(t, ids[0], helpful[0])
+	require.Len(t, helpful, 3)
+
+	//翻页时不能改变排序方式
+	res, err := laptopClient.ListReviews(context.Background(), &pb.ListReviewsRequest{LaptopId: laptop.Id, PageSize: 1})
+	require.NoError(t, err)
+	_, err = laptopClient.ListReviews(context.Background(), &pb.ListReviewsRequest{
+		LaptopId:  laptop.Id,
+		PageToken: res.GetNextPageToken(),
+		Order:     pb.ListReviewsRequest_MOST_HELPFUL,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// openTestDiskImageStore 打开保存在imageFolder中的测试图片存储器
+func openTestDiskImageStore(t *testing.T, imageFolder string) *DiskImageStore {
+	store, err := OpenDiskImageStore(imageFolder)
+	require.NoError(t, err)
+	return store
 }
 
 // startTestLaptopServer 启动一个测试的grpc服务器
 func startTestLaptopServer(t *testing.T, laptopStore LaptopStore, imageStore ImageStore, rateStore RateStore) string {
-	laptopServer := NewLaptopServer(laptopStore, imageStore, rateStore)
-	grpcServer := grpc.NewServer()
+	laptopServer := NewLaptopServer(laptopStore, imageStore, rateStore, nil, nil)
+	return serveTestLaptopServer(t, laptopServer)
+}
+
+// serveTestLaptopServer 使用指定的laptopServer启动一个测试的grpc服务器
+func serveTestLaptopServer(t *testing.T, laptopServer *LaptopServer) string {
+	interceptor := NewAuthInterceptor(_testJWTManager, map[string][]string{
+		"/LaptopService/RateLaptop":        {"user"},
+		"/LaptopService/GetMyRating":       {"user"},
+		"/LaptopService/DeleteMyRating":    {"user"},
+		"/LaptopService/CreateReview":      {"user"},
+		"/LaptopService/VoteReviewHelpful": {"user"},
+		"/LaptopService/DeleteImage":       {"admin"},
+	})
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(interceptor.Unary()),
+		grpc.StreamInterceptor(interceptor.Stream()),
+	)
 	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
 	listener, err := net.Listen("tcp", ":0") //随机监听一个可用的端口
 	require.NoError(t, err)
@@ -246,6 +1620,18 @@ func startTestLaptopServer(t *testing.T, laptopStore LaptopStore, imageStore Ima
 	return listener.Addr().String()
 }
 
+// testUserContext 返回携带username访问令牌的context，用于调用需要鉴权的方法
+func testUserContext(t *testing.T, username string) context.Context {
+	return testRoleContext(t, username, "user")
+}
+
+// testRoleContext 返回携带指定角色用户访问令牌的context
+func testRoleContext(t *testing.T, username, role string) context.Context {
+	token, err := _testJWTManager.Generate(&User{Username: username, Role: role})
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", token)
+}
+
 // newTestLaptopClient 创建一个客户端
 func newTestLaptopClient(t *testing.T, serverAddr string) pb.LaptopServiceClient {
 	conn, err := grpc.Dial(serverAddr, grpc.WithInsecure())
@@ -265,3 +1651,62 @@ func requireSameLaptop(t *testing.T, laptop1, laptop2 *pb.Laptop) {
 	require.NoError(t, err)
 	require.Equal(t, json1, json2)
 }
+
+func TestLaptopClient_RatingStats(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := NewInMemoryLaptopStore()
+	rateStore := NewInMemoryRateStore()
+	laptops := make([]*pb.Laptop, 4)
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+		require.NoError(t, laptopStore.Save(laptops[i]))
+	}
+	rate := func(laptop *pb.Laptop, score float64, count int) {
+		for i := 0; i < count; i++ {
+			_, err := rateStore.Rate(fmt.Sprintf("user%d", i), laptop.Id, score)
+			require.NoError(t, err)
+		}
+	}
+	//laptops[3]未被评分
+	rate(laptops[0], 10, 1)
+	rate(laptops[1], 9.5, 20)
+	rate(laptops[2], 2, 3)
+
+	serverAddr := startTestLaptopServer(t, laptopStore, nil, rateStore)
+	laptopClient := newTestLaptopClient(t, serverAddr)
+
+	res, err := laptopClient.GetRatingStats(context.Background(), &pb.GetRatingStatsRequest{LaptopId: laptops[1].Id})
+	require.NoError(t, err)
+	stats := res.GetStats()
+	require.Equal(t, laptops[1].Id, stats.GetLaptopId())
+	require.EqualValues(t, 20, stats.GetCount())
+	require.Equal(t, 9.5, stats.GetMean())
+	require.Equal(t, 9.5, stats.GetMedian())
+	require.Len(t, stats.GetDistribution(), 1)
+	require.EqualValues(t, 20, stats.GetDistribution()[0].GetCount())
+	require.Less(t, stats.GetWeightedScore(), 9.5)
+
+	res, err = laptopClient.GetRatingStats(context.Background(), &pb.GetRatingStatsRequest{LaptopId: laptops[3].Id})
+	require.NoError(t, err)
+	require.EqualValues(t, 0, res.GetStats().GetCount())
+	require.Empty(t, res.GetStats().GetDistribution())
+
+	_, err = laptopClient.GetRatingStats(context.Background(), &pb.GetRatingStatsRequest{LaptopId: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	//只有一个满分的laptop排在大量9.5分的laptop之后，未评分的laptop不参与排名
+	topRes, err := laptopClient.TopRatedLaptops(context.Background(), &pb.TopRatedLaptopsRequest{})
+	require.NoError(t, err)
+	var ids []string
+	for _, rated := range topRes.GetLaptops() {
+		require.Equal(t, rated.GetLaptop().GetId(), rated.GetStats().GetLaptopId())
+		ids = append(ids, rated.GetLaptop().GetId())
+	}
+	require.Equal(t, []string{laptops[1].Id, laptops[0].Id, laptops[2].Id}, ids)
+
+	topRes, err = laptopClient.TopRatedLaptops(context.Background(), &pb.TopRatedLaptopsRequest{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, topRes.GetLaptops(), 1)
+	require.Equal(t, laptops[1].Id, topRes.GetLaptops()[0].GetLaptop().GetId())
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"pcbook/pb"
+	"sync"
+	"time"
+)
+
+const _subscriptionBufferSize = 64 //每个订阅者缓存的事件数量，超过后视为消费过慢
+
+var (
+	ErrInvalidResumeToken  = errors.New("invalid resume token")
+	ErrResumeTokenExpired  = errors.New("resume token is expired")
+	ErrSubscriptionDropped = errors.New("subscription is dropped because the subscriber is too slow")
+)
+
+// laptopEvent 变更日志中的一项
+type laptopEvent struct {
+	sequence uint64
+	event    *pb.LaptopEvent
+	previous *pb.Laptop //更新前的laptop，用于判断laptop是否从filter范围内移出
+}
+
+// match 判断事件是否符合filter，更新事件在更新前或更新后符合即可
+func (e *laptopEvent) match(filter *pb.Filter) bool {
+	if filter == nil {
+		return true
+	}
+	if isQualified(filter, e.event.GetLaptop()) {
+		return true
+	}
+	return e.previous != nil && isQualified(filter, e.previous)
+}
+
+// LaptopEventBus laptop变更事件总线，保存最近的变更日志，并将新的事件推送给订阅者
+type LaptopEventBus struct {
+	mutex       sync.Mutex
+	epoch       uint64 //创建总线的时间，服务重启后之前的resume token失效
+	sequence    uint64 //最后一个事件的序号
+	capacity    int    //变更日志最多保存的事件数量
+	log         []*laptopEvent
+	subscribers map[*LaptopSubscription]struct{}
+}
+
+func NewLaptopEventBus(capacity int) *LaptopEventBus {
+	return &LaptopEventBus{
+		epoch:       uint64(time.Now().UnixNano()),
+		capacity:    capacity,
+		subscribers: make(map[*LaptopSubscription]struct{}),
+	}
+}
+
+// Publish 发布变更事件，previous为更新前的laptop，创建和删除时为nil
+// 消费过慢的订阅者会被移除，不会阻塞发布者
+func (bus *LaptopEventBus) Publish(eventType pb.LaptopEvent_Type, laptop *pb.Laptop, previous *pb.Laptop) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.sequence++
+	e := &laptopEvent{
+		sequence: bus.sequence,
+		event: &pb.LaptopEvent{
+			Type:        eventType,
+			Laptop:      laptop,
+			ResumeToken: encodeResumeToken(bus.epoch, bus.sequence),
+			Time:        timestamppb.Now(),
+		},
+		previous: previous,
+	}
+
+	bus.log = append(bus.log, e)
+	if len(bus.log) > bus.capacity {
+		bus.log = bus.log[len(bus.log)-bus.capacity:]
+	}
+
+	for sub := range bus.subscribers {
+		if !e.match(sub.filter) {
+			continue
+		}
+		select {
+		case sub.events <- e.event:
+		default:
+			bus.remove(sub)
+		}
+	}
+}
+
+// Subscribe 订阅符合filter的事件，resumeToken不为空时先返回该token之后错过的事件
+func (bus *LaptopEventBus) Subscribe(filter *pb.Filter, resumeToken string) (*LaptopSubscription, error) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	sub := &LaptopSubscription{
+		bus:    bus,
+		filter: filter,
+		events: make(chan *pb.LaptopEvent, _subscriptionBufferSize),
+	}
+
+	if len(resumeToken) > 0 {
+		epoch, sequence, err := decodeResumeToken(resumeToken)
+		if err != nil {
+			return nil, err
+		}
+		if epoch != bus.epoch {
+			return nil, fmt.Errorf("%w: server has restarted", ErrResumeTokenExpired)
+		}
+		if sequence > bus.sequence {
+			return nil, fmt.Errorf("%w: unknown event", ErrInvalidResumeToken)
+		}
+		//token之后的事件已经有部分被移出日志
+		if sequence < bus.sequence && (len(bus.log) == 0 || bus.log[0].sequence > sequence+1) {
+			return nil, fmt.Errorf("%w: missed events are no longer available", ErrResumeTokenExpired)
+		}
+		for _, e := range bus.log {
+			if e.sequence > sequence && e.match(filter) {
+				sub.pending = append(sub.pending, e.event)
+			}
+		}
+	}
+
+	bus.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// remove 移除订阅者，调用方需持有锁
+func (bus *LaptopEventBus) remove(sub *LaptopSubscription) {
+	if _, ok := bus.subscribers[sub]; ok {
+		delete(bus.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// LaptopSubscription 事件订阅，非并发安全，只能由一个协程接收事件
+type LaptopSubscription struct {
+	bus     *LaptopEventBus
+	filter  *pb.Filter
+	pending []*pb.LaptopEvent //订阅时需要补发的事件
+	events  chan *pb.LaptopEvent
+}
+
+// Next 阻塞等待下一个事件，订阅因消费过慢被移除时返回ErrSubscriptionDropped
+func (sub *LaptopSubscription) Next(ctx context.Context) (*pb.LaptopEvent, error) {
+	if len(sub.pending) > 0 {
+		event := sub.pending[0]
+		sub.pending = sub.pending[1:]
+		return event, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case event, ok := <-sub.events:
+		if !ok {
+			return nil, ErrSubscriptionDropped
+		}
+		return event, nil
+	}
+}
+
+// Close 取消订阅
+func (sub *LaptopSubscription) Close() {
+	sub.bus.mutex.Lock()
+	defer sub.bus.mutex.Unlock()
+	sub.bus.remove(sub)
+}
+
+// encodeResumeToken 将总线的epoch和事件序号编码为token
+func encodeResumeToken(epoch, sequence uint64) string {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data, epoch)
+	binary.BigEndian.PutUint64(data[8:], sequence)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeResumeToken 解析token中的epoch和事件序号
+func decodeResumeToken(token string) (uint64, uint64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != 16 {
+		return 0, 0, ErrInvalidResumeToken
+	}
+	return binary.BigEndian.Uint64(data), binary.BigEndian.Uint64(data[8:]), nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"math"
+	"pcbook/pb"
+	"pcbook/query"
+	"sort"
+)
+
+// indexEntry 索引中的一项，按key升序排列，key相同时按id升序
+type indexEntry struct {
+	key float64
+	id  string
+}
+
+// sortedIndex 有序索引，用于范围查询时只访问候选的laptop，非并发安全，由store的锁保护
+type sortedIndex struct {
+	key     func(laptop *pb.Laptop) float64
+	entries []indexEntry
+}
+
+func newSortedIndex(key func(laptop *pb.Laptop) float64) *sortedIndex {
+	return &sortedIndex{key: key}
+}
+
+// search 返回第一个不小于(key, id)的位置
+func (index *sortedIndex) search(key float64, id string) int {
+	return sort.Search(len(index.entries), func(i int) bool {
+		entry := index.entries[i]
+		return entry.key > key || (entry.key == key && entry.id >= id)
+	})
+}
+
+// insert 将laptop加入索引
+func (index *sortedIndex) insert(laptop *pb.Laptop) {
+	entry := indexEntry{key: index.key(laptop), id: laptop.GetId()}
+	i := index.search(entry.key, entry.id)
+	index.entries = append(index.entries, indexEntry{})
+	copy(index.entries[i+1:], index.entries[i:])
+	index.entries[i] = entry
+}
+
+// remove 将laptop从索引中移除，laptop必须是加入索引时的同一份数据
+func (index *sortedIndex) remove(laptop *pb.Laptop) {
+	key, id := index.key(laptop), laptop.GetId()
+	i := index.search(key, id)
+	if i < len(index.entries) && index.entries[i].id == id {
+		index.entries = append(index.entries[:i], index.entries[i+1:]...)
+	}
+}
+
+// between 返回key在[min, max]范围内的索引项，不会复制底层数组
+func (index *sortedIndex) between(min, max float64) []indexEntry {
+	lo := sort.Search(len(index.entries), func(i int) bool {
+		return index.entries[i].key >= min
+	})
+	hi := sort.Search(len(index.entries), func(i int) bool {
+		return index.entries[i].key > max
+	})
+	if lo >= hi {
+		return nil
+	}
+	return index.entries[lo:hi]
+}
+
+// laptopIndexes InMemoryLaptopStore的二级索引
+type laptopIndexes struct {
+	price    *sortedIndex
+	cpuCores *sortedIndex
+	cpuGhz   *sortedIndex
+	ram      *sortedIndex
+}
+
+func newLaptopIndexes() *laptopIndexes {
+	return &laptopIndexes{
+		price: newSortedIndex(func(laptop *pb.Laptop) float64 {
+			return laptop.GetPriceUsed()
+		}),
+		cpuCores: newSortedIndex(func(laptop *pb.Laptop) float64 {
+			return float64(laptop.GetCpu().GetNumberCores())
+		}),
+		cpuGhz: newSortedIndex(func(laptop *pb.Laptop) float64 {
+			return laptop.GetCpu().GetMinGhz()
+		}),
+		ram: newSortedIndex(func(laptop *pb.Laptop) float64 {
+			return float64(query.MemoryBits(laptop.GetRam()))
+		}),
+	}
+}
+
+func (indexes *laptopIndexes) all() []*sortedIndex {
+	return []*sortedIndex{indexes.price, indexes.cpuCores, indexes.cpuGhz, indexes.ram}
+}
+
+func (indexes *laptopIndexes) insert(laptop *pb.Laptop) {
+	for _, index := range indexes.all() {
+		index.insert(laptop)
+	}
+}
+
+func (indexes *laptopIndexes) remove(laptop *pb.Laptop) {
+	for _, index := range indexes.all() {
+		index.remove(laptop)
+	}
+}
+
+// candidates 根据filter中的范围条件，从最小的候选集合中返回laptop id
+// 返回的id仍需使用isQualified进行完整的判断
+func (indexes *laptopIndexes) candidates(filter *pb.Filter) []indexEntry {
+	inf := math.Inf(1)
+	ranges := [][]indexEntry{
+		indexes.price.between(filter.GetMinPriceUsed(), filter.GetMaxPriceUsed()),
+		indexes.cpuCores.between(float64(filter.GetMinCpuCores()), inf),
+		indexes.cpuGhz.between(filter.GetMinCpuGhz(), inf),
+		indexes.ram.between(float64(query.MemoryBits(filter.GetMinRam())), inf),
+	}
+	best := ranges[0]
+	for _, entries := range ranges[1:] {
+		if len(entries) < len(best) {
+			best = entries
+		}
+	}
+	return best
+}
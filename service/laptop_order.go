@@ -0,0 +1,160 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"pcbook/pb"
+	"pcbook/query"
+	"strings"
+)
+
+var ErrInvalidOrderBy = errors.New("invalid order by")
+
+// LaptopOrderField 排序字段
+type LaptopOrderField struct {
+	Path string //字段路径，如price_used、cpu.number_cores
+	Desc bool   //是否降序
+}
+
+// LaptopOrder 多个排序字段，依次比较，最后总是按id升序，保证顺序稳定
+type LaptopOrder []LaptopOrderField
+
+// _ratingOrderPath 按平均评分排序，评分不属于laptop本身，需要由调用方提供查询方法
+const _ratingOrderPath = "rating"
+
+// _laptopOrderKeys 支持排序的字段及对应的比较方法
+var _laptopOrderKeys = map[string]func(a, b *pb.Laptop) int{
+	"id": func(a, b *pb.Laptop) int {
+		return strings.Compare(a.GetId(), b.GetId())
+	},
+	"brand": func(a, b *pb.Laptop) int {
+		return strings.Compare(a.GetBrand(), b.GetBrand())
+	},
+	"name": func(a, b *pb.Laptop) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	},
+	"price_used": func(a, b *pb.Laptop) int {
+		return compareFloat64(a.GetPriceUsed(), b.GetPriceUsed())
+	},
+	"release_year": func(a, b *pb.Laptop) int {
+		return compareUint64(uint64(a.GetReleaseYear()), uint64(b.GetReleaseYear()))
+	},
+	"update_at": func(a, b *pb.Laptop) int {
+		ta, tb := a.GetUpdateAt().AsTime(), b.GetUpdateAt().AsTime()
+		switch {
+		case ta.Before(tb):
+			return -1
+		case ta.After(tb):
+			return 1
+		default:
+			return 0
+		}
+	},
+	"cpu.number_cores": func(a, b *pb.Laptop) int {
+		return compareUint64(uint64(a.GetCpu().GetNumberCores()), uint64(b.GetCpu().GetNumberCores()))
+	},
+	"cpu.min_ghz": func(a, b *pb.Laptop) int {
+		return compareFloat64(a.GetCpu().GetMinGhz(), b.GetCpu().GetMinGhz())
+	},
+	"ram": func(a, b *pb.Laptop) int {
+		return compareUint64(query.MemoryBits(a.GetRam()), query.MemoryBits(b.GetRam()))
+	},
+}
+
+// ParseLaptopOrder 解析order_by，格式为逗号分隔的"字段 [asc|desc]"
+func ParseLaptopOrder(orderBy string) (LaptopOrder, error) {
+	var order LaptopOrder
+	if strings.TrimSpace(orderBy) == "" {
+		return order, nil
+	}
+	for _, item := range strings.Split(orderBy, ",") {
+		words := strings.Fields(item)
+		if len(words) == 0 || len(words) > 2 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidOrderBy, item)
+		}
+		if _laptopOrderKeys[words[0]] == nil {
+			return nil, fmt.Errorf("%w: unsupported field %q", ErrInvalidOrderBy, words[0])
+		}
+		field := LaptopOrderField{Path: words[0]}
+		if len(words) == 2 {
+			switch strings.ToLower(words[1]) {
+			case "asc":
+			case "desc":
+				field.Desc = true
+			default:
+				return nil, fmt.Errorf("%w: unknown direction %q", ErrInvalidOrderBy, words[1])
+			}
+		}
+		order = append(order, field)
+	}
+	return order, nil
+}
+
+// String 返回规范化的order_by字符串
+func (order LaptopOrder) String() string {
+	items := make([]string, len(order))
+	for i, field := range order {
+		items[i] = field.Path
+		if field.Desc {
+			items[i] += " desc"
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+// Paths 返回比较时用到的所有字段路径，包括最后的id
+func (order LaptopOrder) Paths() []string {
+	paths := make([]string, 0, len(order)+1)
+	for _, field := range order {
+		paths = append(paths, field.Path)
+	}
+	return append(paths, "id")
+}
+
+// Compare 按排序规则比较两个laptop，a在b之前返回负数，之后返回正数
+func (order LaptopOrder) Compare(a, b *pb.Laptop) int {
+	return order.CompareWithRating(a, b, nil)
+}
+
+// CompareWithRating 同Compare，rating用于查询laptop的平均评分，按rating排序时使用
+func (order LaptopOrder) CompareWithRating(a, b *pb.Laptop, rating func(laptopID string) float64) int {
+	for _, field := range order {
+		var c int
+		if field.Path == _ratingOrderPath {
+			if rating != nil {
+				c = compareFloat64(rating(a.GetId()), rating(b.GetId()))
+			}
+		} else {
+			c = _laptopOrderKeys[field.Path](a, b)
+		}
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.GetId(), b.GetId())
+}
+
+func compareFloat64(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
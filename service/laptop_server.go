@@ -1,32 +1,64 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"io"
+	"io/ioutil"
 	"log"
+	"mime"
 	"pcbook/pb"
+	"pcbook/query"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const (
-	_maxImageSize = 1 << 20 //1M
+	_imageChunkSize      = 1 << 10 //下载图片时每个chunk的大小
+	_maxImageDimension   = 8192    //图片宽和高的最大像素数
+	_defaultListPageSize = 10      //分页查询默认每页数量
+	_maxListPageSize     = 100     //分页查询每页最大数量
+	_maxReviewTitleSize  = 200     //评价标题的最大字符数
+	_maxReviewBodySize   = 10000   //评价正文的最大字符数
+	_ratingPriorWeight   = 10      //计算加权评分时，所有laptop的平均分相当于的评分次数
+	_defaultTopRatedSize = 10      //查询评分最高的laptop默认返回的数量
 )
 
+const _imageURLExpiry = 15 * time.Minute //图片下载链接的有效期
+
+// DefaultMaxImageSize 默认上传图片的最大字节数，1M
+const DefaultMaxImageSize = 1 << 20
+
 type LaptopServer struct {
-	LaptopStore LaptopStore
-	ImageStore  ImageStore
-	RateStore   RateStore
+	LaptopStore  LaptopStore
+	ImageStore   ImageStore
+	RateStore    RateStore
+	ReviewStore  ReviewStore
+	EventBus     *LaptopEventBus //laptop变更事件，为nil时不支持WatchLaptops
+	RatingScale  RatingScale     //RateLaptop接受的评分范围
+	ImageResizer *ImageResizer   //上传图片后异步生成缩略图，为nil时不生成
+	UploadStore  UploadStore     //断点续传的上传会话，为nil时不支持断点续传
+	MaxImageSize int64           //上传图片的最大字节数
 }
 
-func NewLaptopServer(laptopStore LaptopStore, imageStore ImageStore, rateStore RateStore) *LaptopServer {
+func NewLaptopServer(laptopStore LaptopStore, imageStore ImageStore, rateStore RateStore, reviewStore ReviewStore, eventBus *LaptopEventBus) *LaptopServer {
 	return &LaptopServer{
-		LaptopStore: laptopStore,
-		ImageStore:  imageStore,
-		RateStore:   rateStore,
+		LaptopStore:  laptopStore,
+		ImageStore:   imageStore,
+		RateStore:    rateStore,
+		ReviewStore:  reviewStore,
+		EventBus:     eventBus,
+		RatingScale:  DefaultRatingScale,
+		MaxImageSize: DefaultMaxImageSize,
 	}
 }
 
@@ -79,13 +111,122 @@ func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLapt
 
 }
 
+// GetLaptop 根据id获取laptop
+func (server *LaptopServer) GetLaptop(ctx context.Context, req *pb.GetLaptopRequest) (*pb.GetLaptopResponse, error) {
+	laptopID := req.GetId()
+	log.Printf("receive a get-laptop request with id: %s", laptopID)
+
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+
+	laptop, err := server.LaptopStore.Find(laptopID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+	}
+	if laptop == nil {
+		return nil, status.Errorf(codes.NotFound, "laptop %s doesn't exist", laptopID)
+	}
+
+	res := &pb.GetLaptopResponse{
+		Laptop: laptop,
+	}
+	return res, nil
+}
+
+// UpdateLaptop 更新laptop
+func (server *LaptopServer) UpdateLaptop(ctx context.Context, req *pb.UpdateLaptopRequest) (*pb.UpdateLaptopResponse, error) {
+	laptop := req.GetLaptop()
+	log.Printf("receive an update-laptop request with id: %s", laptop.GetId())
+
+	//更新时laptop.Id必须为有效的uuid
+	_, err := uuid.Parse(laptop.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "laptop ID is not a valid UUID: %v", err)
+	}
+
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+
+	//mask为空时整体替换，否则只更新指定的字段
+	updated, err := server.LaptopStore.Update(laptop, req.GetUpdateMask(), req.GetExpectedRevision())
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		} else if errors.Is(err, ErrInvalidFieldMask) {
+			code = codes.InvalidArgument
+		} else if errors.Is(err, ErrRevisionMismatch) {
+			code = codes.Aborted
+		}
+		return nil, status.Errorf(code, "cannot update laptop in the store: %v", err)
+	}
+
+	log.Printf("updated laptop with id: %s, mask: %v, revision: %d", laptop.Id, req.GetUpdateMask().GetPaths(), updated.GetRevision())
+
+	res := &pb.UpdateLaptopResponse{
+		Laptop: updated,
+	}
+	return res, nil
+}
+
+// DeleteLaptop 根据id删除laptop
+func (server *LaptopServer) DeleteLaptop(ctx context.Context, req *pb.DeleteLaptopRequest) (*pb.DeleteLaptopResponse, error) {
+	laptopID := req.GetId()
+	log.Printf("receive a delete-laptop request with id: %s", laptopID)
+
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+
+	err := server.LaptopStore.Delete(laptopID)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot delete laptop from the store: %v", err)
+	}
+
+	log.Printf("deleted laptop with id: %s", laptopID)
+	server.deleteLaptopImages(laptopID)
+
+	res := &pb.DeleteLaptopResponse{
+		Id: laptopID,
+	}
+	return res, nil
+}
+
 // SearchLaptop 搜索laptop
 func (server *LaptopServer) SearchLaptop(req *pb.SearchLaptopRequest, stream pb.LaptopService_SearchLaptopServer) error {
 	filter := req.GetFilter()
-	log.Printf("receive a search-laptop request with filter: %v", filter)
+	log.Printf("receive a search-laptop request with filter: %v, query: %q, sort by: %v, max results: %d", filter, req.GetQuery(), req.GetSortBy(), req.GetMaxResults())
+
+	order, err := searchOrder(req.GetSortBy())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "cannot parse sort by: %v", err)
+	}
+	options := SearchOptions{
+		Order:      order,
+		MaxResults: int(req.GetMaxResults()),
+		Rating:     server.averageRating,
+	}
+
+	//使用文本查询语句代替filter
+	if req.GetQuery() != "" {
+		if filter != nil {
+			return status.Errorf(codes.InvalidArgument, "filter and query cannot be used together")
+		}
+		expr, err := query.Parse(req.GetQuery())
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "cannot parse query: %v", err)
+		}
+		options.Match = expr.Match
+	}
 
 	ctx := stream.Context()
-	err := server.LaptopStore.Search(ctx, filter, func(laptop *pb.Laptop) error {
+	err = server.LaptopStore.Search(ctx, filter, options, func(laptop *pb.Laptop) error {
 		res := &pb.SearchLaptopResponse{
 			Laptop: laptop,
 		}
@@ -104,6 +245,156 @@ func (server *LaptopServer) SearchLaptop(req *pb.SearchLaptopRequest, stream pb.
 	return nil
 }
 
+// AggregateLaptops 统计符合filter的laptop的分面数量及价格
+func (server *LaptopServer) AggregateLaptops(ctx context.Context, req *pb.AggregateLaptopsRequest) (*pb.AggregateLaptopsResponse, error) {
+	filter := req.GetFilter()
+	log.Printf("receive an aggregate-laptops request with filter: %v", filter)
+
+	aggregation, err := server.LaptopStore.Aggregate(ctx, filter)
+	if err != nil {
+		if err := contextErr(ctx); err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "cannot aggregate laptops: %v", err)
+	}
+
+	res := &pb.AggregateLaptopsResponse{
+		Aggregation: aggregation,
+	}
+	return res, nil
+}
+
+// _searchOrderPaths 搜索排序字段对应的laptop字段路径
+var _searchOrderPaths = map[pb.SortBy_Field]string{
+	pb.SortBy_PRICE:        "price_used",
+	pb.SortBy_CPU_CORES:    "cpu.number_cores",
+	pb.SortBy_CPU_MIN_GHZ:  "cpu.min_ghz",
+	pb.SortBy_RAM:          "ram",
+	pb.SortBy_RELEASE_YEAR: "release_year",
+	pb.SortBy_RATING:       _ratingOrderPath,
+}
+
+// searchOrder 将请求中的排序字段转换为LaptopOrder
+func searchOrder(sortBy []*pb.SortBy) (LaptopOrder, error) {
+	var order LaptopOrder
+	for _, item := range sortBy {
+		path, ok := _searchOrderPaths[item.GetField()]
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported field %v", ErrInvalidOrderBy, item.GetField())
+		}
+		order = append(order, LaptopOrderField{Path: path, Desc: item.GetDescending()})
+	}
+	return order, nil
+}
+
+// averageRating 查询laptop的平均评分，未评分或查询失败时为0
+func (server *LaptopServer) averageRating(laptopID string) float64 {
+	if server.RateStore == nil {
+		return 0
+	}
+	rating, err := server.RateStore.Find(laptopID)
+	if err != nil {
+		log.Printf("cannot find rating of laptop %s: %v", laptopID, err)
+		return 0
+	}
+	return rating.Average()
+}
+
+// ListLaptops 分页查询laptop
+func (server *LaptopServer) ListLaptops(ctx context.Context, req *pb.ListLaptopsRequest) (*pb.ListLaptopsResponse, error) {
+	log.Printf("receive a list-laptops request: %v", req)
+
+	pageSize := int(req.GetPageSize())
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page size must not be negative: %d", pageSize)
+	}
+	if pageSize == 0 {
+		pageSize = _defaultListPageSize
+	}
+	if pageSize > _maxListPageSize {
+		pageSize = _maxListPageSize
+	}
+
+	order, err := ParseLaptopOrder(req.GetOrderBy())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot parse order by: %v", err)
+	}
+
+	after, err := decodePageToken(order, req.GetPageToken())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot parse page token: %v", err)
+	}
+
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+
+	//多查询一条，用于判断是否还有下一页
+	laptops, err := server.LaptopStore.List(ctx, order, after, pageSize+1)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list laptops: %v", err)
+	}
+
+	res := &pb.ListLaptopsResponse{}
+	if len(laptops) > pageSize {
+		laptops = laptops[:pageSize]
+		res.NextPageToken, err = encodePageToken(order, laptops[pageSize-1])
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot generate page token: %v", err)
+		}
+	}
+	res.Laptops = laptops
+
+	log.Printf("list %d laptops", len(laptops))
+	return res, nil
+}
+
+// WatchLaptops 服务端流模式，持续推送符合filter的laptop变更事件
+func (server *LaptopServer) WatchLaptops(req *pb.WatchLaptopsRequest, stream pb.LaptopService_WatchLaptopsServer) error {
+	filter := req.GetFilter()
+	log.Printf("receive a watch-laptops request with filter: %v, resume token: %q", filter, req.GetResumeToken())
+
+	if server.EventBus == nil {
+		return status.Errorf(codes.Unimplemented, "watching laptops is not enabled")
+	}
+
+	sub, err := server.EventBus.Subscribe(filter, req.GetResumeToken())
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrInvalidResumeToken) {
+			code = codes.InvalidArgument
+		} else if errors.Is(err, ErrResumeTokenExpired) {
+			//错过的事件已经不在变更日志中，客户端需要重新全量同步
+			code = codes.OutOfRange
+		}
+		return status.Errorf(code, "cannot watch laptops: %v", err)
+	}
+	defer sub.Close()
+
+	for {
+		event, err := sub.Next(stream.Context())
+		if err != nil {
+			if err := contextErr(stream.Context()); err != nil {
+				return err
+			}
+			if errors.Is(err, ErrSubscriptionDropped) {
+				//客户端可以使用最后收到的resume token重新订阅
+				return status.Errorf(codes.ResourceExhausted, "cannot watch laptops: %v", err)
+			}
+			return status.Errorf(codes.Internal, "cannot watch laptops: %v", err)
+		}
+
+		res := &pb.WatchLaptopsResponse{
+			Event: event,
+		}
+		err = stream.Send(res)
+		if err != nil {
+			return logError(status.Errorf(codes.Unknown, "cannot send event: %v", err))
+		}
+		log.Printf("send %v event of laptop with id: %s", event.GetType(), event.GetLaptop().GetId())
+	}
+}
+
 // UploadImage 上传laptop的图片
 func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServer) error {
 	//第一次接收图片信息
@@ -125,9 +416,12 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 		return logError(status.Errorf(codes.InvalidArgument, "laptop %s doesn't exist", laptopID))
 	}
 
-	//之后接收图片字节数据
-	imageData := bytes.Buffer{}
-	imageSize := 0 //图片大小，字节
+	//之后接收图片字节数据，直接写入临时文件
+	staged, err := newStagedImage()
+	if err != nil {
+		return logError(status.Errorf(codes.Internal, "cannot stage image: %v", err))
+	}
+	defer staged.remove()
 
 	for {
 		//判断context错误，在超时或客户端主动取消时，服务及时停止循环
@@ -148,44 +442,502 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 		size := len(chunk)
 		log.Printf("receive a chunk with size: %d", size)
 
-		imageSize += size
-		//图片大小不能超过1M
-		if imageSize > _maxImageSize {
-			return logError(status.Errorf(codes.InvalidArgument, "image is too large:%d > %d", imageSize, _maxImageSize))
+		//图片大小不能超过MaxImageSize
+		imageSize := staged.size + int64(size)
+		if imageSize > server.MaxImageSize {
+			return logError(status.Errorf(codes.InvalidArgument, "image is too large:%d > %d", imageSize, server.MaxImageSize))
 		}
 
 		//write slow
 		//time.Sleep(time.Second)
 
-		//写入buffer
-		_, err = imageData.Write(chunk)
+		//写入临时文件
+		_, err = staged.Write(chunk)
 		if err != nil {
 			return logError(status.Errorf(codes.Internal, "cannot write chunk data: %v", err))
 		}
 	}
 
-	imageID, err := server.ImageStore.Save(laptopID, imageType, imageData)
+	checksum := staged.checksum()
+	err = checkImageChecksum(req.GetInfo().GetChecksum(), checksum)
+	if err != nil {
+		return logError(err)
+	}
+	info, err := server.saveImage(laptopID, imageType, staged)
 	if err != nil {
-		return logError(status.Errorf(codes.Internal, "cannot save image to store: %v", err))
+		return logError(err)
 	}
 
 	//最后服务端一次性将结果返回并关闭流
-	res := &pb.UploadImageResponse{
-		Id:   imageID,
-		Size: uint32(imageSize),
-	}
-	err = stream.SendAndClose(res)
+	err = stream.SendAndClose(uploadImageResponse(info, checksum))
 	if err != nil {
 		return logError(status.Errorf(codes.Unknown, "cannot send response: %v", err))
 	}
 
-	log.Printf("save image with id: %s, size: %d", imageID, imageSize)
+	log.Printf("save image with id: %s, size: %d, checksum: %s", info.ID, info.Size, info.Checksum)
+
+	return nil
+}
+
+// checkImageChecksum 客户端提供了checksum时，校验接收的内容是否完整
+func checkImageChecksum(expected, checksum string) error {
+	if expected != "" && !strings.EqualFold(expected, checksum) {
+		return status.Errorf(codes.InvalidArgument, "image checksum mismatch: expected %s, got %s", expected, checksum)
+	}
+	return nil
+}
+
+// saveImage 校验暂存的图片内容后保存到ImageStore并提交生成缩略图的任务，返回保存的图片信息
+func (server *LaptopServer) saveImage(laptopID, imageType string, staged *stagedImage) (*ImageInfo, error) {
+	src, err := staged.reader()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot read staged image: %v", err)
+	}
+	//不信任客户端提供的图片类型，根据图片内容识别格式并去除EXIF等元数据
+	data, mimeType, err := normalizeImage(imageType, src, _maxImageDimension)
+	if errors.Is(err, ErrInvalidImage) {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot accept image: %v", err)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot read staged image: %v", err)
+	}
+	defer data.Close()
+
+	imageID, err := server.ImageStore.Save(laptopID, strings.ToLower(imageType), mimeType, data)
+	if errors.Is(err, ErrInvalidImage) {
+		//去除元数据时才发现图片数据不完整
+		return nil, status.Errorf(codes.InvalidArgument, "cannot accept image: %v", err)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot save image to store: %v", err)
+	}
+	//保存的内容去除了元数据，大小和checksum需要从存储器中读取
+	info, err := server.ImageStore.Find(imageID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find saved image: %v", err)
+	}
+	if info == nil {
+		return nil, status.Errorf(codes.Aborted, "image %s is deleted while saving", imageID)
+	}
+	if server.ImageResizer != nil && !server.ImageResizer.Submit(imageID) {
+		log.Printf("resize queue is full, skip generating variants of image %s", imageID)
+	}
+	return info, nil
+}
+
+// uploadImageResponse 上传图片的响应，receivedChecksum为服务器接收的原始内容的SHA-256
+func uploadImageResponse(info *ImageInfo, receivedChecksum string) *pb.UploadImageResponse {
+	return &pb.UploadImageResponse{
+		Id:               info.ID,
+		Size:             uint32(info.Size),
+		Checksum:         info.Checksum,
+		ReceivedChecksum: receivedChecksum,
+	}
+}
+
+// DownloadImage 服务端流模式下载图片，第一次发送图片信息，之后分chunk发送图片字节数据
+func (server *LaptopServer) DownloadImage(req *pb.DownloadImageRequest, stream pb.LaptopService_DownloadImageServer) error {
+	log.Printf("receive a download-image request for laptop %s with image id %s", req.GetLaptopId(), req.GetImageId())
+
+	info, reader, err := server.openImage(req.GetLaptopId(), req.GetImageId(), req.GetSize())
+	if err != nil {
+		return logError(err)
+	}
+	defer reader.Close()
+
+	err = stream.Send(&pb.DownloadImageResponse{
+		Data: &pb.DownloadImageResponse_Info{
+			Info: &pb.ImageInfo{
+				LaptopId:    info.LaptopID,
+				ImageType:   info.Type,
+				Size:        uint32(info.Size),
+				MimeType:    info.MIMEType,
+				VariantSize: uint32(info.Variant),
+				Checksum:    info.Checksum,
+			},
+		},
+	})
+	if err != nil {
+		return logError(status.Errorf(codes.Unknown, "cannot send image info: %v", err))
+	}
+
+	buffer := make([]byte, _imageChunkSize)
+	for {
+		if err := contextErr(stream.Context()); err != nil {
+			return err
+		}
 
+		n, err := reader.Read(buffer)
+		if n > 0 {
+			err := stream.Send(&pb.DownloadImageResponse{
+				Data: &pb.DownloadImageResponse_ChunkData{
+					ChunkData: buffer[:n],
+				},
+			})
+			if err != nil {
+				return logError(status.Errorf(codes.Unknown, "cannot send chunk data: %v", err))
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return logError(status.Errorf(codes.Internal, "cannot read image: %v", err))
+		}
+	}
+
+	log.Printf("sent image with id: %s, size: %d", req.GetImageId(), info.Size)
 	return nil
 }
 
-// RateLaptop 提交laptop评分
+// GetImage 通过REST接口获取图片，直接返回图片内容，Content-Type由图片类型决定
+func (server *LaptopServer) GetImage(ctx context.Context, req *pb.GetImageRequest) (*httpbody.HttpBody, error) {
+	log.Printf("receive a get-image request for laptop %s with image id %s", req.GetLaptopId(), req.GetImageId())
+
+	info, reader, err := server.openImage(req.GetLaptopId(), req.GetImageId(), req.GetSize())
+	if err != nil {
+		return nil, logError(err)
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot read image: %v", err))
+	}
+	return &httpbody.HttpBody{
+		ContentType: imageContentType(info),
+		Data:        data,
+	}, nil
+}
+
+// GetImageUrl 返回图片的临时下载链接，缩略图尚未生成或原图不大于size时返回原图的链接
+func (server *LaptopServer) GetImageUrl(ctx context.Context, req *pb.GetImageUrlRequest) (*pb.GetImageUrlResponse, error) {
+	log.Printf("receive a get-image-url request for laptop %s with image id %s", req.GetLaptopId(), req.GetImageId())
+
+	presigner, ok := server.ImageStore.(ImagePresigner)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "image store does not support download urls")
+	}
+	size := int(req.GetSize())
+	if size != 0 && !isVariantSize(size) {
+		return nil, status.Errorf(codes.InvalidArgument, "image size must be one of %v", ImageVariantSizes)
+	}
+	info, err := server.ImageStore.Find(req.GetImageId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find image: %v", err)
+	}
+	if info == nil || info.LaptopID != req.GetLaptopId() {
+		return nil, status.Errorf(codes.NotFound, "image %s is not exist", req.GetImageId())
+	}
+	if !containsInt(info.Variants, size) {
+		size = 0
+	}
+
+	expireTime := time.Now().Add(_imageURLExpiry)
+	url, err := presigner.PresignImage(info.ID, size, _imageURLExpiry)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot presign image: %v", err)
+	}
+	return &pb.GetImageUrlResponse{
+		Url:         url,
+		ExpireTime:  timestamppb.New(expireTime),
+		VariantSize: uint32(size),
+	}, nil
+}
+
+// ListLaptopImages 查询laptop的所有图片
+func (server *LaptopServer) ListLaptopImages(ctx context.Context, req *pb.ListLaptopImagesRequest) (*pb.ListLaptopImagesResponse, error) {
+	log.Printf("receive a list-laptop-images request for laptop %s", req.GetLaptopId())
+
+	if server.ImageStore == nil {
+		return nil, status.Error(codes.Unimplemented, "image store is not configured")
+	}
+	laptop, err := server.LaptopStore.Find(req.GetLaptopId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+	}
+	if laptop == nil {
+		return nil, status.Errorf(codes.NotFound, "laptop %s is not exist", req.GetLaptopId())
+	}
+
+	images, err := server.ImageStore.ListByLaptop(req.GetLaptopId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list images: %v", err)
+	}
+	res := &pb.ListLaptopImagesResponse{}
+	for _, info := range images {
+		image := &pb.LaptopImage{
+			Id:        info.ID,
+			LaptopId:  info.LaptopID,
+			ImageType: info.Type,
+			Size:      uint32(info.Size),
+			CreatedAt: timestamppb.New(info.CreatedAt),
+			MimeType:  info.MIMEType,
+			Checksum:  info.Checksum,
+		}
+		for _, size := range info.Variants {
+			image.VariantSizes = append(image.VariantSizes, uint32(size))
+		}
+		res.Images = append(res.Images, image)
+	}
+	return res, nil
+}
+
+// DeleteImage 删除laptop的图片
+func (server *LaptopServer) DeleteImage(ctx context.Context, req *pb.DeleteImageRequest) (*pb.DeleteImageResponse, error) {
+	log.Printf("receive a delete-image request for laptop %s with image id %s", req.GetLaptopId(), req.GetImageId())
+
+	if server.ImageStore == nil {
+		return nil, status.Error(codes.Unimplemented, "image store is not configured")
+	}
+	info, err := server.ImageStore.Find(req.GetImageId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find image: %v", err)
+	}
+	if info == nil || info.LaptopID != req.GetLaptopId() {
+		return nil, status.Errorf(codes.NotFound, "image %s is not exist", req.GetImageId())
+	}
+
+	err = server.ImageStore.Delete(req.GetImageId())
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot delete image: %v", err)
+	}
+
+	log.Printf("deleted image with id: %s", req.GetImageId())
+	return &pb.DeleteImageResponse{ImageId: req.GetImageId()}, nil
+}
+
+// deleteLaptopImages 删除laptop的所有图片，laptop已经被删除，失败时只记录日志
+func (server *LaptopServer) deleteLaptopImages(laptopID string) {
+	if server.ImageStore == nil {
+		return
+	}
+	images, err := server.ImageStore.ListByLaptop(laptopID)
+	if err != nil {
+		log.Printf("cannot list images of laptop %s: %v", laptopID, err)
+		return
+	}
+	for _, info := range images {
+		err := server.ImageStore.Delete(info.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("cannot delete image %s of laptop %s: %v", info.ID, laptopID, err)
+		}
+	}
+}
+
+// openImage 打开laptop的图片，size不为0时优先打开该尺寸的缩略图，图片不存在或不属于该laptop时返回NotFound
+func (server *LaptopServer) openImage(laptopID, imageID string, size uint32) (*ImageInfo, io.ReadCloser, error) {
+	if server.ImageStore == nil {
+		return nil, nil, status.Error(codes.Unimplemented, "image store is not configured")
+	}
+	if size != 0 && !isVariantSize(int(size)) {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "image size must be one of %v", ImageVariantSizes)
+	}
+
+	var info *ImageInfo
+	var reader io.ReadCloser
+	err := ErrNotFound
+	if size != 0 {
+		info, reader, err = server.ImageStore.OpenVariant(imageID, int(size))
+	}
+	if errors.Is(err, ErrNotFound) {
+		//缩略图尚未生成或原图不大于size时返回原图
+		info, reader, err = server.ImageStore.Open(imageID)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, status.Errorf(codes.NotFound, "image %s is not exist", imageID)
+	}
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "cannot open image: %v", err)
+	}
+	if info.LaptopID != laptopID {
+		reader.Close()
+		return nil, nil, status.Errorf(codes.NotFound, "image %s is not exist", imageID)
+	}
+	return info, reader, nil
+}
+
+// imageContentType 优先使用识别的MIME类型，没有时根据图片类型(扩展名)获取，未知类型时为application/octet-stream
+func imageContentType(info *ImageInfo) string {
+	if info.MIMEType != "" {
+		return info.MIMEType
+	}
+	contentType := mime.TypeByExtension(strings.ToLower(info.Type))
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	return contentType
+}
+
+// CreateImageUpload 新建断点续传的上传会话
+func (server *LaptopServer) CreateImageUpload(ctx context.Context, req *pb.CreateImageUploadRequest) (*pb.ImageUpload, error) {
+	if server.UploadStore == nil {
+		return nil, status.Error(codes.Unimplemented, "upload store is not configured")
+	}
+	laptopID := req.GetInfo().GetLaptopId()
+	log.Printf("receive a create-image-upload request for laptop %s with image type %s", laptopID, req.GetInfo().GetImageType())
+
+	laptop, err := server.LaptopStore.Find(laptopID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+	}
+	if laptop == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "laptop %s doesn't exist", laptopID)
+	}
+
+	session, err := server.UploadStore.Create(laptopID, req.GetInfo().GetImageType(), req.GetInfo().GetChecksum())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot create upload: %v", err)
+	}
+	log.Printf("created upload with id: %s", session.ID)
+	return toImageUpload(session), nil
+}
+
+// UploadImageChunks 客户端流模式上传数据块，每个数据块接收后立即写入上传会话，
+// 流中断时已接收的数据块不会丢失，结束流后返回最后一个数据块所属的上传会话
+func (server *LaptopServer) UploadImageChunks(stream pb.LaptopService_UploadImageChunksServer) error {
+	if server.UploadStore == nil {
+		return status.Error(codes.Unimplemented, "upload store is not configured")
+	}
+
+	var session *UploadSession
+	for {
+		if err := contextErr(stream.Context()); err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return logError(status.Errorf(codes.Unknown, "cannot receive chunk data: %v", err))
+		}
+
+		offset := req.GetOffset()
+		chunk := req.GetChunkData()
+		if offset > uint64(server.MaxImageSize) || offset+uint64(len(chunk)) > uint64(server.MaxImageSize) {
+			return logError(status.Errorf(codes.InvalidArgument, "image is too large:%d > %d", offset+uint64(len(chunk)), server.MaxImageSize))
+		}
+		session, err = server.UploadStore.Append(req.GetUploadId(), int64(offset), chunk)
+		if errors.Is(err, ErrNotFound) {
+			return logError(status.Errorf(codes.NotFound, "upload %s is not exist", req.GetUploadId()))
+		}
+		if errors.Is(err, ErrOffsetMismatch) {
+			return logError(status.Errorf(codes.FailedPrecondition, "cannot append chunk: %v", err))
+		}
+		if err != nil {
+			return logError(status.Errorf(codes.Internal, "cannot append chunk: %v", err))
+		}
+	}
+	if session == nil {
+		return logError(status.Error(codes.InvalidArgument, "no chunk received"))
+	}
+
+	err := stream.SendAndClose(toImageUpload(session))
+	if err != nil {
+		return logError(status.Errorf(codes.Unknown, "cannot send response: %v", err))
+	}
+	return nil
+}
+
+// GetImageUpload 查询上传会话已接收的字节数，断线重连后从该位置继续上传
+func (server *LaptopServer) GetImageUpload(ctx context.Context, req *pb.GetImageUploadRequest) (*pb.ImageUpload, error) {
+	if server.UploadStore == nil {
+		return nil, status.Error(codes.Unimplemented, "upload store is not configured")
+	}
+	session, err := server.UploadStore.Find(req.GetUploadId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find upload: %v", err)
+	}
+	if session == nil {
+		return nil, status.Errorf(codes.NotFound, "upload %s is not exist", req.GetUploadId())
+	}
+	return toImageUpload(session), nil
+}
+
+// FinishImageUpload 校验并保存上传会话已接收的全部数据，成功后删除上传会话，
+// 校验失败时保留上传会话，客户端可以补充数据后重试
+func (server *LaptopServer) FinishImageUpload(ctx context.Context, req *pb.FinishImageUploadRequest) (*pb.UploadImageResponse, error) {
+	if server.UploadStore == nil {
+		return nil, status.Error(codes.Unimplemented, "upload store is not configured")
+	}
+	log.Printf("receive a finish-image-upload request with upload id %s", req.GetUploadId())
+
+	session, reader, err := server.UploadStore.Open(req.GetUploadId())
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "upload %s is not exist", req.GetUploadId())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot open upload: %v", err)
+	}
+	//复制到临时文件后再校验，完成上传期间客户端仍可能继续写入上传会话
+	staged, err := newStagedImage()
+	if err != nil {
+		reader.Close()
+		return nil, status.Errorf(codes.Internal, "cannot stage image: %v", err)
+	}
+	defer staged.remove()
+	_, err = io.Copy(staged, reader)
+	reader.Close()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot read upload: %v", err)
+	}
+
+	checksum := staged.checksum()
+	err = checkImageChecksum(session.Checksum, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	//上传期间laptop可能已被删除
+	laptop, err := server.LaptopStore.Find(session.LaptopID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+	}
+	if laptop == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "laptop %s doesn't exist", session.LaptopID)
+	}
+
+	info, err := server.saveImage(session.LaptopID, session.ImageType, staged)
+	if err != nil {
+		return nil, err
+	}
+	err = server.UploadStore.Delete(session.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("cannot delete upload %s: %v", session.ID, err)
+	}
+
+	log.Printf("save image with id: %s, size: %d, checksum: %s", info.ID, info.Size, info.Checksum)
+	return uploadImageResponse(info, checksum), nil
+}
+
+// toImageUpload 将上传会话转换为响应
+func toImageUpload(session *UploadSession) *pb.ImageUpload {
+	return &pb.ImageUpload{
+		UploadId:   session.ID,
+		LaptopId:   session.LaptopID,
+		ImageType:  session.ImageType,
+		Offset:     uint64(session.Offset),
+		ExpireTime: timestamppb.New(session.ExpiresAt),
+	}
+}
+
+// RateLaptop 提交laptop评分，同一用户重复评分时替换之前的分数
 func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer) error {
+	username, err := currentUsername(stream.Context())
+	if err != nil {
+		return logError(err)
+	}
+
 	for {
 		//处理context错误
 		err := contextErr(stream.Context())
@@ -210,6 +962,21 @@ func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer)
 
 		log.Print("receive a rate-laptop request:", req)
 
+		//分数不合法时在响应中返回错误，继续处理之后的请求
+		err = server.RatingScale.Validate(score)
+		if err != nil {
+			log.Print(err)
+			res := &pb.RateLaptopResponse{
+				LaptopId: laptopID,
+				Error:    invalidScoreStatus(err).Proto(),
+			}
+			err = stream.Send(res)
+			if err != nil {
+				return logError(status.Errorf(codes.Unknown, "cannot send response: %v", err))
+			}
+			continue
+		}
+
 		//查询laptopID是否存在
 		laptop, err := server.LaptopStore.Find(laptopID)
 		if err != nil {
@@ -219,8 +986,20 @@ func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer)
 			return logError(status.Errorf(codes.InvalidArgument, "laptop is not exist"))
 		}
 
-		//写入rate store
-		rating, err := server.RateStore.Add(laptopID, score)
+		//写入rate store，已评价时评分以评价为准，在响应中返回错误，继续处理之后的请求
+		rating, err := server.RateStore.Rate(username, laptopID, score)
+		if errors.Is(err, ErrReviewedRating) {
+			log.Print(err)
+			res := &pb.RateLaptopResponse{
+				LaptopId: laptopID,
+				Error:    reviewedRatingStatus(laptopID, username).Proto(),
+			}
+			err = stream.Send(res)
+			if err != nil {
+				return logError(status.Errorf(codes.Unknown, "cannot send response: %v", err))
+			}
+			continue
+		}
 		if err != nil {
 			return logError(status.Errorf(codes.Internal, "cannot add rate to store: %v", err))
 		}
@@ -229,7 +1008,7 @@ func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer)
 		res := &pb.RateLaptopResponse{
 			LaptopId:     laptopID,
 			RatedCount:   rating.Count,
-			AverageScore: rating.Sum / float64(rating.Count),
+			AverageScore: rating.Average(),
 		}
 
 		err = stream.Send(res)
@@ -242,6 +1021,349 @@ func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer)
 	return nil
 }
 
+// GetMyRating 查询当前用户对laptop的评分
+func (server *LaptopServer) GetMyRating(ctx context.Context, req *pb.GetMyRatingRequest) (*pb.GetMyRatingResponse, error) {
+	log.Printf("receive a get-my-rating request: %v", req)
+
+	username, err := currentUsername(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rating, err := server.RateStore.FindUserRating(username, req.GetLaptopId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find rating: %v", err)
+	}
+	if rating == nil {
+		return nil, status.Errorf(codes.NotFound, "laptop %s is not rated by %s", req.GetLaptopId(), username)
+	}
+	return &pb.GetMyRatingResponse{
+		LaptopId: rating.LaptopID,
+		Score:    rating.Score,
+	}, nil
+}
+
+// DeleteMyRating 删除当前用户对laptop的评分
+func (server *LaptopServer) DeleteMyRating(ctx context.Context, req *pb.DeleteMyRatingRequest) (*pb.DeleteMyRatingResponse, error) {
+	log.Printf("receive a delete-my-rating request: %v", req)
+
+	username, err := currentUsername(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rating, err := server.RateStore.Delete(username, req.GetLaptopId())
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "laptop %s is not rated by %s", req.GetLaptopId(), username)
+	}
+	//评价中的分数必须计入laptop的评分，已评价时不能删除评分
+	if errors.Is(err, ErrReviewedRating) {
+		return nil, reviewedRatingStatus(req.GetLaptopId(), username).Err()
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot delete rating: %v", err)
+	}
+	return &pb.DeleteMyRatingResponse{
+		LaptopId:     req.GetLaptopId(),
+		RatedCount:   rating.Count,
+		AverageScore: rating.Average(),
+	}, nil
+}
+
+// GetRatingStats 查询laptop的评分统计
+func (server *LaptopServer) GetRatingStats(ctx context.Context, req *pb.GetRatingStatsRequest) (*pb.GetRatingStatsResponse, error) {
+	log.Printf("receive a get-rating-stats request: %v", req)
+
+	laptop, err := server.LaptopStore.Find(req.GetLaptopId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+	}
+	if laptop == nil {
+		return nil, status.Errorf(codes.NotFound, "laptop %s is not exist", req.GetLaptopId())
+	}
+
+	prior, err := server.priorScore()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find total rating: %v", err)
+	}
+	rating, err := server.RateStore.Find(req.GetLaptopId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find rating: %v", err)
+	}
+	return &pb.GetRatingStatsResponse{
+		Stats: ratingStats(req.GetLaptopId(), rating, prior, _ratingPriorWeight),
+	}, nil
+}
+
+// TopRatedLaptops 查询符合filter的laptop中加权评分最高的laptop，未被评分的laptop不参与排名
+func (server *LaptopServer) TopRatedLaptops(ctx context.Context, req *pb.TopRatedLaptopsRequest) (*pb.TopRatedLaptopsResponse, error) {
+	log.Printf("receive a top-rated-laptops request: %v", req)
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = _defaultTopRatedSize
+	}
+	if limit > _maxListPageSize {
+		limit = _maxListPageSize
+	}
+	prior, err := server.priorScore()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find total rating: %v", err)
+	}
+
+	options := SearchOptions{}
+	if req.GetFilter() == nil {
+		options.Match = func(laptop *pb.Laptop) bool {
+			return true
+		}
+	}
+	var rated []*pb.RatedLaptop
+	err = server.LaptopStore.Search(ctx, req.GetFilter(), options, func(laptop *pb.Laptop) error {
+		rating, err := server.RateStore.Find(laptop.GetId())
+		if err != nil {
+			return err
+		}
+		if rating == nil || rating.Count == 0 {
+			return nil
+		}
+		rated = append(rated, &pb.RatedLaptop{
+			Laptop: laptop,
+			Stats:  ratingStats(laptop.GetId(), rating, prior, _ratingPriorWeight),
+		})
+		return nil
+	})
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot search laptops: %v", err)
+	}
+
+	//加权评分相同时，评分次数多的排在前面
+	sort.Slice(rated, func(i, j int) bool {
+		a, b := rated[i].GetStats(), rated[j].GetStats()
+		if a.GetWeightedScore() != b.GetWeightedScore() {
+			return a.GetWeightedScore() > b.GetWeightedScore()
+		}
+		if a.GetCount() != b.GetCount() {
+			return a.GetCount() > b.GetCount()
+		}
+		return a.GetLaptopId() < b.GetLaptopId()
+	})
+	if len(rated) > limit {
+		rated = rated[:limit]
+	}
+
+	log.Printf("found %d top rated laptops", len(rated))
+	return &pb.TopRatedLaptopsResponse{Laptops: rated}, nil
+}
+
+// priorScore 加权评分的先验平均分，为所有laptop评分的平均值，没有任何评分时取评分范围的中间值
+func (server *LaptopServer) priorScore() (float64, error) {
+	total, err := server.RateStore.Total()
+	if err != nil {
+		return 0, err
+	}
+	if total.Count == 0 {
+		return (server.RatingScale.Min + server.RatingScale.Max) / 2, nil
+	}
+	return total.Average(), nil
+}
+
+// CreateReview 新建评价，评价的分数同时作为当前用户对laptop的评分
+func (server *LaptopServer) CreateReview(ctx context.Context, req *pb.CreateReviewRequest) (*pb.CreateReviewResponse, error) {
+	log.Printf("receive a create-review request for laptop: %s", req.GetLaptopId())
+
+	username, err := currentUsername(ctx)
+	if err != nil {
+		return nil, err
+	}
+	violations := server.validateReview(req)
+	if len(violations) > 0 {
+		return nil, badRequestStatus("invalid review", violations...).Err()
+	}
+
+	laptop, err := server.LaptopStore.Find(req.GetLaptopId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+	}
+	if laptop == nil {
+		return nil, status.Errorf(codes.NotFound, "laptop %s is not exist", req.GetLaptopId())
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate a new review ID: %v", err)
+	}
+	review := &pb.Review{
+		Id:        id.String(),
+		LaptopId:  req.GetLaptopId(),
+		Author:    username,
+		Score:     req.GetScore(),
+		Title:     req.GetTitle(),
+		Body:      req.GetBody(),
+		CreatedAt: timestamppb.Now(),
+	}
+	//评价和评分由ReviewStore同时写入，评价的分数替换该用户之前的评分，重复评价时评分不变
+	rating, err := server.ReviewStore.Save(review)
+	if errors.Is(err, ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "laptop %s is already reviewed by %s", req.GetLaptopId(), username)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot save review: %v", err)
+	}
+
+	log.Printf("saved review with id: %s", review.GetId())
+	return &pb.CreateReviewResponse{
+		Review:       review,
+		RatedCount:   rating.Count,
+		AverageScore: rating.Average(),
+	}, nil
+}
+
+// validateReview 校验评价的内容，返回所有不合法的字段
+func (server *LaptopServer) validateReview(req *pb.CreateReviewRequest) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	if err := server.RatingScale.Validate(req.GetScore()); err != nil {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: "score", Description: err.Error()})
+	}
+	title := strings.TrimSpace(req.GetTitle())
+	if title == "" {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: "title", Description: "title must not be empty"})
+	} else if utf8.RuneCountInString(title) > _maxReviewTitleSize {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "title",
+			Description: fmt.Sprintf("title must not be longer than %d characters", _maxReviewTitleSize),
+		})
+	}
+	if utf8.RuneCountInString(req.GetBody()) > _maxReviewBodySize {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       "body",
+			Description: fmt.Sprintf("body must not be longer than %d characters", _maxReviewBodySize),
+		})
+	}
+	return violations
+}
+
+// ListReviews 分页查询laptop的评价
+func (server *LaptopServer) ListReviews(ctx context.Context, req *pb.ListReviewsRequest) (*pb.ListReviewsResponse, error) {
+	log.Printf("receive a list-reviews request: %v", req)
+
+	pageSize := int(req.GetPageSize())
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page size must not be negative: %d", pageSize)
+	}
+	if pageSize == 0 {
+		pageSize = _defaultListPageSize
+	}
+	if pageSize > _maxListPageSize {
+		pageSize = _maxListPageSize
+	}
+
+	order := ReviewOrderNewest
+	switch req.GetOrder() {
+	case pb.ListReviewsRequest_NEWEST:
+	case pb.ListReviewsRequest_MOST_HELPFUL:
+		order = ReviewOrderMostHelpful
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown order: %v", req.GetOrder())
+	}
+
+	var after *pb.Review
+	if req.GetPageToken() != "" {
+		after = &pb.Review{}
+		err := decodeCursor(order.String(), req.GetPageToken(), after)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "cannot parse page token: %v", err)
+		}
+	}
+
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+
+	//多查询一条，用于判断是否还有下一页
+	reviews, err := server.ReviewStore.List(ctx, req.GetLaptopId(), order, after, pageSize+1)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list reviews: %v", err)
+	}
+
+	res := &pb.ListReviewsResponse{}
+	if len(reviews) > pageSize {
+		reviews = reviews[:pageSize]
+		res.NextPageToken, err = encodeCursor(order.String(), order.cursor(reviews[pageSize-1]))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot generate page token: %v", err)
+		}
+	}
+	res.Reviews = reviews
+
+	log.Printf("list %d reviews", len(reviews))
+	return res, nil
+}
+
+// VoteReviewHelpful 当前用户投票认为评价有帮助，每个用户只能投一次，不能给自己的评价投票
+func (server *LaptopServer) VoteReviewHelpful(ctx context.Context, req *pb.VoteReviewHelpfulRequest) (*pb.VoteReviewHelpfulResponse, error) {
+	log.Printf("receive a vote-review-helpful request: %v", req)
+
+	username, err := currentUsername(ctx)
+	if err != nil {
+		return nil, err
+	}
+	review, err := server.ReviewStore.Find(req.GetReviewId())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find review: %v", err)
+	}
+	if review == nil {
+		return nil, status.Errorf(codes.NotFound, "review %s is not exist", req.GetReviewId())
+	}
+	if review.GetAuthor() == username {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot vote for own review")
+	}
+
+	review, err = server.ReviewStore.Vote(req.GetReviewId(), username)
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "review %s is not exist", req.GetReviewId())
+	}
+	if errors.Is(err, ErrAlreadyExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "review %s is already voted by %s", req.GetReviewId(), username)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot vote review: %v", err)
+	}
+	return &pb.VoteReviewHelpfulResponse{
+		ReviewId:     review.GetId(),
+		HelpfulVotes: review.GetHelpfulVotes(),
+	}, nil
+}
+
+// invalidScoreStatus 构造分数不合法的错误，包含BadRequest详情
+func invalidScoreStatus(err error) *status.Status {
+	return badRequestStatus("invalid score", &errdetails.BadRequest_FieldViolation{Field: "score", Description: err.Error()})
+}
+
+// reviewedRatingStatus 构造用户已评价laptop、不能单独修改或删除评分的错误
+func reviewedRatingStatus(laptopID, username string) *status.Status {
+	return status.Newf(codes.FailedPrecondition, "rating of laptop %s is part of the review by %s", laptopID, username)
+}
+
+// badRequestStatus 构造InvalidArgument错误，包含不合法字段的BadRequest详情
+func badRequestStatus(message string, violations ...*errdetails.BadRequest_FieldViolation) *status.Status {
+	st := status.New(codes.InvalidArgument, message)
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+// currentUsername 获取鉴权拦截器保存在context中的用户名
+func currentUsername(ctx context.Context) (string, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.Username == "" {
+		return "", status.Errorf(codes.Unauthenticated, "user is not authenticated")
+	}
+	return claims.Username, nil
+}
+
 // logError 记录错误日志
 func logError(err error) error {
 	if err != nil {
@@ -4,33 +4,63 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/jinzhu/copier"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"log"
 	"pcbook/pb"
+	"pcbook/query"
+	"sort"
+	"strings"
 	"sync"
 )
 
 var ErrAlreadyExists = errors.New("record already exists")
 
+var ErrNotFound = errors.New("record not found")
+
+var ErrRevisionMismatch = errors.New("record revision mismatch")
+
 //LaptopStore 笔记本存储器接口
 type LaptopStore interface {
-	//Save 保存数据
+	//Save 保存数据，同时设置update_at，并将revision初始化为1
 	Save(laptop *pb.Laptop) error
 	//Find 根据id查找laptop
 	Find(id string) (*pb.Laptop, error)
-	//Search 根据filter筛选，其中found为回调函数
-	Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error
+	//Update 更新已存在的laptop，mask为空时整体替换，否则只更新mask中指定的字段，返回更新后的laptop
+	//revision不为0且与存储的版本号不一致时返回ErrRevisionMismatch，更新成功后update_at会被刷新，revision加1
+	Update(laptop *pb.Laptop, mask *fieldmaskpb.FieldMask, revision uint64) (*pb.Laptop, error)
+	//Delete 根据id删除laptop
+	Delete(id string) error
+	//List 按order排序，返回排在after之后的最多limit个laptop，after为nil时从头开始
+	List(ctx context.Context, order LaptopOrder, after *pb.Laptop, limit int) ([]*pb.Laptop, error)
+	//Aggregate 统计符合filter的laptop的分面数量及价格
+	Aggregate(ctx context.Context, filter *pb.Filter) (*pb.LaptopAggregation, error)
+	//Search 根据filter筛选，按options排序及限制数量，其中found为回调函数
+	Search(ctx context.Context, filter *pb.Filter, options SearchOptions, found func(laptop *pb.Laptop) error) error
+}
+
+//SearchOptions 搜索结果的排序及数量限制
+type SearchOptions struct {
+	Order      LaptopOrder                   //排序规则，为空时不排序
+	MaxResults int                           //最多返回的数量，为0时不限制
+	Rating     func(laptopID string) float64 //查询laptop的平均评分，按rating排序时使用
+	Match      func(laptop *pb.Laptop) bool  //不为空时代替filter判断laptop是否符合条件
 }
 
 //InMemoryLaptopStore 内存存储器，使用map存储
+//map中的laptop写入后不会再被修改，更新时整体替换，因此释放锁之后仍可以安全地读取已取出的laptop
 type InMemoryLaptopStore struct {
-	mutex sync.RWMutex //开箱即用的
-	data  map[string]*pb.Laptop
+	mutex   sync.RWMutex //开箱即用的
+	data    map[string]*pb.Laptop
+	indexes *laptopIndexes //价格、cpu、内存的有序索引，用于范围筛选
+	wal     mutationLog    //不为nil时，修改数据之前先记录变更
 }
 
 func NewInMemoryLaptopStore() *InMemoryLaptopStore {
 	return &InMemoryLaptopStore{
-		data: make(map[string]*pb.Laptop),
+		data:    make(map[string]*pb.Laptop),
+		indexes: newLaptopIndexes(),
 	}
 }
 
@@ -43,13 +73,19 @@ func (store *InMemoryLaptopStore) Save(laptop *pb.Laptop) error {
 		return ErrAlreadyExists
 	}
 	//由于形参和map的value都是指针类型，为了防止外部指针变量指向的内容被修改时，影响到已存储在map中的value
-	//需要利用copier进行deep copy，进而把二者彻底分开
+	//需要进行deep copy，进而把二者彻底分开
 
 	other, err := deepCopy(laptop)
 	if err != nil {
 		return err
 	}
-	store.data[other.Id] = other
+	other.UpdateAt = timestamppb.Now()
+	other.Revision = 1
+	err = appendMutation(store.wal, &pb.StoreMutation{Mutation: &pb.StoreMutation_PutLaptop{PutLaptop: other}})
+	if err != nil {
+		return err
+	}
+	store.put(other)
 	return nil
 }
 
@@ -67,35 +103,246 @@ func (store *InMemoryLaptopStore) Find(id string) (*pb.Laptop, error) {
 	return deepCopy(laptop)
 }
 
-func (store *InMemoryLaptopStore) Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error {
+func (store *InMemoryLaptopStore) Update(laptop *pb.Laptop, mask *fieldmaskpb.FieldMask, revision uint64) (*pb.Laptop, error) {
+	//加写锁，读取和修改在同一个锁内完成，避免并发更新互相覆盖
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	//id不存在，则返回错误
+	old := store.data[laptop.Id]
+	if old == nil {
+		return nil, ErrNotFound
+	}
+	other, err := updatedLaptop(old, laptop, mask, revision)
+	if err != nil {
+		return nil, err
+	}
+	err = appendMutation(store.wal, &pb.StoreMutation{Mutation: &pb.StoreMutation_PutLaptop{PutLaptop: other}})
+	if err != nil {
+		return nil, err
+	}
+	store.put(other)
+	return deepCopy(other)
+}
+
+//updatedLaptop 根据mask将laptop合并到old的副本中，并刷新update_at和revision，不会修改old
+//revision不为0且与old的版本号不一致时返回ErrRevisionMismatch
+func updatedLaptop(old, laptop *pb.Laptop, mask *fieldmaskpb.FieldMask, revision uint64) (*pb.Laptop, error) {
+	//乐观锁，版本号不一致说明在此期间已被其他人修改
+	if revision != 0 && revision != old.Revision {
+		return nil, fmt.Errorf("%w: expected %d, actual %d", ErrRevisionMismatch, revision, old.Revision)
+	}
+
+	var other *pb.Laptop
+	var err error
+	if len(mask.GetPaths()) == 0 {
+		other, err = deepCopy(laptop)
+	} else {
+		//在副本上合并字段，路径不合法时不影响已存储的数据
+		other, err = deepCopy(old)
+		if err != nil {
+			return nil, err
+		}
+		err = applyFieldMask(other, laptop, mask)
+	}
+	if err != nil {
+		return nil, err
+	}
+	other.UpdateAt = timestamppb.Now()
+	other.Revision = old.Revision + 1
+	return other, nil
+}
+
+func (store *InMemoryLaptopStore) Delete(id string) error {
+	//加写锁
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	//id不存在，则返回错误
+	if store.data[id] == nil {
+		return ErrNotFound
+	}
+	err := appendMutation(store.wal, &pb.StoreMutation{Mutation: &pb.StoreMutation_DeleteLaptopId{DeleteLaptopId: id}})
+	if err != nil {
+		return err
+	}
+	store.remove(id)
+	return nil
+}
+
+//put 保存或替换laptop，并同步更新索引，调用方需持有写锁
+func (store *InMemoryLaptopStore) put(laptop *pb.Laptop) {
+	if old := store.data[laptop.Id]; old != nil {
+		store.indexes.remove(old)
+	}
+	store.data[laptop.Id] = laptop
+	store.indexes.insert(laptop)
+}
+
+//remove 删除laptop，并同步更新索引，调用方需持有写锁
+func (store *InMemoryLaptopStore) remove(id string) {
+	if old := store.data[id]; old != nil {
+		store.indexes.remove(old)
+		delete(store.data, id)
+	}
+}
+
+func (store *InMemoryLaptopStore) List(ctx context.Context, order LaptopOrder, after *pb.Laptop, limit int) ([]*pb.Laptop, error) {
 	//加读锁
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	//遍历筛选符合条件的laptop
+	//筛选出排在after之后的laptop
+	laptops := make([]*pb.Laptop, 0, len(store.data))
 	for _, laptop := range store.data {
-		//heavy processing
-		//time.Sleep(1 * time.Second)
-		log.Printf("checking laptop id: %s", laptop.GetId())
+		if after == nil || order.Compare(laptop, after) > 0 {
+			laptops = append(laptops, laptop)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(laptops, func(i, j int) bool {
+		return order.Compare(laptops[i], laptops[j]) < 0
+	})
+	if len(laptops) > limit {
+		laptops = laptops[:limit]
+	}
+
+	//deep copy
+	result := make([]*pb.Laptop, len(laptops))
+	for i, laptop := range laptops {
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = other
+	}
+	return result, nil
+}
+
+func (store *InMemoryLaptopStore) Search(ctx context.Context, filter *pb.Filter, options SearchOptions, found func(laptop *pb.Laptop) error) error {
+	//只在读锁内筛选，回调在释放锁之后执行，避免客户端接收过慢时阻塞写操作
+	laptops, err := store.match(ctx, filter, options)
+	if err != nil {
+		return err
+	}
+
+	if len(options.Order) > 0 {
+		laptops = sortLaptops(laptops, options)
+	}
+
+	for _, laptop := range laptops {
 		//如果超时或客户端ctrl+c,则结束循环,避免浪费服务器资源
 		if ctx.Err() == context.DeadlineExceeded || ctx.Err() == context.Canceled {
 			log.Print("context is canceled")
 			return errors.New("context is canceled")
 		}
-		if isQualified(filter, laptop) {
-			//deep copy
-			other, err := deepCopy(laptop)
-			if err != nil {
-				return err
+		err := sendLaptop(laptop, found)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//sortLaptops 按options排序，并只保留前MaxResults个
+func sortLaptops(laptops []*pb.Laptop, options SearchOptions) []*pb.Laptop {
+	//缓存评分，避免排序时重复查询
+	var rating func(laptopID string) float64
+	if options.Rating != nil {
+		ratings := make(map[string]float64)
+		rating = func(laptopID string) float64 {
+			value, ok := ratings[laptopID]
+			if !ok {
+				value = options.Rating(laptopID)
+				ratings[laptopID] = value
 			}
-			//调用回调函数
-			err = found(other)
-			if err != nil {
-				return err
+			return value
+		}
+	}
+	sort.Slice(laptops, func(i, j int) bool {
+		return options.Order.CompareWithRating(laptops[i], laptops[j], rating) < 0
+	})
+	if options.MaxResults > 0 && len(laptops) > options.MaxResults {
+		laptops = laptops[:options.MaxResults]
+	}
+	return laptops
+}
+
+//match 在读锁内筛选符合条件的laptop，不需要排序时最多返回MaxResults个
+//使用filter时只遍历索引中的候选laptop，使用Match时需要遍历全部
+func (store *InMemoryLaptopStore) match(ctx context.Context, filter *pb.Filter, options SearchOptions) ([]*pb.Laptop, error) {
+	//加读锁
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	limit := options.MaxResults
+	if len(options.Order) > 0 {
+		limit = 0
+	}
+
+	var laptops []*pb.Laptop
+	check := func(laptop *pb.Laptop, qualified func(laptop *pb.Laptop) bool) (bool, error) {
+		//如果超时或客户端ctrl+c,则结束循环,避免浪费服务器资源
+		if ctx.Err() == context.DeadlineExceeded || ctx.Err() == context.Canceled {
+			log.Print("context is canceled")
+			return false, errors.New("context is canceled")
+		}
+		if qualified(laptop) {
+			laptops = append(laptops, laptop)
+		}
+		return limit > 0 && len(laptops) >= limit, nil
+	}
+
+	if options.Match != nil {
+		for _, laptop := range store.data {
+			done, err := check(laptop, options.Match)
+			if done || err != nil {
+				return laptops, err
 			}
 		}
+		return laptops, nil
 	}
-	return nil
+
+	qualified := func(laptop *pb.Laptop) bool {
+		return isQualified(filter, laptop)
+	}
+	for _, entry := range store.indexes.candidates(filter) {
+		done, err := check(store.data[entry.id], qualified)
+		if done || err != nil {
+			return laptops, err
+		}
+	}
+	return laptops, nil
+}
+
+//sendLaptop 深拷贝laptop后调用回调函数
+func sendLaptop(laptop *pb.Laptop, found func(laptop *pb.Laptop) error) error {
+	//deep copy
+	other, err := deepCopy(laptop)
+	if err != nil {
+		return err
+	}
+	//调用回调函数
+	return found(other)
+}
+
+func (store *InMemoryLaptopStore) Aggregate(ctx context.Context, filter *pb.Filter) (*pb.LaptopAggregation, error) {
+	//加读锁
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	aggregator := NewLaptopAggregator()
+	for _, laptop := range store.data {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if isQualified(filter, laptop) {
+			aggregator.Add(laptop)
+		}
+	}
+	return aggregator.Result(), nil
 }
 
 //isQualified 判断laptop是否满足filter的要求
@@ -109,38 +356,100 @@ func isQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
 	if laptop.GetCpu().GetMinGhz() < filter.GetMinCpuGhz() {
 		return false
 	}
-	if toBit(laptop.GetRam()) < toBit(filter.GetMinRam()) {
+	if query.MemoryBits(laptop.GetRam()) < query.MemoryBits(filter.GetMinRam()) {
+		return false
+	}
+	if laptop.GetPriceUsed() < filter.GetMinPriceUsed() {
+		return false
+	}
+	if !containsFold(filter.GetBrands(), laptop.GetBrand()) {
+		return false
+	}
+	if !containsFold(filter.GetCpuBrands(), laptop.GetCpu().GetBrand()) {
+		return false
+	}
+	if filter.GetMinGpuMemory() != nil && maxGPUMemory(laptop) < query.MemoryBits(filter.GetMinGpuMemory()) {
+		return false
+	}
+	if filter.GetMinSsdStorage() != nil && ssdStorage(laptop) < query.MemoryBits(filter.GetMinSsdStorage()) {
+		return false
+	}
+	if !isScreenQualified(filter, laptop.GetScreen()) {
+		return false
+	}
+	if filter.GetBacklitKeyboard() && !laptop.GetKeyborad().GetBacklit() {
+		return false
+	}
+	if filter.GetMaxWeightKg() > 0 {
+		weight, ok := query.WeightKg(laptop)
+		if !ok || weight > filter.GetMaxWeightKg() {
+			return false
+		}
+	}
+	if laptop.GetReleaseYear() < filter.GetMinReleaseYear() {
+		return false
+	}
+	if filter.GetMaxReleaseYear() > 0 && laptop.GetReleaseYear() > filter.GetMaxReleaseYear() {
 		return false
 	}
 	return true
 }
 
-//toBit 将内存大小单位转换为bit
-func toBit(memory *pb.Memory) uint64 {
-	value := memory.GetValue()
-	switch memory.GetUnit() {
-	case pb.Memory_BIT:
-		return value
-	case pb.Memory_BYTE:
-		return value << 3
-	case pb.Memory_KILOBYTE:
-		return value << 13
-	case pb.Memory_MEGABYTE:
-		return value << 23
-	case pb.Memory_GIGABYTE:
-		return value << 33
-	case pb.Memory_TERABYTE:
-		return value << 43
-	default:
-		return 0
+//isScreenQualified 判断屏幕是否满足filter的要求
+func isScreenQualified(filter *pb.Filter, screen *pb.Screen) bool {
+	if screen.GetSizeInch() < filter.GetMinScreenSizeInch() {
+		return false
 	}
+	if filter.GetMaxScreenSizeInch() > 0 && screen.GetSizeInch() > filter.GetMaxScreenSizeInch() {
+		return false
+	}
+	if screen.GetResolution().GetWidth() < filter.GetMinResolution().GetWidth() ||
+		screen.GetResolution().GetHeight() < filter.GetMinResolution().GetHeight() {
+		return false
+	}
+	if filter.GetScreenPanel() != pb.Screen_UNKNOWN && screen.GetPanel() != filter.GetScreenPanel() {
+		return false
+	}
+	return true
 }
 
-func deepCopy(laptop *pb.Laptop) (*pb.Laptop, error) {
-	other := &pb.Laptop{}
-	err := copier.Copy(other, laptop)
-	if err != nil {
-		return nil, fmt.Errorf("cannot copy laptop data:%w", err)
+//containsFold 判断value是否在values中，不区分大小写，values为空时表示不限制
+func containsFold(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
 	}
-	return other, nil
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+//maxGPUMemory 返回显存最大的gpu的显存大小，单位bit
+func maxGPUMemory(laptop *pb.Laptop) uint64 {
+	var max uint64
+	for _, gpu := range laptop.GetGpus() {
+		if bits := query.MemoryBits(gpu.GetMemory()); bits > max {
+			max = bits
+		}
+	}
+	return max
+}
+
+//ssdStorage 返回固态硬盘的总容量，单位bit
+func ssdStorage(laptop *pb.Laptop) uint64 {
+	var total uint64
+	for _, storage := range laptop.GetStorages() {
+		if storage.GetDriver() == pb.Storage_SSD {
+			total += query.MemoryBits(storage.GetMemory())
+		}
+	}
+	return total
+}
+
+//deepCopy 深拷贝laptop
+//copier不会复制oneof和repeated中的对象，副本之间仍然共享这些对象，因此使用proto.Clone
+func deepCopy(laptop *pb.Laptop) (*pb.Laptop, error) {
+	return proto.Clone(laptop).(*pb.Laptop), nil
 }
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"pcbook/pb"
+	"pcbook/sample"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestIsQualified(t *testing.T) {
+	t.Parallel()
+
+	//构造一个固定的laptop，避免随机数据影响测试结果
+	newLaptop := func() *pb.Laptop {
+		return &pb.Laptop{
+			Brand: "Apple",
+			Cpu:   &pb.CPU{Brand: "Intel", NumberCores: 8, MinGhz: 3.0},
+			Ram:   &pb.Memory{Value: 16, Unit: pb.Memory_GIGABYTE},
+			Gpus: []*pb.GPU{
+				{Brand: "NVIDIA", Memory: &pb.Memory{Value: 2, Unit: pb.Memory_GIGABYTE}},
+				{Brand: "AMD", Memory: &pb.Memory{Value: 4, Unit: pb.Memory_GIGABYTE}},
+			},
+			Storages: []*pb.Storage{
+				{Driver: pb.Storage_SSD, Memory: &pb.Memory{Value: 512, Unit: pb.Memory_GIGABYTE}},
+				{Driver: pb.Storage_SSD, Memory: &pb.Memory{Value: 256, Unit: pb.Memory_GIGABYTE}},
+				{Driver: pb.Storage_HDD, Memory: &pb.Memory{Value: 2, Unit: pb.Memory_TERABYTE}},
+			},
+			Screen: &pb.Screen{
+				SizeInch:   15.6,
+				Resolution: &pb.Screen_Resolution{Width: 2560, Height: 1440},
+				Panel:      pb.Screen_OLED,
+			},
+			Keyborad:    &pb.Keyborad{Backlit: true},
+			Weight:      &pb.Laptop_WeightLb{WeightLb: 4.4}, //约1.996kg
+			PriceUsed:   2000,
+			ReleaseYear: 2020,
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		filter    *pb.Filter
+		laptop    func(laptop *pb.Laptop)
+		qualified bool
+	}{
+		{
+			name:      "empty_filter_only_max_price",
+			filter:    &pb.Filter{MaxPriceUsed: 3000},
+			qualified: true,
+		},
+		{
+			name: "all_conditions",
+			filter: &pb.Filter{
+				MaxPriceUsed:      2000,
+				MinPriceUsed:      2000,
+				MinCpuCores:       8,
+				MinCpuGhz:         3.0,
+				MinRam:            &pb.Memory{Value: 16, Unit: pb.Memory_GIGABYTE},
+				Brands:            []string{"Dell", "apple"},
+				CpuBrands:         []string{"INTEL"},
+				MinGpuMemory:      &pb.Memory{Value: 4096, Unit: pb.Memory_MEGABYTE},
+				MinSsdStorage:     &pb.Memory{Value: 768, Unit: pb.Memory_GIGABYTE},
+				MinScreenSizeInch: 15,
+				MaxScreenSizeInch: 16,
+				MinResolution:     &pb.Screen_Resolution{Width: 2560, Height: 1440},
+				ScreenPanel:       pb.Screen_OLED,
+				BacklitKeyboard:   true,
+				MaxWeightKg:       2,
+				MinReleaseYear:    2020,
+				MaxReleaseYear:    2020,
+			},
+			qualified: true,
+		},
+		{
+			name:   "min_price",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MinPriceUsed: 2000.01},
+		},
+		{
+			name:   "brand",
+			filter: &pb.Filter{MaxPriceUsed: 3000, Brands: []string{"Dell", "Lenovo"}},
+		},
+		{
+			name:   "cpu_brand",
+			filter: &pb.Filter{MaxPriceUsed: 3000, CpuBrands: []string{"AMD"}},
+		},
+		{
+			name:   "gpu_memory",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MinGpuMemory: &pb.Memory{Value: 6, Unit: pb.Memory_GIGABYTE}},
+		},
+		{
+			name:   "ssd_storage_ignores_hdd",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MinSsdStorage: &pb.Memory{Value: 1, Unit: pb.Memory_TERABYTE}},
+		},
+		{
+			name:   "min_screen_size",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MinScreenSizeInch: 16},
+		},
+		{
+			name:   "max_screen_size",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MaxScreenSizeInch: 14},
+		},
+		{
+			name:   "min_resolution",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MinResolution: &pb.Screen_Resolution{Width: 1920, Height: 2160}},
+		},
+		{
+			name:   "screen_panel",
+			filter: &pb.Filter{MaxPriceUsed: 3000, ScreenPanel: pb.Screen_IPS},
+		},
+		{
+			name:   "backlit_keyboard",
+			filter: &pb.Filter{MaxPriceUsed: 3000, BacklitKeyboard: true},
+			laptop: func(laptop *pb.Laptop) {
+				laptop.Keyborad.Backlit = false
+			},
+		},
+		{
+			name:   "max_weight_lb",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MaxWeightKg: 1.99},
+		},
+		{
+			name:   "max_weight_kg",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MaxWeightKg: 1.5},
+			laptop: func(laptop *pb.Laptop) {
+				laptop.Weight = &pb.Laptop_WeightKg{WeightKg: 1.5}
+			},
+			qualified: true,
+		},
+		{
+			name:   "max_weight_unknown",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MaxWeightKg: 3},
+			laptop: func(laptop *pb.Laptop) {
+				laptop.Weight = nil
+			},
+		},
+		{
+			name:   "min_release_year",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MinReleaseYear: 2021},
+		},
+		{
+			name:   "max_release_year",
+			filter: &pb.Filter{MaxPriceUsed: 3000, MaxReleaseYear: 2019},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			laptop := newLaptop()
+			if tc.laptop != nil {
+				tc.laptop(laptop)
+			}
+			require.Equal(t, tc.qualified, isQualified(tc.filter, laptop))
+		})
+	}
+}
+
+func TestInMemoryLaptopStoreSearchIndexed(t *testing.T) {
+	t.Parallel()
+
+	store := NewInMemoryLaptopStore()
+	var ids []string
+	for i := 0; i < 500; i++ {
+		laptop := sample.NewLaptop()
+		require.NoError(t, store.Save(laptop))
+		ids = append(ids, laptop.Id)
+	}
+	//更新和删除部分laptop，确保索引同步修改
+	for i, id := range ids[:100] {
+		if i%2 == 0 {
+			require.NoError(t, store.Delete(id))
+			continue
+		}
+		laptop := sample.NewLaptop()
+		laptop.Id = id
+		_, err := store.Update(laptop, nil, 0)
+		require.NoError(t, err)
+	}
+
+	filters := []*pb.Filter{
+		{MaxPriceUsed: 3000},
+		{MinPriceUsed: 2000, MaxPriceUsed: 2500},
+		{MaxPriceUsed: 3000, MinCpuCores: 6, MinCpuGhz: 3.0},
+		{MaxPriceUsed: 3000, MinRam: &pb.Memory{Value: 48, Unit: pb.Memory_GIGABYTE}},
+		{MaxPriceUsed: 1000},
+	}
+	for _, filter := range filters {
+		//不使用索引，遍历全部laptop的结果作为对照
+		expected := searchIDs(t, store, filter, SearchOptions{
+			Match: func(laptop *pb.Laptop) bool {
+				return isQualified(filter, laptop)
+			},
+		})
+		actual := searchIDs(t, store, filter, SearchOptions{})
+		require.Equal(t, expected, actual)
+	}
+}
+
+func searchIDs(t *testing.T, store LaptopStore, filter *pb.Filter, options SearchOptions) []string {
+	var ids []string
+	err := store.Search(context.Background(), filter, options, func(laptop *pb.Laptop) error {
+		ids = append(ids, laptop.Id)
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(ids)
+	return ids
+}
+
+// _benchmarkStore 基准测试共用的store，创建大量laptop比较耗时，只创建一次
+var (
+	_benchmarkStore     *InMemoryLaptopStore
+	_benchmarkStoreOnce sync.Once
+)
+
+// benchmarkStore 返回包含20000个随机laptop的store
+func benchmarkStore(b *testing.B) *InMemoryLaptopStore {
+	_benchmarkStoreOnce.Do(func() {
+		_benchmarkStore = NewInMemoryLaptopStore()
+		for i := 0; i < 20000; i++ {
+			require.NoError(b, _benchmarkStore.Save(sample.NewLaptop()))
+		}
+	})
+	return _benchmarkStore
+}
+
+// _benchmarkFilter 只有少量laptop满足的筛选条件
+var _benchmarkFilter = &pb.Filter{
+	MinPriceUsed: 2000,
+	MaxPriceUsed: 2010,
+	MinCpuCores:  6,
+	MinCpuGhz:    3.0,
+	MinRam:       &pb.Memory{Value: 32, Unit: pb.Memory_GIGABYTE},
+}
+
+func BenchmarkInMemoryLaptopStoreSearch(b *testing.B) {
+	store := benchmarkStore(b)
+	found := func(laptop *pb.Laptop) error { return nil }
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := store.Search(context.Background(), _benchmarkFilter, SearchOptions{}, found)
+		require.NoError(b, err)
+	}
+}
+
+// BenchmarkInMemoryLaptopStoreSearchFullScan 不使用索引，遍历全部laptop作为对照
+func BenchmarkInMemoryLaptopStoreSearchFullScan(b *testing.B) {
+	store := benchmarkStore(b)
+	found := func(laptop *pb.Laptop) error { return nil }
+	options := SearchOptions{
+		Match: func(laptop *pb.Laptop) bool {
+			return isQualified(_benchmarkFilter, laptop)
+		},
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := store.Search(context.Background(), _benchmarkFilter, options, found)
+		require.NoError(b, err)
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"pcbook/pb"
+)
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// pageToken 分页token的内容，对客户端是不透明的
+// 记录上一页最后一条数据的排序字段，下一页从它之后开始，因此新插入的数据不会导致翻页时重复或遗漏
+type pageToken struct {
+	OrderBy string `json:"o"` //生成token时的排序规则，翻页时必须保持一致
+	Cursor  []byte `json:"c"` //上一页最后一条数据的排序字段，protobuf编码
+}
+
+// encodePageToken 根据排序规则和上一页最后一条数据生成token
+func encodePageToken(order LaptopOrder, last *pb.Laptop) (string, error) {
+	//只保留排序需要的字段，减小token长度
+	cursor := &pb.Laptop{}
+	err := applyFieldMask(cursor, last, &fieldmaskpb.FieldMask{Paths: order.Paths()})
+	if err != nil {
+		return "", err
+	}
+	return encodeCursor(order.String(), cursor)
+}
+
+// decodePageToken 解析token，返回上一页最后一条数据，token为空时返回nil
+func decodePageToken(order LaptopOrder, token string) (*pb.Laptop, error) {
+	if token == "" {
+		return nil, nil
+	}
+	cursor := &pb.Laptop{}
+	err := decodeCursor(order.String(), token, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// encodeCursor 将排序规则和上一页最后一条数据的排序字段编码为token
+func encodeCursor(orderBy string, cursor proto.Message) (string, error) {
+	data, err := proto.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal page cursor: %w", err)
+	}
+	token, err := json.Marshal(pageToken{
+		OrderBy: orderBy,
+		Cursor:  data,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal page token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// decodeCursor 解析token中的数据到cursor，排序规则必须与生成token时一致
+func decodeCursor(orderBy string, token string, cursor proto.Message) error {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+	value := pageToken{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+	if value.OrderBy != orderBy {
+		return fmt.Errorf("%w: order_by changed from %q to %q", ErrInvalidPageToken, value.OrderBy, orderBy)
+	}
+	err = proto.Unmarshal(value.Cursor, cursor)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPageToken, err)
+	}
+	return nil
+}
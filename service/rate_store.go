@@ -1,55 +1,167 @@
 package service
 
 import (
-	"fmt"
-	"github.com/jinzhu/copier"
+	"errors"
+	"pcbook/pb"
 	"sync"
 )
 
+// ErrReviewedRating 用户已评价laptop，评分以评价中的分数为准，不能单独修改或删除
+var ErrReviewedRating = errors.New("rating is part of a review")
+
 type RateStore interface {
-	Add(laptopID string, score float64) (*Rating, error)
+	// Rate 记录用户对laptop的评分，同一用户重复评分时替换之前的分数，返回laptop更新后的评分，
+	// 用户已评价该laptop时返回ErrReviewedRating
+	Rate(username, laptopID string, score float64) (*Rating, error)
+	// Find 查询laptop的评分，未评分时返回nil
+	Find(laptopID string) (*Rating, error)
+	// FindUserRating 查询用户对laptop的评分，未评分时返回nil
+	FindUserRating(username, laptopID string) (*UserRating, error)
+	// Delete 删除用户对laptop的评分，未评分时返回ErrNotFound，已评价时返回ErrReviewedRating，返回laptop更新后的评分
+	Delete(username, laptopID string) (*Rating, error)
+	// Total 所有laptop评分的数量及总和，不包含Histogram，用于计算加权评分的先验平均分
+	Total() (*Rating, error)
 }
 
 type Rating struct {
-	Count uint32
-	Sum   float64
+	Count     uint32
+	Sum       float64
+	Histogram map[float64]uint32 //每个分数的评分次数
+}
+
+// UserRating 用户对laptop的评分
+type UserRating struct {
+	Username string
+	LaptopID string
+	Score    float64
 }
 
 type InMemoryRateStore struct {
-	mutex sync.RWMutex
-	data  map[string]*Rating
+	mutex   sync.RWMutex
+	scores  map[string]map[string]float64 //laptopID -> username -> 评分
+	reviews *InMemoryReviewStore          //不为nil时，已评价的用户不能修改或删除评分
+	wal     mutationLog                   //不为nil时，修改数据之前先记录变更
 }
 
 func NewInMemoryRateStore() *InMemoryRateStore {
 	return &InMemoryRateStore{
-		data: make(map[string]*Rating),
+		scores: make(map[string]map[string]float64),
 	}
 }
 
-func (store *InMemoryRateStore) Add(laptopID string, score float64) (*Rating, error) {
+func (store *InMemoryRateStore) Rate(username, laptopID string, score float64) (*Rating, error) {
+	unlock, err := store.rlockReviews(username, laptopID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
-	rating := store.data[laptopID]
-	if rating == nil {
-		rating = &Rating{
-			Count: 1,
-			Sum:   score,
-		}
-	} else {
-		rating.Count++
-		rating.Sum += score
+	err = appendMutation(store.wal, &pb.StoreMutation{Mutation: &pb.StoreMutation_PutUserRating{PutUserRating: &pb.StoredUserRating{
+		Username: username,
+		LaptopId: laptopID,
+		Score:    score,
+	}}})
+	if err != nil {
+		return nil, err
 	}
-	store.data[laptopID] = rating
-	//deep copy
-	return deepCopyRating(rating)
+	store.put(username, laptopID, score)
+	return store.rating(laptopID), nil
+}
 
+func (store *InMemoryRateStore) Find(laptopID string) (*Rating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	if len(store.scores[laptopID]) == 0 {
+		return nil, nil
+	}
+	return store.rating(laptopID), nil
 }
 
-func deepCopyRating(rating *Rating) (*Rating, error) {
-	other := &Rating{}
-	err := copier.Copy(other, rating)
+func (store *InMemoryRateStore) FindUserRating(username, laptopID string) (*UserRating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	score, ok := store.scores[laptopID][username]
+	if !ok {
+		return nil, nil
+	}
+	return &UserRating{Username: username, LaptopID: laptopID, Score: score}, nil
+}
+
+func (store *InMemoryRateStore) Delete(username, laptopID string) (*Rating, error) {
+	unlock, err := store.rlockReviews(username, laptopID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.scores[laptopID][username]; !ok {
+		return nil, ErrNotFound
+	}
+	err = appendMutation(store.wal, &pb.StoreMutation{Mutation: &pb.StoreMutation_DeleteUserRating{DeleteUserRating: &pb.StoredUserRating{
+		Username: username,
+		LaptopId: laptopID,
+	}}})
 	if err != nil {
-		return nil, fmt.Errorf("cannot copy rating data:%w", err)
+		return nil, err
+	}
+	store.remove(username, laptopID)
+	return store.rating(laptopID), nil
+}
+
+func (store *InMemoryRateStore) Total() (*Rating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	total := &Rating{}
+	for _, scores := range store.scores {
+		for _, score := range scores {
+			total.Count++
+			total.Sum += score
+		}
+	}
+	return total, nil
+}
+
+// rlockReviews 对review store加读锁，保证修改评分时用户不会同时新建评价，用户已评价时返回ErrReviewedRating，
+// 与InMemoryReviewStore.Save相同，先锁定评价再锁定评分，成功时需要调用返回的unlock释放读锁
+func (store *InMemoryRateStore) rlockReviews(username, laptopID string) (func(), error) {
+	if store.reviews == nil {
+		return func() {}, nil
+	}
+	store.reviews.mutex.RLock()
+	if store.reviews.authors[reviewKey{laptopID: laptopID, author: username}] != "" {
+		store.reviews.mutex.RUnlock()
+		return nil, ErrReviewedRating
+	}
+	return store.reviews.mutex.RUnlock, nil
+}
+
+// put 保存用户评分，调用前需要加写锁
+func (store *InMemoryRateStore) put(username, laptopID string, score float64) {
+	scores := store.scores[laptopID]
+	if scores == nil {
+		scores = make(map[string]float64)
+		store.scores[laptopID] = scores
+	}
+	scores[username] = score
+}
+
+// remove 删除用户评分，调用前需要加写锁
+func (store *InMemoryRateStore) remove(username, laptopID string) {
+	delete(store.scores[laptopID], username)
+	if len(store.scores[laptopID]) == 0 {
+		delete(store.scores, laptopID)
+	}
+}
+
+// rating 根据所有用户的评分重新计算laptop的评分，调用前需要加锁
+func (store *InMemoryRateStore) rating(laptopID string) *Rating {
+	rating := &Rating{Histogram: make(map[float64]uint32)}
+	for _, score := range store.scores[laptopID] {
+		rating.Count++
+		rating.Sum += score
+		rating.Histogram[score]++
 	}
-	return other, nil
+	return rating
 }
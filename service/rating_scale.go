@@ -0,0 +1,53 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrInvalidScore = errors.New("invalid score")
+
+// _scoreStepTolerance 判断分数是否为步长整数倍时允许的浮点误差
+const _scoreStepTolerance = 1e-9
+
+// RatingScale 评分的取值范围，Step大于0时分数只能为Min加上Step的整数倍
+type RatingScale struct {
+	Min  float64
+	Max  float64
+	Step float64
+}
+
+// DefaultRatingScale 默认的评分范围，1到10分，步长0.5
+var DefaultRatingScale = RatingScale{Min: 1, Max: 10, Step: 0.5}
+
+// Check 校验评分范围本身是否合法
+func (scale RatingScale) Check() error {
+	if math.IsNaN(scale.Min) || math.IsInf(scale.Min, 0) || math.IsNaN(scale.Max) || math.IsInf(scale.Max, 0) {
+		return fmt.Errorf("rating scale must be finite: [%v, %v]", scale.Min, scale.Max)
+	}
+	if scale.Min > scale.Max {
+		return fmt.Errorf("rating scale min %v is greater than max %v", scale.Min, scale.Max)
+	}
+	if math.IsNaN(scale.Step) || math.IsInf(scale.Step, 0) || scale.Step < 0 {
+		return fmt.Errorf("rating scale step must be a non-negative number: %v", scale.Step)
+	}
+	return nil
+}
+
+// Validate 校验分数是否在评分范围内，不合法时返回ErrInvalidScore
+func (scale RatingScale) Validate(score float64) error {
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return fmt.Errorf("%w: score must be a finite number", ErrInvalidScore)
+	}
+	if score < scale.Min || score > scale.Max {
+		return fmt.Errorf("%w: score %v is out of range [%v, %v]", ErrInvalidScore, score, scale.Min, scale.Max)
+	}
+	if scale.Step > 0 {
+		steps := (score - scale.Min) / scale.Step
+		if math.Abs(steps-math.Round(steps)) > _scoreStepTolerance {
+			return fmt.Errorf("%w: score %v is not a multiple of %v from %v", ErrInvalidScore, score, scale.Step, scale.Min)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestRatingScale_Validate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string      //用例的名称
+		scale RatingScale //评分范围
+		score float64     //提交的分数
+		valid bool        //是否合法
+	}{
+		{name: "min", scale: DefaultRatingScale, score: 1, valid: true},
+		{name: "max", scale: DefaultRatingScale, score: 10, valid: true},
+		{name: "half_step", scale: DefaultRatingScale, score: 7.5, valid: true},
+		{name: "below_min", scale: DefaultRatingScale, score: 0.5},
+		{name: "above_max", scale: DefaultRatingScale, score: 10.5},
+		{name: "negative", scale: DefaultRatingScale, score: -3},
+		{name: "huge", scale: DefaultRatingScale, score: 1e308},
+		{name: "nan", scale: DefaultRatingScale, score: math.NaN()},
+		{name: "inf", scale: DefaultRatingScale, score: math.Inf(1)},
+		{name: "off_step", scale: DefaultRatingScale, score: 7.3},
+		{name: "tenth_step", scale: RatingScale{Min: 0, Max: 5, Step: 0.1}, score: 0.3, valid: true},
+		{name: "no_step", scale: RatingScale{Min: 0, Max: 5}, score: 3.14159, valid: true},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.scale.Validate(tc.score)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrInvalidScore)
+			}
+		})
+	}
+}
+
+func TestRatingScale_Check(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, DefaultRatingScale.Check())
+	require.NoError(t, RatingScale{Min: 5, Max: 5}.Check())
+	require.Error(t, RatingScale{Min: 10, Max: 1}.Check())
+	require.Error(t, RatingScale{Min: 1, Max: 10, Step: -1}.Check())
+	require.Error(t, RatingScale{Min: math.Inf(-1), Max: 10}.Check())
+}
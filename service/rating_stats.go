@@ -0,0 +1,86 @@
+package service
+
+import (
+	"pcbook/pb"
+	"sort"
+)
+
+// Average 平均评分，未评分时为0
+func (rating *Rating) Average() float64 {
+	if rating == nil || rating.Count == 0 {
+		return 0
+	}
+	return rating.Sum / float64(rating.Count)
+}
+
+// Distribution 每个分数的评分次数，按分数从低到高排列
+func (rating *Rating) Distribution() []*pb.RatingStats_Bucket {
+	if rating == nil {
+		return nil
+	}
+	buckets := make([]*pb.RatingStats_Bucket, 0, len(rating.Histogram))
+	for score, count := range rating.Histogram {
+		if count > 0 {
+			buckets = append(buckets, &pb.RatingStats_Bucket{Score: score, Count: count})
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].GetScore() < buckets[j].GetScore()
+	})
+	return buckets
+}
+
+// Median 评分的中位数，评分次数为偶数时取中间两个分数的平均值，未评分时为0
+func (rating *Rating) Median() float64 {
+	buckets := rating.Distribution()
+	var count uint32
+	for _, bucket := range buckets {
+		count += bucket.GetCount()
+	}
+	if count == 0 {
+		return 0
+	}
+
+	//第lower个和第upper个分数(从1开始)的平均值，count为奇数时二者相同
+	lower, upper := (count+1)/2, count/2+1
+	var seen uint32
+	var lowerScore float64
+	for _, bucket := range buckets {
+		if seen < lower && lower <= seen+bucket.GetCount() {
+			lowerScore = bucket.GetScore()
+		}
+		if upper <= seen+bucket.GetCount() {
+			return (lowerScore + bucket.GetScore()) / 2
+		}
+		seen += bucket.GetCount()
+	}
+	return lowerScore
+}
+
+// BayesianScore 贝叶斯加权评分，相当于在laptop的评分之外增加了weight个分数为prior的评分
+// 评分次数较少时结果接近prior，评分次数越多越接近平均评分
+func (rating *Rating) BayesianScore(prior, weight float64) float64 {
+	var count, sum float64
+	if rating != nil {
+		count, sum = float64(rating.Count), rating.Sum
+	}
+	if count+weight == 0 {
+		return 0
+	}
+	return (weight*prior + sum) / (weight + count)
+}
+
+// ratingStats 将评分转换为统计信息，prior为所有laptop的平均分
+func ratingStats(laptopID string, rating *Rating, prior, weight float64) *pb.RatingStats {
+	stats := &pb.RatingStats{
+		LaptopId:      laptopID,
+		Mean:          rating.Average(),
+		Median:        rating.Median(),
+		Distribution:  rating.Distribution(),
+		WeightedScore: rating.BayesianScore(prior, weight),
+	}
+	if rating != nil {
+		stats.Count = rating.Count
+	}
+	return stats
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"github.com/stretchr/testify/require"
+	"pcbook/pb"
+	"testing"
+)
+
+func TestRating_Stats(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string                   //用例的名称
+		histogram    map[float64]uint32       //每个分数的评分次数
+		mean         float64                  //平均分
+		median       float64                  //中位数
+		distribution []*pb.RatingStats_Bucket //按分数排列的评分次数
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:         "single",
+			histogram:    map[float64]uint32{7: 1},
+			mean:         7,
+			median:       7,
+			distribution: []*pb.RatingStats_Bucket{{Score: 7, Count: 1}},
+		},
+		{
+			name:         "odd",
+			histogram:    map[float64]uint32{9: 1, 2: 1, 5.5: 1},
+			mean:         5.5,
+			median:       5.5,
+			distribution: []*pb.RatingStats_Bucket{{Score: 2, Count: 1}, {Score: 5.5, Count: 1}, {Score: 9, Count: 1}},
+		},
+		{
+			name:         "even",
+			histogram:    map[float64]uint32{2: 1, 8: 1},
+			mean:         5,
+			median:       5,
+			distribution: []*pb.RatingStats_Bucket{{Score: 2, Count: 1}, {Score: 8, Count: 1}},
+		},
+		{
+			name:         "skewed",
+			histogram:    map[float64]uint32{1: 1, 10: 3},
+			mean:         7.75,
+			median:       10,
+			distribution: []*pb.RatingStats_Bucket{{Score: 1, Count: 1}, {Score: 10, Count: 3}},
+		},
+		{
+			name:         "even_across_buckets",
+			histogram:    map[float64]uint32{3: 2, 6: 2, 4: 0},
+			mean:         4.5,
+			median:       4.5,
+			distribution: []*pb.RatingStats_Bucket{{Score: 3, Count: 2}, {Score: 6, Count: 2}},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			rating := &Rating{Histogram: tc.histogram}
+			for score, count := range tc.histogram {
+				rating.Count += count
+				rating.Sum += score * float64(count)
+			}
+			require.InDelta(t, tc.mean, rating.Average(), 1e-9)
+			require.InDelta(t, tc.median, rating.Median(), 1e-9)
+			require.Equal(t, len(tc.distribution), len(rating.Distribution()))
+			for j, bucket := range rating.Distribution() {
+				require.Equal(t, tc.distribution[j].GetScore(), bucket.GetScore())
+				require.Equal(t, tc.distribution[j].GetCount(), bucket.GetCount())
+			}
+		})
+	}
+}
+
+func TestRating_BayesianScore(t *testing.T) {
+	t.Parallel()
+
+	//没有评分时等于先验平均分
+	var empty *Rating
+	require.InDelta(t, 7.0, empty.BayesianScore(7, 10), 1e-9)
+	require.Equal(t, 0.0, empty.BayesianScore(7, 0))
+
+	//评分次数少的满分laptop排在评分次数多的高分laptop之后
+	few := &Rating{Count: 1, Sum: 10}
+	many := &Rating{Count: 50, Sum: 50 * 9.5}
+	require.Less(t, few.BayesianScore(7, 10), many.BayesianScore(7, 10))
+	require.InDelta(t, (10*7+10)/11.0, few.BayesianScore(7, 10), 1e-9)
+
+	//weight为0时等于平均分
+	require.InDelta(t, 9.5, many.BayesianScore(7, 0), 1e-9)
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"google.golang.org/protobuf/proto"
+	"pcbook/pb"
+	"sort"
+	"sync"
+)
+
+// ReviewStore 评价的存储器
+type ReviewStore interface {
+	// Save 保存review，同时将review的分数记录为作者对laptop的评分，二者同时写入，返回laptop更新后的评分，
+	// id已存在或作者已评价过该laptop时返回ErrAlreadyExists，此时评分不会被修改
+	Save(review *pb.Review) (*Rating, error)
+	// Find 根据id查询review，不存在时返回nil
+	Find(id string) (*pb.Review, error)
+	// FindByAuthor 查询author对laptop的review，不存在时返回nil
+	FindByAuthor(laptopID, author string) (*pb.Review, error)
+	// List 按order查询laptop的review，after不为nil时从after之后开始，最多返回limit条
+	List(ctx context.Context, laptopID string, order ReviewOrder, after *pb.Review, limit int) ([]*pb.Review, error)
+	// Vote 记录username认为review有帮助，review不存在时返回ErrNotFound，重复投票时返回ErrAlreadyExists
+	Vote(id, username string) (*pb.Review, error)
+}
+
+// ReviewOrder review的排序方式，id作为最后的排序字段，保证顺序是确定的
+type ReviewOrder int
+
+const (
+	ReviewOrderNewest      ReviewOrder = iota //按创建时间从新到旧
+	ReviewOrderMostHelpful                    //按有帮助的投票数从多到少，相同时从新到旧
+)
+
+// String 用于分页token，翻页时排序方式必须保持一致
+func (order ReviewOrder) String() string {
+	if order == ReviewOrderMostHelpful {
+		return "helpful_votes desc, created_at desc, id desc"
+	}
+	return "created_at desc, id desc"
+}
+
+// Less 判断a是否排在b之前
+func (order ReviewOrder) Less(a, b *pb.Review) bool {
+	if order == ReviewOrderMostHelpful && a.GetHelpfulVotes() != b.GetHelpfulVotes() {
+		return a.GetHelpfulVotes() > b.GetHelpfulVotes()
+	}
+	ta, tb := a.GetCreatedAt().AsTime(), b.GetCreatedAt().AsTime()
+	if !ta.Equal(tb) {
+		return ta.After(tb)
+	}
+	return a.GetId() > b.GetId()
+}
+
+// cursor 只保留排序需要的字段，用于生成分页token
+func (order ReviewOrder) cursor(review *pb.Review) *pb.Review {
+	cursor := &pb.Review{
+		Id:        review.GetId(),
+		CreatedAt: review.GetCreatedAt(),
+	}
+	if order == ReviewOrderMostHelpful {
+		cursor.HelpfulVotes = review.GetHelpfulVotes()
+	}
+	return cursor
+}
+
+// reviewKey 同一作者对同一laptop只能有一条review
+type reviewKey struct {
+	laptopID string
+	author   string
+}
+
+type InMemoryReviewStore struct {
+	mutex   sync.RWMutex
+	data    map[string]*pb.Review          //id -> review，保存后不会被修改，更新时替换为新的对象
+	authors map[reviewKey]string           //(laptopID, author) -> id
+	votes   map[string]map[string]struct{} //id -> 投票的用户
+	rates   *InMemoryRateStore             //保存review的分数
+	wal     mutationLog                    //不为nil时，修改数据之前先记录变更
+}
+
+// NewInMemoryReviewStore review的分数作为作者的评分保存在rates中，之后rates不允许单独修改或删除这些评分
+func NewInMemoryReviewStore(rates *InMemoryRateStore) *InMemoryReviewStore {
+	store := &InMemoryReviewStore{
+		data:    make(map[string]*pb.Review),
+		authors: make(map[reviewKey]string),
+		votes:   make(map[string]map[string]struct{}),
+		rates:   rates,
+	}
+	rates.reviews = store
+	return store
+}
+
+func (store *InMemoryReviewStore) Save(review *pb.Review) (*Rating, error) {
+	//先锁定评价再锁定评分，与InMemoryRateStore的加锁顺序相同
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := reviewKey{laptopID: review.GetLaptopId(), author: review.GetAuthor()}
+	if store.data[review.GetId()] != nil || store.authors[key] != "" {
+		return nil, ErrAlreadyExists
+	}
+	store.rates.mutex.Lock()
+	defer store.rates.mutex.Unlock()
+
+	other := proto.Clone(review).(*pb.Review)
+	other.HelpfulVotes = 0
+	//只记录一条变更，重放时同时写入评价和评分
+	err := appendMutation(store.wal, &pb.StoreMutation{Mutation: &pb.StoreMutation_PutReview{PutReview: other}})
+	if err != nil {
+		return nil, err
+	}
+	store.put(other)
+	store.rates.put(other.GetAuthor(), other.GetLaptopId(), other.GetScore())
+	return store.rates.rating(other.GetLaptopId()), nil
+}
+
+func (store *InMemoryReviewStore) Find(id string) (*pb.Review, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	review := store.data[id]
+	if review == nil {
+		return nil, nil
+	}
+	return proto.Clone(review).(*pb.Review), nil
+}
+
+func (store *InMemoryReviewStore) FindByAuthor(laptopID, author string) (*pb.Review, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	review := store.data[store.authors[reviewKey{laptopID: laptopID, author: author}]]
+	if review == nil {
+		return nil, nil
+	}
+	return proto.Clone(review).(*pb.Review), nil
+}
+
+func (store *InMemoryReviewStore) List(ctx context.Context, laptopID string, order ReviewOrder, after *pb.Review, limit int) ([]*pb.Review, error) {
+	store.mutex.RLock()
+	var reviews []*pb.Review
+	for _, review := range store.data {
+		if review.GetLaptopId() != laptopID {
+			continue
+		}
+		if after != nil && !order.Less(after, review) {
+			continue
+		}
+		reviews = append(reviews, review)
+	}
+	store.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(reviews, func(i, j int) bool {
+		return order.Less(reviews[i], reviews[j])
+	})
+	if len(reviews) > limit {
+		reviews = reviews[:limit]
+	}
+	for i, review := range reviews {
+		reviews[i] = proto.Clone(review).(*pb.Review)
+	}
+	return reviews, nil
+}
+
+func (store *InMemoryReviewStore) Vote(id, username string) (*pb.Review, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.data[id] == nil {
+		return nil, ErrNotFound
+	}
+	if _, ok := store.votes[id][username]; ok {
+		return nil, ErrAlreadyExists
+	}
+
+	err := appendMutation(store.wal, &pb.StoreMutation{Mutation: &pb.StoreMutation_PutReviewVote{PutReviewVote: &pb.StoredReviewVote{
+		ReviewId: id,
+		Username: username,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	store.vote(id, username)
+	return proto.Clone(store.data[id]).(*pb.Review), nil
+}
+
+// put 保存review，调用前需要加写锁
+func (store *InMemoryReviewStore) put(review *pb.Review) {
+	store.data[review.GetId()] = review
+	store.authors[reviewKey{laptopID: review.GetLaptopId(), author: review.GetAuthor()}] = review.GetId()
+}
+
+// addVoter 只记录投票的用户，不修改投票数，用于从快照中恢复，调用前需要加写锁
+func (store *InMemoryReviewStore) addVoter(id, username string) {
+	voters := store.votes[id]
+	if voters == nil {
+		voters = make(map[string]struct{})
+		store.votes[id] = voters
+	}
+	voters[username] = struct{}{}
+}
+
+// vote 记录投票的用户并增加投票数，调用前需要加写锁
+func (store *InMemoryReviewStore) vote(id, username string) {
+	review := store.data[id]
+	if review == nil {
+		return
+	}
+	store.addVoter(id, username)
+	other := proto.Clone(review).(*pb.Review)
+	other.HelpfulVotes++
+	store.data[id] = other
+}
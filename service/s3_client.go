@@ -0,0 +1,406 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	_s3Algorithm       = "AWS4-HMAC-SHA256"
+	_s3Service         = "s3"
+	_s3DefaultRegion   = "us-east-1"
+	_s3TimeFormat      = "20060102T150405Z"
+	_s3DateFormat      = "20060102"
+	_s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	_s3MaxPresignTime  = 7 * 24 * time.Hour //下载链接的最长有效期
+	_s3MaxErrorSize    = 1 << 16            //读取错误响应的最大字节数
+	_s3DefaultTimeout  = 5 * time.Minute    //请求的默认超时时间，包括读取响应内容
+)
+
+// S3Config S3兼容对象存储的连接配置，使用路径风格(endpoint/bucket/key)访问，MinIO等服务都支持
+type S3Config struct {
+	Endpoint       string //服务地址，例如http://localhost:9000
+	PublicEndpoint string //生成下载链接时使用的地址，客户端无法访问Endpoint时设置，为空时使用Endpoint
+	Bucket         string
+	Region         string //为空时使用us-east-1
+	AccessKey      string
+	SecretKey      string
+	Timeout        time.Duration //每个请求的超时时间，包括读取响应内容，为0时使用5分钟
+}
+
+// s3Object 列举对象时返回的对象信息
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// s3Client 只实现了ImageStore需要的S3接口，请求使用AWS Signature Version 4签名
+type s3Client struct {
+	config     S3Config
+	endpoint   *url.URL
+	public     *url.URL
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+func newS3Client(config S3Config) (*s3Client, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	if config.Region == "" {
+		config.Region = _s3DefaultRegion
+	}
+	if config.Timeout < 0 {
+		return nil, fmt.Errorf("invalid s3 timeout %v", config.Timeout)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = _s3DefaultTimeout
+	}
+	endpoint, err := parseS3Endpoint(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	public := endpoint
+	if config.PublicEndpoint != "" {
+		public, err = parseS3Endpoint(config.PublicEndpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &s3Client{
+		config:     config,
+		endpoint:   endpoint,
+		public:     public,
+		httpClient: &http.Client{Timeout: config.Timeout}, //不使用没有超时的http.DefaultClient，避免S3无响应时请求一直阻塞
+		now:        time.Now,
+	}, nil
+}
+
+// parseS3Endpoint 解析服务地址，只支持http和https
+func parseS3Endpoint(rawURL string) (*url.URL, error) {
+	endpoint, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	if (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", rawURL)
+	}
+	return endpoint, nil
+}
+
+// objectURL 对象的路径风格地址，key为空时为bucket的地址
+func (client *s3Client) objectURL(endpoint *url.URL, key string) *url.URL {
+	objectURL := *endpoint
+	objectURL.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + client.config.Bucket
+	if key != "" {
+		objectURL.Path += "/" + key
+	}
+	objectURL.RawPath = s3Escape(objectURL.Path, true)
+	objectURL.RawQuery = ""
+	objectURL.Fragment = ""
+	return &objectURL
+}
+
+// newRequest 创建访问对象的请求，body不会被关闭
+func (client *s3Client) newRequest(method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	requestURL := client.objectURL(client.endpoint, key)
+	requestURL.RawQuery = canonicalS3Query(query)
+	if body != nil {
+		body = ioutil.NopCloser(body)
+	}
+	req, err := http.NewRequest(method, requestURL.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create s3 request: %w", err)
+	}
+	return req, nil
+}
+
+// do 签名并发送请求，返回状态码为2xx的响应，对象不存在时返回ErrNotFound
+func (client *s3Client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	client.sign(req, payloadHash)
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send s3 request: %w", err)
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	//HEAD请求的错误响应没有内容
+	_ = xml.NewDecoder(io.LimitReader(res.Body, _s3MaxErrorSize)).Decode(&s3Err)
+	if res.StatusCode == http.StatusNotFound && s3Err.Code != "NoSuchBucket" {
+		return nil, ErrNotFound
+	}
+	if s3Err.Code == "" {
+		s3Err.Code = res.Status
+	}
+	return nil, fmt.Errorf("s3 %s %s failed: %s %s", req.Method, req.URL.Path, s3Err.Code, s3Err.Message)
+}
+
+// headBucket 检查bucket是否存在并且可以访问
+func (client *s3Client) headBucket() error {
+	req, err := client.newRequest(http.MethodHead, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.do(req, emptyPayloadHash())
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("s3 bucket %q is not exist", client.config.Bucket)
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// putObject 上传对象，size为内容的字节数，payloadHash为内容的SHA-256(十六进制)
+func (client *s3Client) putObject(key, contentType string, body io.Reader, size int64, payloadHash string) error {
+	req, err := client.newRequest(http.MethodPut, key, nil, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := client.do(req, payloadHash)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// putBytes 上传内存中的对象
+func (client *s3Client) putBytes(key, contentType string, data []byte) error {
+	sum := sha256.Sum256(data)
+	return client.putObject(key, contentType, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]))
+}
+
+// getObject 下载对象，对象不存在时返回ErrNotFound，调用方需要关闭返回的reader
+func (client *s3Client) getObject(key string) (io.ReadCloser, error) {
+	req, err := client.newRequest(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.do(req, emptyPayloadHash())
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// deleteObject 删除对象，对象不存在时也会成功
+func (client *s3Client) deleteObject(key string) error {
+	req, err := client.newRequest(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.do(req, emptyPayloadHash())
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// listObjects 使用ListObjectsV2列举key以prefix开头的所有对象，按key排列
+func (client *s3Client) listObjects(prefix string) ([]s3Object, error) {
+	var objects []s3Object
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		req, err := client.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.do(req, emptyPayloadHash())
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode s3 object list: %w", err)
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// presignGetObject 生成在expires内有效的下载链接，使用PublicEndpoint作为地址
+func (client *s3Client) presignGetObject(key string, expires time.Duration) (string, error) {
+	if expires < time.Second || expires > _s3MaxPresignTime {
+		return "", fmt.Errorf("presigned url expiry must be between 1s and %v", _s3MaxPresignTime)
+	}
+	return client.presignURL(client.objectURL(client.public, key), expires), nil
+}
+
+// presignURL 使用查询参数签名GET请求，只签名host请求头，客户端不需要额外的请求头
+func (client *s3Client) presignURL(objectURL *url.URL, expires time.Duration) string {
+	now := client.now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", _s3Algorithm)
+	query.Set("X-Amz-Credential", client.config.AccessKey+"/"+client.scope(now))
+	query.Set("X-Amz-Date", now.Format(_s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonicalQuery := canonicalS3Query(query)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		s3Escape(objectURL.Path, true),
+		canonicalQuery,
+		"host:" + objectURL.Host + "\n",
+		"host",
+		_s3UnsignedPayload,
+	}, "\n")
+
+	presigned := *objectURL
+	presigned.RawQuery = canonicalQuery + "&X-Amz-Signature=" + client.signature(now, canonicalRequest)
+	return presigned.String()
+}
+
+// sign 使用Authorization请求头签名请求，签名包含host和请求中的所有请求头
+func (client *s3Client) sign(req *http.Request, payloadHash string) {
+	now := client.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(_s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, true),
+		canonicalS3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		_s3Algorithm, client.config.AccessKey, client.scope(now), signedHeaders, client.signature(now, canonicalRequest)))
+}
+
+// scope 签名的范围，格式为"日期/区域/s3/aws4_request"
+func (client *s3Client) scope(now time.Time) string {
+	return strings.Join([]string{now.Format(_s3DateFormat), client.config.Region, _s3Service, "aws4_request"}, "/")
+}
+
+// signature 计算规范请求的签名，签名密钥由SecretKey依次对日期、区域和服务计算HMAC得到
+func (client *s3Client) signature(now time.Time, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		_s3Algorithm,
+		now.Format(_s3TimeFormat),
+		client.scope(now),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + client.config.SecretKey)
+	for _, data := range []string{now.Format(_s3DateFormat), client.config.Region, _s3Service, "aws4_request"} {
+		key = hmacSHA256(key, data)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// hmacSHA256 计算data的HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// emptyPayloadHash 空请求体的SHA-256
+func emptyPayloadHash() string {
+	sum := sha256.Sum256(nil)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalS3Query 按参数名排序并编码查询参数
+func canonicalS3Query(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var params []string
+	for _, name := range names {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// s3Escape 按S3签名的规则编码，除字母、数字和"-._~"外的字节都编码为%XX，keepSlash为true时保留"/"
+func s3Escape(value string, keepSlash bool) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' || (c == '/' && keepSlash) {
+			escaped.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&escaped, "%%%02X", c)
+	}
+	return escaped.String()
+}
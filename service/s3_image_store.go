@@ -0,0 +1,441 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3ImageStore 将图片保存在S3兼容的对象存储中，图片信息也保存为对象，多个服务实例可以共用同一个bucket。
+// bucket中对象的布局为：
+//
+//	images/<图片id>.json           图片信息
+//	laptops/<laptop id>/<图片id>   laptop的图片列表，内容为空
+//	refs/<SHA-256>/<图片id>        引用该内容的图片，内容为空
+//	blobs/<SHA-256><扩展名>         图片内容，相同内容只保存一份
+//	blobs/<SHA-256>_<尺寸><扩展名>  缩略图
+//
+// 对象存储不支持事务，上传时总是重新写入内容，上传缩略图后检查内容是否仍被引用，
+// 不同实例同时删除和上传相同内容时，只有删除恰好发生在上传内容之后才会丢失内容
+type S3ImageStore struct {
+	mutex  sync.Mutex //同一个实例中的Save和Delete串行执行
+	client *s3Client
+}
+
+// s3ImageRecord 保存在images/<图片id>.json中的图片信息
+type s3ImageRecord struct {
+	ID        string    `json:"id"`
+	LaptopID  string    `json:"laptop_id"`
+	Type      string    `json:"type"`
+	MIMEType  string    `json:"mime_type"`
+	Key       string    `json:"key"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Checksum  string    `json:"checksum"`
+}
+
+// OpenS3ImageStore 连接对象存储并检查bucket是否存在
+func OpenS3ImageStore(config S3Config) (*S3ImageStore, error) {
+	client, err := newS3Client(config)
+	if err != nil {
+		return nil, err
+	}
+	err = client.headBucket()
+	if err != nil {
+		return nil, err
+	}
+	return &S3ImageStore{client: client}, nil
+}
+
+func imageRecordKey(imageID string) string {
+	return "images/" + imageID + ".json"
+}
+
+func laptopImageKey(laptopID, imageID string) string {
+	return "laptops/" + laptopID + "/" + imageID
+}
+
+func imageRefKey(checksum, imageID string) string {
+	return "refs/" + checksum + "/" + imageID
+}
+
+func imageBlobKey(checksum, mimeType string) string {
+	return "blobs/" + checksum + imageExtension(mimeType)
+}
+
+func imageVariantKey(checksum string, size int, mimeType string) string {
+	return fmt.Sprintf("blobs/%s_%d%s", checksum, size, imageExtension(mimeType))
+}
+
+func (store *S3ImageStore) Save(laptopID string, imageType string, mimeType string, imageData io.Reader) (string, error) {
+	imageID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate image id: %w", err)
+	}
+
+	//1.上传时需要知道内容的长度，先将图片写入临时文件，同时计算内容的SHA-256
+	staged, err := stageS3Object(imageData)
+	if err != nil {
+		return "", err
+	}
+	defer staged.remove()
+	checksum := staged.checksum()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	//同一个laptop重复上传相同的内容时返回已有的图片
+	records, err := store.laptopRecords(laptopID)
+	if err != nil {
+		return "", err
+	}
+	for _, record := range records {
+		if record.Checksum == checksum {
+			return record.ID, nil
+		}
+	}
+
+	//2.先记录引用再上传内容，之后其他实例删除相同内容的图片时能看到该引用，不会再删除内容。
+	//其他实例可能在记录引用前已经确认没有引用，并且在这之后删除内容，所以内容已存在时也要重新上传
+	record := &s3ImageRecord{
+		ID:        imageID.String(),
+		LaptopID:  laptopID,
+		Type:      imageType,
+		MIMEType:  mimeType,
+		Key:       imageBlobKey(checksum, mimeType),
+		Size:      staged.size,
+		CreatedAt: time.Now(),
+		Checksum:  checksum,
+	}
+	err = store.client.putBytes(imageRefKey(checksum, record.ID), "", nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot save image reference: %w", err)
+	}
+	reader, err := staged.reader()
+	if err != nil {
+		return "", err
+	}
+	err = store.client.putObject(record.Key, mimeType, reader, staged.size, checksum)
+	if err != nil {
+		return "", fmt.Errorf("cannot upload image: %w", err)
+	}
+
+	//3.最后写入laptop的图片列表，列出的图片都可以读取
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode image info: %w", err)
+	}
+	err = store.client.putBytes(imageRecordKey(record.ID), "application/json", data)
+	if err != nil {
+		return "", fmt.Errorf("cannot save image info: %w", err)
+	}
+	err = store.client.putBytes(laptopImageKey(laptopID, record.ID), "", nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot save laptop image: %w", err)
+	}
+	return record.ID, nil
+}
+
+// stageS3Object 将数据写入临时文件，读取出错时删除临时文件
+func stageS3Object(data io.Reader) (*stagedImage, error) {
+	staged, err := newStagedImage()
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(staged, data)
+	if err != nil {
+		staged.remove()
+		return nil, fmt.Errorf("cannot write image to file: %w", err)
+	}
+	return staged, nil
+}
+
+// record 读取图片信息，不存在时返回nil
+func (store *S3ImageStore) record(imageID string) (*s3ImageRecord, error) {
+	reader, err := store.client.getObject(imageRecordKey(imageID))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image info: %w", err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image info: %w", err)
+	}
+	record := &s3ImageRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image info: %w", err)
+	}
+	return record, nil
+}
+
+// laptopRecords 读取laptop的所有图片信息，忽略列举后被删除的图片
+func (store *S3ImageStore) laptopRecords(laptopID string) ([]*s3ImageRecord, error) {
+	objects, err := store.client.listObjects(laptopImageKey(laptopID, ""))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list laptop images: %w", err)
+	}
+	var records []*s3ImageRecord
+	for _, object := range objects {
+		record, err := store.record(path.Base(object.Key))
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// variants 列举内容的所有缩略图，返回缩略图的最大边长 -> 缩略图的文件信息
+func (store *S3ImageStore) variants(checksum string) (map[int]*ImageInfo, error) {
+	prefix := "blobs/" + checksum + "_"
+	objects, err := store.client.listObjects(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list image variants: %w", err)
+	}
+	variants := make(map[int]*ImageInfo)
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, prefix)
+		imageType := path.Ext(name)
+		size, err := strconv.Atoi(strings.TrimSuffix(name, imageType))
+		if err != nil {
+			continue
+		}
+		variants[size] = &ImageInfo{
+			Type:      imageType,
+			MIMEType:  imageMIMEType(imageType),
+			Path:      object.Key,
+			Size:      object.Size,
+			CreatedAt: object.LastModified,
+			Variant:   size,
+		}
+	}
+	return variants, nil
+}
+
+// imageInfo 根据图片信息和已生成的缩略图创建ImageInfo
+func (store *S3ImageStore) imageInfo(record *s3ImageRecord) (*ImageInfo, error) {
+	variants, err := store.variants(record.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	info := &ImageInfo{
+		ID:        record.ID,
+		LaptopID:  record.LaptopID,
+		Type:      record.Type,
+		MIMEType:  record.MIMEType,
+		Path:      record.Key,
+		Size:      record.Size,
+		CreatedAt: record.CreatedAt,
+		Checksum:  record.Checksum,
+	}
+	for size := range variants {
+		info.Variants = append(info.Variants, size)
+	}
+	sort.Ints(info.Variants)
+	return info, nil
+}
+
+func (store *S3ImageStore) Open(imageID string) (*ImageInfo, io.ReadCloser, error) {
+	info, err := store.Find(imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info == nil {
+		return nil, nil, ErrNotFound
+	}
+	reader, err := store.client.getObject(info.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, reader, nil
+}
+
+func (store *S3ImageStore) Find(imageID string) (*ImageInfo, error) {
+	record, err := store.record(imageID)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	return store.imageInfo(record)
+}
+
+func (store *S3ImageStore) ListByLaptop(laptopID string) ([]*ImageInfo, error) {
+	records, err := store.laptopRecords(laptopID)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]*ImageInfo, 0, len(records))
+	for _, record := range records {
+		info, err := store.imageInfo(record)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, info)
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		if !images[i].CreatedAt.Equal(images[j].CreatedAt) {
+			return images[i].CreatedAt.Before(images[j].CreatedAt)
+		}
+		return images[i].ID < images[j].ID
+	})
+	return images, nil
+}
+
+func (store *S3ImageStore) Delete(imageID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	record, err := store.record(imageID)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrNotFound
+	}
+
+	//先从laptop的图片列表中删除，最后删除引用
+	keys := []string{
+		laptopImageKey(record.LaptopID, imageID),
+		imageRecordKey(imageID),
+		imageRefKey(record.Checksum, imageID),
+	}
+	for _, key := range keys {
+		err = store.client.deleteObject(key)
+		if err != nil {
+			return fmt.Errorf("cannot delete image object: %w", err)
+		}
+	}
+
+	//没有其他图片引用该内容时删除内容及缩略图
+	refs, err := store.client.listObjects("refs/" + record.Checksum + "/")
+	if err != nil {
+		return fmt.Errorf("cannot list image references: %w", err)
+	}
+	if len(refs) > 0 {
+		return nil
+	}
+	variants, err := store.variants(record.Checksum)
+	if err != nil {
+		return err
+	}
+	keys = []string{record.Key}
+	for _, variant := range variants {
+		keys = append(keys, variant.Path)
+	}
+	for _, key := range keys {
+		err = store.client.deleteObject(key)
+		if err != nil {
+			return fmt.Errorf("cannot delete image object: %w", err)
+		}
+	}
+	return nil
+}
+
+func (store *S3ImageStore) SaveVariant(imageID string, size int, mimeType string, imageData io.Reader) error {
+	staged, err := stageS3Object(imageData)
+	if err != nil {
+		return err
+	}
+	defer staged.remove()
+
+	record, err := store.record(imageID)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrNotFound
+	}
+
+	reader, err := staged.reader()
+	if err != nil {
+		return err
+	}
+	key := imageVariantKey(record.Checksum, size, mimeType)
+	err = store.client.putObject(key, mimeType, reader, staged.size, staged.checksum())
+	if err != nil {
+		return fmt.Errorf("cannot upload image variant: %w", err)
+	}
+
+	//上传期间图片可能被其他实例删除，内容已没有引用时删除方不会再看到该缩略图，需要自己删除
+	refs, err := store.client.listObjects("refs/" + record.Checksum + "/")
+	if err != nil {
+		return fmt.Errorf("cannot list image references: %w", err)
+	}
+	if len(refs) > 0 {
+		return nil
+	}
+	err = store.client.deleteObject(key)
+	if err != nil {
+		return fmt.Errorf("cannot delete image variant: %w", err)
+	}
+	return ErrNotFound
+}
+
+// variant 查询图片的缩略图信息，原图或该尺寸的缩略图不存在时返回ErrNotFound
+func (store *S3ImageStore) variant(imageID string, size int) (*ImageInfo, error) {
+	record, err := store.record(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrNotFound
+	}
+	variants, err := store.variants(record.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	variant := variants[size]
+	if variant == nil {
+		return nil, ErrNotFound
+	}
+	variant.ID = imageID
+	variant.LaptopID = record.LaptopID
+	return variant, nil
+}
+
+func (store *S3ImageStore) OpenVariant(imageID string, size int) (*ImageInfo, io.ReadCloser, error) {
+	variant, err := store.variant(imageID, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := store.client.getObject(variant.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return variant, reader, nil
+}
+
+func (store *S3ImageStore) PresignImage(imageID string, size int, expires time.Duration) (string, error) {
+	key := ""
+	if size == 0 {
+		record, err := store.record(imageID)
+		if err != nil {
+			return "", err
+		}
+		if record == nil {
+			return "", ErrNotFound
+		}
+		key = record.Key
+	} else {
+		variant, err := store.variant(imageID, size)
+		if err != nil {
+			return "", err
+		}
+		key = variant.Path
+	}
+	return store.client.presignGetObject(key, expires)
+}
@@ -0,0 +1,220 @@
+// Package s3test 提供测试用的内存S3兼容服务，用法与httptest.Server相同：
+//
+//	server := s3test.NewServer()
+//	defer server.Close()
+//	store, err := service.OpenS3ImageStore(service.S3Config{Endpoint: server.URL, Bucket: "images"})
+//
+// 只支持路径风格访问的对象读写、删除和ListObjectsV2，任意bucket都视为已存在，
+// 请求必须带有签名或者是未过期的下载链接，但不会校验签名是否正确
+package s3test
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListPageSize ListObjectsV2每页返回的最大对象数量，设置得较小以覆盖分页的逻辑
+const ListPageSize = 3
+
+// Server 内存中的S3兼容服务
+type Server struct {
+	URL string //服务地址，例如http://127.0.0.1:50000
+	//OnPut 不为nil时在对象写入后、返回响应前调用，测试中用于模拟其他实例的并发操作，需要在发送请求前设置
+	OnPut func(bucket, key string)
+
+	mutex   sync.Mutex
+	objects map[string]*object //bucket/key -> 对象
+	server  *httptest.Server
+}
+
+type object struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+}
+
+// NewServer 启动服务，使用后需要调用Close
+func NewServer() *Server {
+	server := &Server{objects: make(map[string]*object)}
+	server.server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+	server.URL = server.server.URL
+	return server
+}
+
+// Close 关闭服务
+func (server *Server) Close() {
+	server.server.Close()
+}
+
+// Keys 返回bucket中key以prefix开头的所有对象的key，按key排列
+func (server *Server) Keys(bucket, prefix string) []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.keys(bucket, prefix)
+}
+
+// keys 调用方需要持有锁
+func (server *Server) keys(bucket, prefix string) []string {
+	var keys []string
+	for name := range server.objects {
+		if strings.HasPrefix(name, bucket+"/"+prefix) {
+			keys = append(keys, strings.TrimPrefix(name, bucket+"/"))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (server *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r) {
+		writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, key = path[:i], path[i+1:]
+	}
+	if bucket == "" {
+		writeError(w, http.StatusBadRequest, "InvalidBucketName")
+		return
+	}
+	if key == "" {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			server.listObjects(w, r, bucket)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+		}
+		return
+	}
+
+	name := bucket + "/" + key
+	if r.Method == http.MethodPut {
+		server.putObject(w, r, bucket, key)
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		object := server.objects[name]
+		if object == nil {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if object.contentType != "" {
+			w.Header().Set("Content-Type", object.contentType)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("Last-Modified", object.lastModified.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+	case http.MethodDelete:
+		delete(server.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// putObject 处理PutObject请求，调用OnPut时不持有锁
+func (server *Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	server.mutex.Lock()
+	server.objects[bucket+"/"+key] = &object{
+		data:         data,
+		contentType:  r.Header.Get("Content-Type"),
+		lastModified: time.Now().UTC(),
+	}
+	server.mutex.Unlock()
+	if server.OnPut != nil {
+		server.OnPut(bucket, key)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// listObjects 处理ListObjectsV2请求，continuation-token为上一页最后一个对象的key
+func (server *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	server.mutex.Lock()
+	keys := server.keys(bucket, query.Get("prefix"))
+	type content struct {
+		Key          string
+		Size         int
+		LastModified string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{}
+	after := query.Get("continuation-token")
+	for _, key := range keys {
+		if after != "" && key <= after {
+			continue
+		}
+		if len(result.Contents) == ListPageSize {
+			result.IsTruncated = true
+			result.NextContinuationToken = result.Contents[len(result.Contents)-1].Key
+			break
+		}
+		object := server.objects[bucket+"/"+key]
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			Size:         len(object.data),
+			LastModified: object.lastModified.Format(time.RFC3339Nano),
+		})
+	}
+	server.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// authorized 请求需要带有Authorization请求头，或者是未过期的下载链接
+func authorized(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		return true
+	}
+	query := r.URL.Query()
+	if r.Method != http.MethodGet || query.Get("X-Amz-Signature") == "" {
+		return false
+	}
+	signedAt, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return false
+	}
+	return time.Now().Before(signedAt.Add(time.Duration(expires) * time.Second))
+}
+
+// writeError 返回S3格式的错误
+func writeError(w http.ResponseWriter, statusCode int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+	}{Code: code})
+}
@@ -0,0 +1,435 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"pcbook/pb"
+	"pcbook/query"
+	"strings"
+)
+
+// laptopColumn laptops表中的列，完整的laptop序列化后保存在data列中，其他列用于筛选和排序
+type laptopColumn struct {
+	name  string
+	path  string //对应的排序字段路径，为空时不支持排序
+	value func(laptop *pb.Laptop) interface{}
+}
+
+var _laptopColumns = []laptopColumn{
+	{"id", "id", func(l *pb.Laptop) interface{} { return l.GetId() }},
+	{"brand", "brand", func(l *pb.Laptop) interface{} { return l.GetBrand() }},
+	{"name", "name", func(l *pb.Laptop) interface{} { return l.GetName() }},
+	{"cpu_brand", "", func(l *pb.Laptop) interface{} { return l.GetCpu().GetBrand() }},
+	{"cpu_cores", "cpu.number_cores", func(l *pb.Laptop) interface{} { return l.GetCpu().GetNumberCores() }},
+	{"cpu_min_ghz", "cpu.min_ghz", func(l *pb.Laptop) interface{} { return l.GetCpu().GetMinGhz() }},
+	{"ram_bits", "ram", func(l *pb.Laptop) interface{} { return int64(query.MemoryBits(l.GetRam())) }},
+	{"gpu_memory_bits", "", func(l *pb.Laptop) interface{} { return int64(maxGPUMemory(l)) }},
+	{"ssd_bits", "", func(l *pb.Laptop) interface{} { return int64(ssdStorage(l)) }},
+	{"screen_size", "", func(l *pb.Laptop) interface{} { return float64(l.GetScreen().GetSizeInch()) }},
+	{"screen_width", "", func(l *pb.Laptop) interface{} { return l.GetScreen().GetResolution().GetWidth() }},
+	{"screen_height", "", func(l *pb.Laptop) interface{} { return l.GetScreen().GetResolution().GetHeight() }},
+	{"screen_panel", "", func(l *pb.Laptop) interface{} { return int32(l.GetScreen().GetPanel()) }},
+	{"backlit", "", func(l *pb.Laptop) interface{} { return l.GetKeyborad().GetBacklit() }},
+	{"weight_kg", "", func(l *pb.Laptop) interface{} {
+		weight, ok := query.WeightKg(l)
+		if !ok {
+			return nil
+		}
+		return weight
+	}},
+	{"price_used", "price_used", func(l *pb.Laptop) interface{} { return l.GetPriceUsed() }},
+	{"release_year", "release_year", func(l *pb.Laptop) interface{} { return l.GetReleaseYear() }},
+	{"update_at", "update_at", func(l *pb.Laptop) interface{} { return l.GetUpdateAt().AsTime().UnixNano() }},
+	{"revision", "", func(l *pb.Laptop) interface{} { return int64(l.GetRevision()) }},
+}
+
+// SQLLaptopStore 使用SQL数据库存储laptop
+type SQLLaptopStore struct {
+	db *sql.DB
+}
+
+func NewSQLLaptopStore(db *sql.DB) *SQLLaptopStore {
+	return &SQLLaptopStore{db: db}
+}
+
+// laptopValues 返回laptop各列的值，最后一个为序列化后的data
+func laptopValues(laptop *pb.Laptop) ([]interface{}, error) {
+	data, err := proto.Marshal(laptop)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal laptop: %w", err)
+	}
+	values := make([]interface{}, 0, len(_laptopColumns)+1)
+	for _, column := range _laptopColumns {
+		values = append(values, column.value(laptop))
+	}
+	return append(values, data), nil
+}
+
+func (store *SQLLaptopStore) Save(laptop *pb.Laptop) error {
+	other := proto.Clone(laptop).(*pb.Laptop)
+	other.UpdateAt = timestamppb.Now()
+	other.Revision = 1
+	values, err := laptopValues(other)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(_laptopColumns)+1)
+	for _, column := range _laptopColumns {
+		names = append(names, column.name)
+	}
+	names = append(names, "data")
+	query := fmt.Sprintf("INSERT INTO laptops (%s) VALUES (%s) ON CONFLICT (id) DO NOTHING",
+		strings.Join(names, ", "), placeholders(len(names)))
+
+	result, err := store.db.Exec(query, values...)
+	if err != nil {
+		return fmt.Errorf("cannot insert laptop: %w", err)
+	}
+	//id已存在时不会插入
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot insert laptop: %w", err)
+	}
+	if affected == 0 {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+func (store *SQLLaptopStore) Find(id string) (*pb.Laptop, error) {
+	laptop, err := findLaptop(store.db, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return laptop, err
+}
+
+// rowQuerier *sql.DB和*sql.Tx共同的查询方法
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// findLaptop 根据id查询laptop，不存在时返回sql.ErrNoRows
+func findLaptop(db rowQuerier, id string) (*pb.Laptop, error) {
+	var data []byte
+	err := db.QueryRow("SELECT data FROM laptops WHERE id = ?", id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot query laptop: %w", err)
+	}
+	return unmarshalLaptop(data)
+}
+
+func unmarshalLaptop(data []byte) (*pb.Laptop, error) {
+	laptop := &pb.Laptop{}
+	err := proto.Unmarshal(data, laptop)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal laptop: %w", err)
+	}
+	return laptop, nil
+}
+
+func (store *SQLLaptopStore) Update(laptop *pb.Laptop, mask *fieldmaskpb.FieldMask, revision uint64) (*pb.Laptop, error) {
+	//读取和修改在同一个事务内完成，避免并发更新互相覆盖
+	tx, err := store.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	old, err := findLaptop(tx, laptop.GetId())
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	other, err := updatedLaptop(old, laptop, mask, revision)
+	if err != nil {
+		return nil, err
+	}
+	values, err := laptopValues(other)
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := make([]string, 0, len(_laptopColumns)+1)
+	for _, column := range _laptopColumns {
+		assignments = append(assignments, column.name+" = ?")
+	}
+	assignments = append(assignments, "data = ?")
+	query := fmt.Sprintf("UPDATE laptops SET %s WHERE id = ?", strings.Join(assignments, ", "))
+	_, err = tx.Exec(query, append(values, old.GetId())...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot update laptop: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return other, nil
+}
+
+func (store *SQLLaptopStore) Delete(id string) error {
+	result, err := store.db.Exec("DELETE FROM laptops WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("cannot delete laptop: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot delete laptop: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *SQLLaptopStore) List(ctx context.Context, order LaptopOrder, after *pb.Laptop, limit int) ([]*pb.Laptop, error) {
+	orderBy, ok := laptopOrderSQL(order)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidOrderBy, order)
+	}
+
+	query := "SELECT data FROM laptops"
+	var args []interface{}
+	if after != nil {
+		where, afterArgs := laptopAfterSQL(order, after)
+		query += " WHERE " + where
+		args = append(args, afterArgs...)
+	}
+	query += " ORDER BY " + orderBy + " LIMIT ?"
+	args = append(args, limit)
+	return store.query(ctx, query, args...)
+}
+
+func (store *SQLLaptopStore) Search(ctx context.Context, filter *pb.Filter, options SearchOptions, found func(laptop *pb.Laptop) error) error {
+	//Match无法转换为SQL，需要读取全部laptop后逐个判断
+	where, args := "1 = 1", []interface{}(nil)
+	if options.Match == nil {
+		where, args = laptopFilterSQL(filter)
+	}
+	query := "SELECT data FROM laptops WHERE " + where
+
+	//按rating排序时需要读取后再排序
+	orderBy, sorted := laptopOrderSQL(options.Order)
+	if sorted {
+		query += " ORDER BY " + orderBy
+		if options.Match == nil && options.MaxResults > 0 {
+			query += " LIMIT ?"
+			args = append(args, options.MaxResults)
+		}
+	}
+
+	//先读取全部结果再调用回调，避免客户端接收过慢时一直占用数据库连接
+	laptops, err := store.query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if options.Match != nil {
+		matched := laptops[:0]
+		for _, laptop := range laptops {
+			if options.Match(laptop) {
+				matched = append(matched, laptop)
+			}
+		}
+		laptops = matched
+	}
+	if !sorted {
+		laptops = sortLaptops(laptops, options)
+	}
+	if options.MaxResults > 0 && len(laptops) > options.MaxResults {
+		laptops = laptops[:options.MaxResults]
+	}
+
+	for _, laptop := range laptops {
+		//如果超时或客户端ctrl+c,则结束循环,避免浪费服务器资源
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := found(laptop)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *SQLLaptopStore) Aggregate(ctx context.Context, filter *pb.Filter) (*pb.LaptopAggregation, error) {
+	where, args := laptopFilterSQL(filter)
+	laptops, err := store.query(ctx, "SELECT data FROM laptops WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregator := NewLaptopAggregator()
+	for _, laptop := range laptops {
+		aggregator.Add(laptop)
+	}
+	return aggregator.Result(), nil
+}
+
+// query 执行查询，返回data列反序列化后的laptop
+func (store *SQLLaptopStore) query(ctx context.Context, query string, args ...interface{}) ([]*pb.Laptop, error) {
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query laptops: %w", err)
+	}
+	defer rows.Close()
+
+	var laptops []*pb.Laptop
+	for rows.Next() {
+		var data []byte
+		err := rows.Scan(&data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan laptop: %w", err)
+		}
+		laptop, err := unmarshalLaptop(data)
+		if err != nil {
+			return nil, err
+		}
+		laptops = append(laptops, laptop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot query laptops: %w", err)
+	}
+	return laptops, nil
+}
+
+// laptopFilterSQL 将filter转换为SQL条件，与isQualified的判断一致
+func laptopFilterSQL(filter *pb.Filter) (string, []interface{}) {
+	conditions := []string{
+		"price_used <= ?",
+		"price_used >= ?",
+		"cpu_cores >= ?",
+		"cpu_min_ghz >= ?",
+		"ram_bits >= ?",
+		"screen_size >= ?",
+		"screen_width >= ?",
+		"screen_height >= ?",
+		"release_year >= ?",
+	}
+	args := []interface{}{
+		filter.GetMaxPriceUsed(),
+		filter.GetMinPriceUsed(),
+		filter.GetMinCpuCores(),
+		filter.GetMinCpuGhz(),
+		int64(query.MemoryBits(filter.GetMinRam())),
+		float64(filter.GetMinScreenSizeInch()),
+		filter.GetMinResolution().GetWidth(),
+		filter.GetMinResolution().GetHeight(),
+		filter.GetMinReleaseYear(),
+	}
+	add := func(condition string, arg ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, arg...)
+	}
+
+	//品牌不区分大小写
+	if brands := filter.GetBrands(); len(brands) > 0 {
+		add(fmt.Sprintf("brand COLLATE NOCASE IN (%s)", placeholders(len(brands))), stringArgs(brands)...)
+	}
+	if brands := filter.GetCpuBrands(); len(brands) > 0 {
+		add(fmt.Sprintf("cpu_brand COLLATE NOCASE IN (%s)", placeholders(len(brands))), stringArgs(brands)...)
+	}
+	if filter.GetMinGpuMemory() != nil {
+		add("gpu_memory_bits >= ?", int64(query.MemoryBits(filter.GetMinGpuMemory())))
+	}
+	if filter.GetMinSsdStorage() != nil {
+		add("ssd_bits >= ?", int64(query.MemoryBits(filter.GetMinSsdStorage())))
+	}
+	if filter.GetMaxScreenSizeInch() > 0 {
+		add("screen_size <= ?", float64(filter.GetMaxScreenSizeInch()))
+	}
+	if filter.GetScreenPanel() != pb.Screen_UNKNOWN {
+		add("screen_panel = ?", int32(filter.GetScreenPanel()))
+	}
+	if filter.GetBacklitKeyboard() {
+		add("backlit = 1")
+	}
+	//未设置重量的laptop不满足条件
+	if filter.GetMaxWeightKg() > 0 {
+		add("weight_kg <= ?", filter.GetMaxWeightKg())
+	}
+	if filter.GetMaxReleaseYear() > 0 {
+		add("release_year <= ?", filter.GetMaxReleaseYear())
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// laptopOrderSQL 将排序规则转换为ORDER BY子句，包含不支持的字段(如rating)时返回false
+func laptopOrderSQL(order LaptopOrder) (string, bool) {
+	items := make([]string, 0, len(order)+1)
+	for _, field := range order {
+		column, ok := laptopOrderColumn(field.Path)
+		if !ok {
+			return "", false
+		}
+		item := column.name
+		if field.Desc {
+			item += " DESC"
+		}
+		items = append(items, item)
+	}
+	return strings.Join(append(items, "id"), ", "), true
+}
+
+// laptopAfterSQL 返回排在after之后的条件，即依次比较排序字段，前面的字段相等时比较后面的字段
+func laptopAfterSQL(order LaptopOrder, after *pb.Laptop) (string, []interface{}) {
+	fields := append(LaptopOrder{}, order...)
+	fields = append(fields, LaptopOrderField{Path: "id"})
+
+	var conditions []string
+	var args []interface{}
+	for i, field := range fields {
+		var terms []string
+		var termArgs []interface{}
+		for _, previous := range fields[:i] {
+			column, _ := laptopOrderColumn(previous.Path)
+			terms = append(terms, column.name+" = ?")
+			termArgs = append(termArgs, column.value(after))
+		}
+		column, _ := laptopOrderColumn(field.Path)
+		op := " > ?"
+		if field.Desc {
+			op = " < ?"
+		}
+		terms = append(terms, column.name+op)
+		termArgs = append(termArgs, column.value(after))
+
+		conditions = append(conditions, "("+strings.Join(terms, " AND ")+")")
+		args = append(args, termArgs...)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// laptopOrderColumn 返回排序字段对应的列
+func laptopOrderColumn(path string) (laptopColumn, bool) {
+	for _, column := range _laptopColumns {
+		if column.path != "" && column.path == path {
+			return column, true
+		}
+	}
+	return laptopColumn{}, false
+}
+
+// placeholders 返回n个以逗号分隔的参数占位符
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"path/filepath"
+	"pcbook/pb"
+	"pcbook/sample"
+	"testing"
+)
+
+func TestSQLLaptopStore(t *testing.T) {
+	t.Parallel()
+
+	db, err := OpenSQLite(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	store := NewSQLLaptopStore(db)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+	require.ErrorIs(t, store.Save(laptop), ErrAlreadyExists)
+
+	found, err := store.Find(laptop.Id)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, found.GetRevision())
+	require.Equal(t, laptop.GetName(), found.GetName())
+
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"price_used"}}
+	_, err = store.Update(&pb.Laptop{Id: laptop.Id, PriceUsed: 999}, mask, 2)
+	require.ErrorIs(t, err, ErrRevisionMismatch)
+	updated, err := store.Update(&pb.Laptop{Id: laptop.Id, PriceUsed: 999}, mask, 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, updated.GetRevision())
+	require.Equal(t, 999.0, updated.GetPriceUsed())
+	require.Equal(t, laptop.GetName(), updated.GetName())
+
+	require.NoError(t, store.Delete(laptop.Id))
+	require.ErrorIs(t, store.Delete(laptop.Id), ErrNotFound)
+	_, err = store.Update(laptop, nil, 0)
+	require.ErrorIs(t, err, ErrNotFound)
+	found, err = store.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, found)
+}
+
+func TestSQLLaptopStoreMatchesInMemory(t *testing.T) {
+	t.Parallel()
+
+	db, err := OpenSQLite(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	sqlStore := NewSQLLaptopStore(db)
+	memoryStore := NewInMemoryLaptopStore()
+	for i := 0; i < 200; i++ {
+		laptop := sample.NewLaptop()
+		if i%10 == 0 {
+			laptop.Weight = &pb.Laptop_WeightLb{WeightLb: 4}
+		}
+		require.NoError(t, sqlStore.Save(laptop))
+		require.NoError(t, memoryStore.Save(laptop))
+	}
+
+	filters := []*pb.Filter{
+		{MaxPriceUsed: 3000},
+		{MinPriceUsed: 2000, MaxPriceUsed: 2500, MinCpuCores: 4, MinCpuGhz: 2.5},
+		{MaxPriceUsed: 3000, MinRam: &pb.Memory{Value: 32, Unit: pb.Memory_GIGABYTE}},
+		{MaxPriceUsed: 3000, Brands: []string{"apple", "DELL"}, CpuBrands: []string{"intel"}},
+		{MaxPriceUsed: 3000, MinGpuMemory: &pb.Memory{Value: 4, Unit: pb.Memory_GIGABYTE}},
+		{MaxPriceUsed: 3000, MinSsdStorage: &pb.Memory{Value: 512, Unit: pb.Memory_GIGABYTE}},
+		{MaxPriceUsed: 3000, MinScreenSizeInch: 14, MaxScreenSizeInch: 16, ScreenPanel: pb.Screen_IPS},
+		{MaxPriceUsed: 3000, MinResolution: &pb.Screen_Resolution{Width: 2560, Height: 1440}},
+		{MaxPriceUsed: 3000, BacklitKeyboard: true, MaxWeightKg: 2},
+		{MaxPriceUsed: 3000, MinReleaseYear: 2017, MaxReleaseYear: 2019},
+	}
+	for _, filter := range filters {
+		require.Equal(t, searchIDs(t, memoryStore, filter, SearchOptions{}), searchIDs(t, sqlStore, filter, SearchOptions{}), filter.String())
+
+		expected, err := memoryStore.Aggregate(context.Background(), filter)
+		require.NoError(t, err)
+		actual, err := sqlStore.Aggregate(context.Background(), filter)
+		require.NoError(t, err)
+		//累加顺序不同，平均价格可能有微小的误差
+		require.InDelta(t, expected.AvgPrice, actual.AvgPrice, 1e-6)
+		expected.AvgPrice, actual.AvgPrice = 0, 0
+		require.Equal(t, expected.String(), actual.String())
+	}
+
+	//按多个字段分页查询，结果与内存存储器一致
+	order, err := ParseLaptopOrder("brand, price_used desc")
+	require.NoError(t, err)
+	var after *pb.Laptop
+	for {
+		expected, err := memoryStore.List(context.Background(), order, after, 7)
+		require.NoError(t, err)
+		actual, err := sqlStore.List(context.Background(), order, after, 7)
+		require.NoError(t, err)
+		require.Equal(t, laptopIDs(expected), laptopIDs(actual))
+		if len(actual) == 0 {
+			break
+		}
+		after = actual[len(actual)-1]
+	}
+}
+
+func TestOpenSQLiteMigratesOnce(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "pcbook.db")
+	db, err := OpenSQLite(path)
+	require.NoError(t, err)
+	require.NoError(t, NewSQLUserStore(db).Save(&User{Username: "admin1", HashedPassword: "hash", Role: "admin"}))
+	_, err = NewSQLRateStore(db).Rate("user1", "laptop", 5)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	//重新打开时不会重复执行迁移，数据仍然存在
+	db, err = OpenSQLite(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	user, err := NewSQLUserStore(db).Find("admin1")
+	require.NoError(t, err)
+	require.Equal(t, "admin", user.Role)
+	require.ErrorIs(t, NewSQLUserStore(db).Save(user), ErrAlreadyExists)
+
+	rating, err := NewSQLRateStore(db).Rate("user2", "laptop", 8)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, rating.Count)
+	require.Equal(t, 13.0, rating.Sum)
+}
+
+func laptopIDs(laptops []*pb.Laptop) []string {
+	ids := make([]string, len(laptops))
+	for i, laptop := range laptops {
+		ids[i] = laptop.GetId()
+	}
+	return ids
+}
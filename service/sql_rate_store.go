@@ -0,0 +1,164 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SQLRateStore 使用SQL数据库存储评分
+type SQLRateStore struct {
+	db *sql.DB
+}
+
+func NewSQLRateStore(db *sql.DB) *SQLRateStore {
+	return &SQLRateStore{db: db}
+}
+
+func (store *SQLRateStore) Rate(username, laptopID string, score float64) (*Rating, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = checkNotReviewed(tx, username, laptopID)
+	if err != nil {
+		return nil, err
+	}
+	err = putUserRating(tx, username, laptopID, score)
+	if err != nil {
+		return nil, err
+	}
+	return commitRating(tx, laptopID)
+}
+
+func (store *SQLRateStore) Find(laptopID string) (*Rating, error) {
+	rating, err := queryRating(store.db, laptopID)
+	if err != nil {
+		return nil, err
+	}
+	if rating.Count == 0 {
+		return nil, nil
+	}
+	return rating, nil
+}
+
+func (store *SQLRateStore) FindUserRating(username, laptopID string) (*UserRating, error) {
+	rating := &UserRating{Username: username, LaptopID: laptopID}
+	err := store.db.QueryRow(
+		"SELECT score FROM user_ratings WHERE laptop_id = ? AND username = ?", laptopID, username,
+	).Scan(&rating.Score)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot query rating: %w", err)
+	}
+	return rating, nil
+}
+
+func (store *SQLRateStore) Delete(username, laptopID string) (*Rating, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = checkNotReviewed(tx, username, laptopID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec("DELETE FROM user_ratings WHERE laptop_id = ? AND username = ?", laptopID, username)
+	if err != nil {
+		return nil, fmt.Errorf("cannot delete rating: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("cannot delete rating: %w", err)
+	}
+	if affected == 0 {
+		return nil, ErrNotFound
+	}
+	return commitRating(tx, laptopID)
+}
+
+func (store *SQLRateStore) Total() (*Rating, error) {
+	total := &Rating{}
+	err := store.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(score), 0) FROM user_ratings").Scan(&total.Count, &total.Sum)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query total rating: %w", err)
+	}
+	return total, nil
+}
+
+// putUserRating 在事务中保存用户评分，替换之前的分数
+func putUserRating(tx *sql.Tx, username, laptopID string, score float64) error {
+	_, err := tx.Exec(
+		`INSERT INTO user_ratings (laptop_id, username, score) VALUES (?, ?, ?)
+		ON CONFLICT (laptop_id, username) DO UPDATE SET score = excluded.score`,
+		laptopID, username, score,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot save rating: %w", err)
+	}
+	return nil
+}
+
+// checkNotReviewed 用户已评价laptop时返回ErrReviewedRating，在修改评分的事务中检查，不会与新建评价交错
+func checkNotReviewed(tx *sql.Tx, username, laptopID string) error {
+	var reviewed bool
+	err := tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM reviews WHERE laptop_id = ? AND author = ?)", laptopID, username,
+	).Scan(&reviewed)
+	if err != nil {
+		return fmt.Errorf("cannot query review: %w", err)
+	}
+	if reviewed {
+		return ErrReviewedRating
+	}
+	return nil
+}
+
+// commitRating 在事务中重新计算laptop的评分后提交
+func commitRating(tx *sql.Tx, laptopID string) (*Rating, error) {
+	rating, err := queryRating(tx, laptopID)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("cannot commit rating: %w", err)
+	}
+	return rating, nil
+}
+
+// rowsQuerier *sql.DB和*sql.Tx共同的多行查询方法
+type rowsQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryRating 根据所有用户的评分计算laptop的评分
+func queryRating(db rowsQuerier, laptopID string) (*Rating, error) {
+	rows, err := db.Query("SELECT score, COUNT(*) FROM user_ratings WHERE laptop_id = ? GROUP BY score", laptopID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query rating: %w", err)
+	}
+	defer rows.Close()
+
+	rating := &Rating{Histogram: make(map[float64]uint32)}
+	for rows.Next() {
+		var score float64
+		var count uint32
+		err := rows.Scan(&score, &count)
+		if err != nil {
+			return nil, fmt.Errorf("cannot query rating: %w", err)
+		}
+		rating.Count += count
+		rating.Sum += score * float64(count)
+		rating.Histogram[score] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot query rating: %w", err)
+	}
+	return rating, nil
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"pcbook/pb"
+)
+
+// SQLReviewStore 使用SQL数据库存储评价，投票数单独保存在helpful_votes列中，data中的投票数不使用，
+// 评价的分数保存在SQLRateStore使用的user_ratings表中，需要与SQLRateStore使用同一个数据库
+type SQLReviewStore struct {
+	db *sql.DB
+}
+
+func NewSQLReviewStore(db *sql.DB) *SQLReviewStore {
+	return &SQLReviewStore{db: db}
+}
+
+func (store *SQLReviewStore) Save(review *pb.Review) (*Rating, error) {
+	other := proto.Clone(review).(*pb.Review)
+	other.HelpfulVotes = 0
+	data, err := proto.Marshal(other)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal review: %w", err)
+	}
+
+	//评价和评分在同一个事务中写入
+	tx, err := store.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	//id或(laptop_id, author)已存在时都不会插入
+	result, err := tx.Exec(
+		`INSERT INTO reviews (id, laptop_id, author, created_at, helpful_votes, data) VALUES (?, ?, ?, ?, 0, ?)
+		ON CONFLICT DO NOTHING`,
+		other.GetId(), other.GetLaptopId(), other.GetAuthor(), other.GetCreatedAt().AsTime().UnixNano(), data,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot insert review: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("cannot insert review: %w", err)
+	}
+	if affected == 0 {
+		return nil, ErrAlreadyExists
+	}
+	err = putUserRating(tx, other.GetAuthor(), other.GetLaptopId(), other.GetScore())
+	if err != nil {
+		return nil, err
+	}
+	return commitRating(tx, other.GetLaptopId())
+}
+
+func (store *SQLReviewStore) Find(id string) (*pb.Review, error) {
+	review, err := findReview(store.db, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return review, err
+}
+
+func (store *SQLReviewStore) FindByAuthor(laptopID, author string) (*pb.Review, error) {
+	review, err := scanReview(store.db.QueryRow(
+		"SELECT data, helpful_votes FROM reviews WHERE laptop_id = ? AND author = ?", laptopID, author,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return review, err
+}
+
+func (store *SQLReviewStore) List(ctx context.Context, laptopID string, order ReviewOrder, after *pb.Review, limit int) ([]*pb.Review, error) {
+	query := "SELECT data, helpful_votes FROM reviews WHERE laptop_id = ?"
+	args := []interface{}{laptopID}
+	if order == ReviewOrderMostHelpful {
+		if after != nil {
+			query += " AND (helpful_votes, created_at, id) < (?, ?, ?)"
+			args = append(args, after.GetHelpfulVotes(), after.GetCreatedAt().AsTime().UnixNano(), after.GetId())
+		}
+		query += " ORDER BY helpful_votes DESC, created_at DESC, id DESC"
+	} else {
+		if after != nil {
+			query += " AND (created_at, id) < (?, ?)"
+			args = append(args, after.GetCreatedAt().AsTime().UnixNano(), after.GetId())
+		}
+		query += " ORDER BY created_at DESC, id DESC"
+	}
+	query += " LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []*pb.Review
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot query reviews: %w", err)
+	}
+	return reviews, nil
+}
+
+func (store *SQLReviewStore) Vote(id, username string) (*pb.Review, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = findReview(tx, id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO review_votes (review_id, username) VALUES (?, ?) ON CONFLICT DO NOTHING", id, username,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot insert vote: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("cannot insert vote: %w", err)
+	}
+	if affected == 0 {
+		return nil, ErrAlreadyExists
+	}
+
+	_, err = tx.Exec("UPDATE reviews SET helpful_votes = helpful_votes + 1 WHERE id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot update review: %w", err)
+	}
+	review, err := findReview(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("cannot commit vote: %w", err)
+	}
+	return review, nil
+}
+
+// rowScanner *sql.Row和*sql.Rows共同的读取方法
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// findReview 查询review，不存在时返回sql.ErrNoRows
+func findReview(db rowQuerier, id string) (*pb.Review, error) {
+	review, err := scanReview(db.QueryRow("SELECT data, helpful_votes FROM reviews WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return review, err
+}
+
+// scanReview 读取data和helpful_votes列
+func scanReview(row rowScanner) (*pb.Review, error) {
+	var data []byte
+	var votes uint32
+	err := row.Scan(&data, &votes)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot query review: %w", err)
+	}
+	review := &pb.Review{}
+	err = proto.Unmarshal(data, review)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal review: %w", err)
+	}
+	review.HelpfulVotes = votes
+	return review, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SQLUserStore 使用SQL数据库存储用户
+type SQLUserStore struct {
+	db *sql.DB
+}
+
+func NewSQLUserStore(db *sql.DB) *SQLUserStore {
+	return &SQLUserStore{db: db}
+}
+
+// Save 保存User对象
+func (store *SQLUserStore) Save(user *User) error {
+	result, err := store.db.Exec(
+		"INSERT INTO users (username, hashed_password, role) VALUES (?, ?, ?) ON CONFLICT (username) DO NOTHING",
+		user.Username, user.HashedPassword, user.Role,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot insert user: %w", err)
+	}
+	//用户名已存在时不会插入
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot insert user: %w", err)
+	}
+	if affected == 0 {
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// Find 查找User对象
+func (store *SQLUserStore) Find(username string) (*User, error) {
+	user := &User{}
+	err := store.db.QueryRow(
+		"SELECT username, hashed_password, role FROM users WHERE username = ?", username,
+	).Scan(&user.Username, &user.HashedPassword, &user.Role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot query user: %w", err)
+	}
+	return user, nil
+}
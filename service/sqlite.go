@@ -0,0 +1,117 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	_ "github.com/glebarez/go-sqlite" //纯Go实现的SQLite驱动，不依赖cgo
+)
+
+// _sqliteMigrations 数据库结构的迁移脚本，按顺序执行，已执行的数量记录在PRAGMA user_version中
+// 已发布的脚本不能修改，修改结构时需要在末尾追加新的脚本
+var _sqliteMigrations = []string{
+	`CREATE TABLE laptops (
+		id              TEXT PRIMARY KEY,
+		brand           TEXT NOT NULL,
+		name            TEXT NOT NULL,
+		cpu_brand       TEXT NOT NULL,
+		cpu_cores       INTEGER NOT NULL,
+		cpu_min_ghz     REAL NOT NULL,
+		ram_bits        INTEGER NOT NULL,
+		gpu_memory_bits INTEGER NOT NULL,
+		ssd_bits        INTEGER NOT NULL,
+		screen_size     REAL NOT NULL,
+		screen_width    INTEGER NOT NULL,
+		screen_height   INTEGER NOT NULL,
+		screen_panel    INTEGER NOT NULL,
+		backlit         INTEGER NOT NULL,
+		weight_kg       REAL,
+		price_used      REAL NOT NULL,
+		release_year    INTEGER NOT NULL,
+		update_at       INTEGER NOT NULL,
+		revision        INTEGER NOT NULL,
+		data            BLOB NOT NULL
+	);
+	CREATE INDEX laptops_price_used ON laptops (price_used);
+	CREATE INDEX laptops_cpu_cores ON laptops (cpu_cores);
+	CREATE INDEX laptops_cpu_min_ghz ON laptops (cpu_min_ghz);
+	CREATE INDEX laptops_ram_bits ON laptops (ram_bits);`,
+
+	`CREATE TABLE users (
+		username        TEXT PRIMARY KEY,
+		hashed_password TEXT NOT NULL,
+		role            TEXT NOT NULL
+	);`,
+
+	`CREATE TABLE user_ratings (
+		laptop_id TEXT NOT NULL,
+		username  TEXT NOT NULL,
+		score     REAL NOT NULL,
+		PRIMARY KEY (laptop_id, username)
+	);`,
+
+	`CREATE TABLE reviews (
+		id            TEXT PRIMARY KEY,
+		laptop_id     TEXT NOT NULL,
+		author        TEXT NOT NULL,
+		created_at    INTEGER NOT NULL,
+		helpful_votes INTEGER NOT NULL,
+		data          BLOB NOT NULL,
+		UNIQUE (laptop_id, author)
+	);
+	CREATE INDEX reviews_laptop_created_at ON reviews (laptop_id, created_at);
+	CREATE TABLE review_votes (
+		review_id TEXT NOT NULL REFERENCES reviews (id) ON DELETE CASCADE,
+		username  TEXT NOT NULL,
+		PRIMARY KEY (review_id, username)
+	);`,
+}
+
+// OpenSQLite 打开path对应的SQLite数据库，并执行未执行过的迁移脚本，path为":memory:"时使用内存数据库
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("cannot open database: %w", err)
+	}
+	//SQLite同一时间只允许一个写操作，只使用一个连接避免SQLITE_BUSY，内存数据库也只存在于创建它的连接中
+	db.SetMaxOpenConns(1)
+
+	err = migrateSQLite(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrateSQLite 依次执行user_version之后的迁移脚本，每个脚本在单独的事务中执行
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("cannot query schema version: %w", err)
+	}
+	if version > len(_sqliteMigrations) {
+		return fmt.Errorf("schema version %d is newer than supported version %d", version, len(_sqliteMigrations))
+	}
+
+	for i := version; i < len(_sqliteMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("cannot begin migration %d: %w", i+1, err)
+		}
+		_, err = tx.Exec(_sqliteMigrations[i])
+		if err == nil {
+			//PRAGMA不支持参数绑定
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("cannot run migration %d: %w", i+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("cannot commit migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// stagedImage 保存到ImageStore之前暂存在临时文件中的上传数据，写入时同时计算SHA-256，
+// 图片只有在校验通过后才会保存，不需要将整个图片读入内存
+type stagedImage struct {
+	file *os.File
+	hash hash.Hash
+	size int64 //已写入的字节数
+}
+
+// newStagedImage 在系统临时文件夹中创建暂存文件，使用后需要调用remove删除
+func newStagedImage() (*stagedImage, error) {
+	file, err := ioutil.TempFile("", "pcbook-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create temp file: %w", err)
+	}
+	return &stagedImage{file: file, hash: sha256.New()}, nil
+}
+
+func (staged *stagedImage) Write(p []byte) (int, error) {
+	n, err := staged.file.Write(p)
+	staged.hash.Write(p[:n])
+	staged.size += int64(n)
+	return n, err
+}
+
+// checksum 已写入数据的SHA-256(十六进制)
+func (staged *stagedImage) checksum() string {
+	return hex.EncodeToString(staged.hash.Sum(nil))
+}
+
+// reader 从头读取已写入的数据
+func (staged *stagedImage) reader() (io.ReadSeeker, error) {
+	_, err := staged.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek temp file: %w", err)
+	}
+	return staged.file, nil
+}
+
+// remove 关闭并删除暂存文件
+func (staged *stagedImage) remove() {
+	staged.file.Close()
+	os.Remove(staged.file.Name())
+}
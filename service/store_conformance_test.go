@@ -0,0 +1,358 @@
+package service_test
+
+import (
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"pcbook/sample"
+	"pcbook/service"
+	"pcbook/service/s3test"
+	"pcbook/service/storetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInMemoryStores(t *testing.T) {
+	t.Parallel()
+
+	t.Run("laptop", func(t *testing.T) {
+		storetest.TestLaptopStore(t, func(t *testing.T) service.LaptopStore {
+			return service.NewInMemoryLaptopStore()
+		})
+	})
+	t.Run("rate", func(t *testing.T) {
+		storetest.TestRateStore(t, func(t *testing.T) service.RateStore {
+			return service.NewInMemoryRateStore()
+		})
+	})
+	t.Run("review", func(t *testing.T) {
+		storetest.TestReviewStore(t, func(t *testing.T) (service.ReviewStore, service.RateStore) {
+			rateStore := service.NewInMemoryRateStore()
+			return service.NewInMemoryReviewStore(rateStore), rateStore
+		})
+	})
+	t.Run("user", func(t *testing.T) {
+		storetest.TestUserStore(t, func(t *testing.T) service.UserStore {
+			return service.NewInMemoryUserStore()
+		})
+	})
+}
+
+func TestDiskImageStore(t *testing.T) {
+	t.Parallel()
+
+	openStore := func(t *testing.T, imageFolder string) *service.DiskImageStore {
+		store, err := service.OpenDiskImageStore(imageFolder)
+		require.NoError(t, err)
+		return store
+	}
+	storetest.TestImageStore(t, func(t *testing.T) service.ImageStore {
+		return openStore(t, t.TempDir())
+	})
+
+	//重新打开文件夹时读取已保存的图片信息和缩略图
+	t.Run("reopen", func(t *testing.T) {
+		t.Parallel()
+		imageFolder := filepath.Join(t.TempDir(), "img")
+		store := openStore(t, imageFolder)
+		laptopID := sample.NewLaptop().Id
+		id1, err := store.Save(laptopID, ".png", "image/png", strings.NewReader("png data"))
+		require.NoError(t, err)
+		id2, err := store.Save(sample.NewLaptop().Id, ".png", "image/png", strings.NewReader("png data"))
+		require.NoError(t, err)
+		id3, err := store.Save(laptopID, ".jpg", "image/jpeg", strings.NewReader("jpeg data"))
+		require.NoError(t, err)
+		require.NoError(t, store.SaveVariant(id1, 128, "image/png", strings.NewReader("variant")))
+		require.NoError(t, store.Delete(id3))
+		images, err := store.ListByLaptop(laptopID)
+		require.NoError(t, err)
+
+		reopened := openStore(t, imageFolder)
+		found, err := reopened.ListByLaptop(laptopID)
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		require.Equal(t, images[0].ID, found[0].ID)
+		require.Equal(t, images[0].Path, found[0].Path)
+		require.Equal(t, images[0].Checksum, found[0].Checksum)
+		require.True(t, images[0].CreatedAt.Equal(found[0].CreatedAt))
+		require.Equal(t, []int{128}, found[0].Variants)
+		_, reader, err := reopened.OpenVariant(id1, 128)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		require.Equal(t, "variant", string(data))
+
+		//其他图片仍引用相同的内容，删除后重新打开时不会丢失文件
+		require.NoError(t, reopened.Delete(id1))
+		_, reader, err = openStore(t, imageFolder).Open(id2)
+		require.NoError(t, err)
+		data, err = ioutil.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		require.Equal(t, "png data", string(data))
+	})
+}
+
+func TestS3ImageStore(t *testing.T) {
+	t.Parallel()
+
+	server := s3test.NewServer()
+	t.Cleanup(server.Close)
+	openStore := func(t *testing.T, bucket string) *service.S3ImageStore {
+		store, err := service.OpenS3ImageStore(service.S3Config{
+			Endpoint:  server.URL,
+			Bucket:    bucket,
+			AccessKey: "access",
+			SecretKey: "secret",
+		})
+		require.NoError(t, err)
+		return store
+	}
+	storetest.TestImageStore(t, func(t *testing.T) service.ImageStore {
+		//每个测试使用单独的bucket
+		return openStore(t, uuid.New().String())
+	})
+
+	//多个实例共用同一个bucket时可以读取和删除其他实例上传的图片
+	t.Run("shared_bucket", func(t *testing.T) {
+		t.Parallel()
+		bucket := uuid.New().String()
+		store1 := openStore(t, bucket)
+		store2 := openStore(t, bucket)
+		laptopID := sample.NewLaptop().Id
+
+		id, err := store1.Save(laptopID, ".png", "image/png", strings.NewReader("png data"))
+		require.NoError(t, err)
+		require.NoError(t, store1.SaveVariant(id, 128, "image/png", strings.NewReader("variant")))
+		found, err := store2.Find(id)
+		require.NoError(t, err)
+		require.Equal(t, laptopID, found.LaptopID)
+		require.Equal(t, []int{128}, found.Variants)
+		same, err := store2.Save(laptopID, ".png", "image/png", strings.NewReader("png data"))
+		require.NoError(t, err)
+		require.Equal(t, id, same)
+
+		//删除最后一个引用时删除所有对象
+		require.NoError(t, store2.Delete(id))
+		require.Empty(t, server.Keys(bucket, ""))
+	})
+
+	//下载链接不需要签名请求头
+	t.Run("presign", func(t *testing.T) {
+		t.Parallel()
+		store := openStore(t, uuid.New().String())
+		id, err := store.Save(sample.NewLaptop().Id, ".png", "image/png", strings.NewReader("png data"))
+		require.NoError(t, err)
+		_, err = store.PresignImage(id, 128, time.Minute)
+		require.ErrorIs(t, err, service.ErrNotFound)
+		_, err = store.PresignImage("missing", 0, time.Minute)
+		require.ErrorIs(t, err, service.ErrNotFound)
+
+		link, err := store.PresignImage(id, 0, time.Minute)
+		require.NoError(t, err)
+		res, err := http.Get(link)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "image/png", res.Header.Get("Content-Type"))
+		data, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, "png data", string(data))
+	})
+
+	//其他实例同时删除图片时不会留下没有内容的图片或没有引用的缩略图
+	t.Run("concurrent_delete", func(t *testing.T) {
+		t.Parallel()
+		server := s3test.NewServer()
+		defer server.Close()
+		var onPut func(key string)
+		server.OnPut = func(bucket, key string) {
+			if onPut != nil {
+				onPut(key)
+			}
+		}
+		openStore := func() *service.S3ImageStore {
+			store, err := service.OpenS3ImageStore(service.S3Config{
+				Endpoint:  server.URL,
+				Bucket:    "images",
+				AccessKey: "access",
+				SecretKey: "secret",
+			})
+			require.NoError(t, err)
+			return store
+		}
+		store1 := openStore()
+		store2 := openStore()
+		laptopID := sample.NewLaptop().Id
+		id1, err := store1.Save(laptopID, ".png", "image/png", strings.NewReader("png data"))
+		require.NoError(t, err)
+		blobKeys := server.Keys("images", "blobs/")
+		require.Len(t, blobKeys, 1)
+
+		//其他实例可能在记录引用前已确认没有引用，之后才删除内容，内容已存在时也要重新上传
+		var putKeys []string
+		onPut = func(key string) {
+			putKeys = append(putKeys, key)
+		}
+		id2, err := store1.Save(sample.NewLaptop().Id, ".png", "image/png", strings.NewReader("png data"))
+		require.NoError(t, err)
+		require.Contains(t, putKeys, blobKeys[0])
+		require.NoError(t, store2.Delete(id1))
+		_, reader, err := store1.Open(id2)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		require.Equal(t, "png data", string(data))
+
+		//上传缩略图期间图片被删除，上传后删除缩略图
+		onPut = func(key string) {
+			if strings.HasPrefix(key, "blobs/") {
+				onPut = nil
+				require.NoError(t, store2.Delete(id2))
+			}
+		}
+		err = store1.SaveVariant(id2, 128, "image/png", strings.NewReader("variant"))
+		require.ErrorIs(t, err, service.ErrNotFound)
+		require.Empty(t, server.Keys("images", ""))
+	})
+
+	t.Run("invalid_config", func(t *testing.T) {
+		t.Parallel()
+		_, err := service.OpenS3ImageStore(service.S3Config{Endpoint: server.URL})
+		require.Error(t, err)
+		_, err = service.OpenS3ImageStore(service.S3Config{Endpoint: "localhost:9000", Bucket: "images"})
+		require.Error(t, err)
+	})
+}
+
+func TestDiskUploadStore(t *testing.T) {
+	t.Parallel()
+
+	storetest.TestUploadStore(t, func(t *testing.T) service.UploadStore {
+		store, err := service.OpenDiskUploadStore(t.TempDir(), time.Hour, 0)
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+
+	//重启后删除上次运行遗留的数据
+	t.Run("remove_stale_uploads", func(t *testing.T) {
+		t.Parallel()
+		uploadFolder := t.TempDir()
+		stalePath := filepath.Join(uploadFolder, "stale.part")
+		otherPath := filepath.Join(uploadFolder, "other.txt")
+		require.NoError(t, ioutil.WriteFile(stalePath, []byte("stale"), 0644))
+		require.NoError(t, ioutil.WriteFile(otherPath, []byte("other"), 0644))
+
+		store, err := service.OpenDiskUploadStore(uploadFolder, time.Hour, 0)
+		require.NoError(t, err)
+		defer store.Close()
+		require.NoFileExists(t, stalePath)
+		require.FileExists(t, otherPath)
+	})
+
+	//后台定期清除过期的会话及暂存的数据
+	t.Run("cleanup_loop", func(t *testing.T) {
+		t.Parallel()
+		uploadFolder := t.TempDir()
+		store, err := service.OpenDiskUploadStore(uploadFolder, time.Millisecond, time.Millisecond)
+		require.NoError(t, err)
+		defer store.Close()
+
+		session, err := store.Create(sample.NewLaptop().Id, ".png", "")
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			found, err := store.Find(session.ID)
+			return err == nil && found == nil
+		}, time.Second, time.Millisecond)
+		files, err := ioutil.ReadDir(uploadFolder)
+		require.NoError(t, err)
+		require.Empty(t, files)
+	})
+}
+
+func TestSQLStores(t *testing.T) {
+	t.Parallel()
+
+	t.Run("laptop", func(t *testing.T) {
+		storetest.TestLaptopStore(t, func(t *testing.T) service.LaptopStore {
+			return service.NewSQLLaptopStore(openTestDB(t))
+		})
+	})
+	t.Run("rate", func(t *testing.T) {
+		storetest.TestRateStore(t, func(t *testing.T) service.RateStore {
+			return service.NewSQLRateStore(openTestDB(t))
+		})
+	})
+	t.Run("review", func(t *testing.T) {
+		storetest.TestReviewStore(t, func(t *testing.T) (service.ReviewStore, service.RateStore) {
+			db := openTestDB(t)
+			return service.NewSQLReviewStore(db), service.NewSQLRateStore(db)
+		})
+	})
+	t.Run("user", func(t *testing.T) {
+		storetest.TestUserStore(t, func(t *testing.T) service.UserStore {
+			return service.NewSQLUserStore(openTestDB(t))
+		})
+	})
+}
+
+func TestFileStores(t *testing.T) {
+	t.Parallel()
+
+	t.Run("laptop", func(t *testing.T) {
+		storetest.TestLaptopStore(t, func(t *testing.T) service.LaptopStore {
+			return openTestFileStores(t).LaptopStore
+		})
+	})
+	t.Run("rate", func(t *testing.T) {
+		storetest.TestRateStore(t, func(t *testing.T) service.RateStore {
+			return openTestFileStores(t).RateStore
+		})
+	})
+	t.Run("review", func(t *testing.T) {
+		storetest.TestReviewStore(t, func(t *testing.T) (service.ReviewStore, service.RateStore) {
+			stores := openTestFileStores(t)
+			return stores.ReviewStore, stores.RateStore
+		})
+	})
+	t.Run("user", func(t *testing.T) {
+		storetest.TestUserStore(t, func(t *testing.T) service.UserStore {
+			return openTestFileStores(t).UserStore
+		})
+	})
+}
+
+func TestEventLaptopStore(t *testing.T) {
+	t.Parallel()
+
+	storetest.TestLaptopStore(t, func(t *testing.T) service.LaptopStore {
+		return service.NewEventLaptopStore(service.NewInMemoryLaptopStore(), service.NewLaptopEventBus(10))
+	})
+}
+
+// openTestDB 打开一个测试用的内存数据库，测试结束后关闭
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := service.OpenSQLite(":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+// openTestFileStores 在临时目录中打开文件存储器，测试结束后关闭
+func openTestFileStores(t *testing.T) *service.FileStores {
+	stores, err := service.OpenFileStores(t.TempDir(), 0)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		stores.Close()
+	})
+	return stores
+}
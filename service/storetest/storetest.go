@@ -0,0 +1,1209 @@
+// Package storetest 提供LaptopStore、RateStore、ReviewStore、UserStore、ImageStore和UploadStore的通用测试，
+// 新的存储器实现只需要在自己的测试中调用对应的TestXxx方法，例如：
+//
+//	func TestInMemoryLaptopStore(t *testing.T) {
+//		storetest.TestLaptopStore(t, func(t *testing.T) service.LaptopStore {
+//			return service.NewInMemoryLaptopStore()
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io/ioutil"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/service"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLaptopStore 测试LaptopStore的实现，newStore每次调用都需要返回一个空的存储器
+func TestLaptopStore(t *testing.T, newStore func(t *testing.T) service.LaptopStore) {
+	t.Run("save_duplicate_id", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptop := sample.NewLaptop()
+		require.NoError(t, store.Save(laptop))
+		require.ErrorIs(t, store.Save(laptop), service.ErrAlreadyExists)
+	})
+
+	t.Run("save_sets_revision", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptop := sample.NewLaptop()
+		laptop.UpdateAt = nil
+		laptop.Revision = 10
+		require.NoError(t, store.Save(laptop))
+
+		found, err := store.Find(laptop.Id)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, found.GetRevision())
+		require.NotNil(t, found.GetUpdateAt())
+		//不会修改传入的laptop
+		require.EqualValues(t, 10, laptop.GetRevision())
+		require.Nil(t, laptop.GetUpdateAt())
+	})
+
+	t.Run("find_missing", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		found, err := store.Find(sample.NewLaptop().Id)
+		require.NoError(t, err)
+		require.Nil(t, found)
+	})
+
+	t.Run("deep_copy", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptop := sample.NewLaptop()
+		require.NoError(t, store.Save(laptop))
+		expected, err := store.Find(laptop.Id)
+		require.NoError(t, err)
+
+		//修改保存时传入的laptop
+		laptop.Name = "changed"
+		laptop.Cpu.NumberCores = 64
+		laptop.Gpus[0].Name = "changed"
+		requireStored(t, store, expected)
+
+		//修改查询返回的laptop
+		found, err := store.Find(laptop.Id)
+		require.NoError(t, err)
+		found.Cpu.NumberCores = 64
+		found.Gpus[0].Name = "changed"
+		found.Weight = &pb.Laptop_WeightKg{WeightKg: 100}
+		requireStored(t, store, expected)
+
+		//修改搜索结果
+		err = store.Search(context.Background(), &pb.Filter{MaxPriceUsed: 1e6}, service.SearchOptions{}, func(laptop *pb.Laptop) error {
+			laptop.Storages[0].Memory.Value = 1
+			return nil
+		})
+		require.NoError(t, err)
+		requireStored(t, store, expected)
+
+		//修改分页查询结果
+		laptops, err := store.List(context.Background(), nil, nil, 10)
+		require.NoError(t, err)
+		require.Len(t, laptops, 1)
+		laptops[0].Screen.Resolution.Width = 1
+		requireStored(t, store, expected)
+
+		//修改更新时传入的laptop及更新结果
+		mask := &fieldmaskpb.FieldMask{Paths: []string{"gpus"}}
+		update := &pb.Laptop{Id: laptop.Id, Gpus: []*pb.GPU{sample.NewGPU()}}
+		updated, err := store.Update(update, mask, 0)
+		require.NoError(t, err)
+		expected = proto.Clone(updated).(*pb.Laptop)
+		update.Gpus[0].Name = "changed"
+		updated.Gpus[0].Name = "changed"
+		requireStored(t, store, expected)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptop := sample.NewLaptop()
+		require.NoError(t, store.Save(laptop))
+
+		_, err := store.Update(sample.NewLaptop(), nil, 0)
+		require.ErrorIs(t, err, service.ErrNotFound)
+
+		mask := &fieldmaskpb.FieldMask{Paths: []string{"price_used", "cpu.number_cores"}}
+		update := &pb.Laptop{Id: laptop.Id, PriceUsed: 1234, Cpu: &pb.CPU{NumberCores: 6}}
+		_, err = store.Update(update, mask, 2)
+		require.ErrorIs(t, err, service.ErrRevisionMismatch)
+		_, err = store.Update(update, &fieldmaskpb.FieldMask{Paths: []string{"unknown"}}, 1)
+		require.ErrorIs(t, err, service.ErrInvalidFieldMask)
+
+		updated, err := store.Update(update, mask, 1)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, updated.GetRevision())
+		require.Equal(t, 1234.0, updated.GetPriceUsed())
+		require.EqualValues(t, 6, updated.GetCpu().GetNumberCores())
+		require.Equal(t, laptop.GetCpu().GetName(), updated.GetCpu().GetName())
+		requireStored(t, store, updated)
+
+		//mask为空时整体替换
+		replacement := sample.NewLaptop()
+		replacement.Id = laptop.Id
+		replaced, err := store.Update(replacement, nil, 0)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, replaced.GetRevision())
+		require.Equal(t, replacement.GetName(), replaced.GetName())
+		requireStored(t, store, replaced)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptop := sample.NewLaptop()
+		require.NoError(t, store.Save(laptop))
+		require.NoError(t, store.Delete(laptop.Id))
+		require.ErrorIs(t, store.Delete(laptop.Id), service.ErrNotFound)
+
+		found, err := store.Find(laptop.Id)
+		require.NoError(t, err)
+		require.Nil(t, found)
+		//删除后可以使用相同的id重新保存
+		require.NoError(t, store.Save(laptop))
+	})
+
+	t.Run("search_filter", func(t *testing.T) {
+		t.Parallel()
+		testSearchFilter(t, newStore(t))
+	})
+
+	t.Run("search_order", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		prices := []float64{1500, 2500, 2000, 3000, 1000}
+		ids := make(map[float64]string)
+		for _, price := range prices {
+			laptop := sample.NewLaptop()
+			laptop.PriceUsed = price
+			require.NoError(t, store.Save(laptop))
+			ids[price] = laptop.Id
+		}
+
+		options := service.SearchOptions{
+			Order:      service.LaptopOrder{{Path: "price_used", Desc: true}},
+			MaxResults: 3,
+		}
+		found := search(t, store, &pb.Filter{MaxPriceUsed: 2800}, options)
+		require.Equal(t, []string{ids[2500], ids[2000], ids[1500]}, found)
+
+		//按评分排序，评分由调用方提供
+		ratings := map[string]float64{ids[1000]: 9, ids[3000]: 7}
+		options = service.SearchOptions{
+			Order:      service.LaptopOrder{{Path: "rating", Desc: true}, {Path: "price_used"}},
+			MaxResults: 4,
+			Rating: func(laptopID string) float64 {
+				return ratings[laptopID]
+			},
+		}
+		found = search(t, store, &pb.Filter{MaxPriceUsed: 3000}, options)
+		require.Equal(t, []string{ids[1000], ids[3000], ids[1500], ids[2000]}, found)
+
+		//使用Match代替filter
+		options = service.SearchOptions{
+			Match: func(laptop *pb.Laptop) bool {
+				return laptop.GetPriceUsed() >= 2500
+			},
+		}
+		found = search(t, store, nil, options)
+		sort.Strings(found)
+		expected := []string{ids[2500], ids[3000]}
+		sort.Strings(expected)
+		require.Equal(t, expected, found)
+	})
+
+	t.Run("search_canceled", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, store.Save(sample.NewLaptop()))
+		}
+
+		//在接收到第一个结果后取消，之后不会再调用回调
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		count := 0
+		err := store.Search(ctx, &pb.Filter{MaxPriceUsed: 1e6}, service.SearchOptions{}, func(laptop *pb.Laptop) error {
+			count++
+			cancel()
+			return nil
+		})
+		require.Error(t, err)
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		var expected []*pb.Laptop
+		for i := 0; i < 25; i++ {
+			laptop := sample.NewLaptop()
+			laptop.Brand = []string{"Apple", "Dell", "Lenovo"}[i%3]
+			require.NoError(t, store.Save(laptop))
+			found, err := store.Find(laptop.Id)
+			require.NoError(t, err)
+			expected = append(expected, found)
+		}
+		order, err := service.ParseLaptopOrder("brand desc, price_used")
+		require.NoError(t, err)
+		sort.Slice(expected, func(i, j int) bool {
+			return order.Compare(expected[i], expected[j]) < 0
+		})
+
+		var actual []*pb.Laptop
+		var after *pb.Laptop
+		for {
+			laptops, err := store.List(context.Background(), order, after, 10)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(laptops), 10)
+			if len(laptops) == 0 {
+				break
+			}
+			actual = append(actual, laptops...)
+			//after只需要包含排序字段
+			after = &pb.Laptop{
+				Id:        laptops[len(laptops)-1].Id,
+				Brand:     laptops[len(laptops)-1].Brand,
+				PriceUsed: laptops[len(laptops)-1].PriceUsed,
+			}
+		}
+		require.Equal(t, len(expected), len(actual))
+		for i := range expected {
+			require.True(t, proto.Equal(expected[i], actual[i]))
+		}
+	})
+
+	t.Run("aggregate", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		for _, price := range []float64{1200, 1800, 2600} {
+			laptop := sample.NewLaptop()
+			laptop.PriceUsed = price
+			require.NoError(t, store.Save(laptop))
+		}
+
+		aggregation, err := store.Aggregate(context.Background(), &pb.Filter{MaxPriceUsed: 2000})
+		require.NoError(t, err)
+		require.EqualValues(t, 2, aggregation.GetTotalCount())
+		require.Equal(t, 1200.0, aggregation.GetMinPrice())
+		require.Equal(t, 1800.0, aggregation.GetMaxPrice())
+		require.InDelta(t, 1500.0, aggregation.GetAvgPrice(), 1e-9)
+	})
+
+	t.Run("concurrent_writers", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		shared := sample.NewLaptop()
+		require.NoError(t, store.Save(shared))
+
+		const writers, laptopsPerWriter = 8, 10
+		mask := &fieldmaskpb.FieldMask{Paths: []string{"name"}}
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				//在其他协程中不能调用require，失败时需要由assert记录错误
+				for j := 0; j < laptopsPerWriter; j++ {
+					laptop := sample.NewLaptop()
+					assert.NoError(t, store.Save(laptop))
+					//多个协程同时更新同一个laptop，不会丢失更新
+					_, err := store.Update(&pb.Laptop{Id: shared.Id, Name: laptop.Name}, mask, 0)
+					assert.NoError(t, err)
+					found, err := store.Find(laptop.Id)
+					assert.NoError(t, err)
+					assert.Equal(t, laptop.Name, found.GetName())
+				}
+			}()
+		}
+		wg.Wait()
+
+		laptops, err := store.List(context.Background(), nil, nil, writers*laptopsPerWriter+10)
+		require.NoError(t, err)
+		require.Len(t, laptops, writers*laptopsPerWriter+1)
+		found, err := store.Find(shared.Id)
+		require.NoError(t, err)
+		require.EqualValues(t, writers*laptopsPerWriter+1, found.GetRevision())
+	})
+}
+
+// testSearchFilter 测试filter的边界条件
+func testSearchFilter(t *testing.T, store service.LaptopStore) {
+	newLaptop := func(update func(laptop *pb.Laptop)) string {
+		laptop := sample.NewLaptop()
+		laptop.Brand = "Apple"
+		laptop.PriceUsed = 2000
+		laptop.Cpu.Brand = "Intel"
+		laptop.Cpu.NumberCores = 4
+		laptop.Cpu.MinGhz = 2.5
+		laptop.Ram = &pb.Memory{Value: 16, Unit: pb.Memory_GIGABYTE}
+		laptop.Weight = &pb.Laptop_WeightKg{WeightKg: 2}
+		laptop.ReleaseYear = 2020
+		update(laptop)
+		require.NoError(t, store.Save(laptop))
+		return laptop.Id
+	}
+	base := newLaptop(func(laptop *pb.Laptop) {})
+	cheap := newLaptop(func(laptop *pb.Laptop) { laptop.PriceUsed = 1000 })
+	ramMB := newLaptop(func(laptop *pb.Laptop) {
+		laptop.Ram = &pb.Memory{Value: 16 * 1024, Unit: pb.Memory_MEGABYTE}
+	})
+	lowerCase := newLaptop(func(laptop *pb.Laptop) { laptop.Brand = "apple" })
+	noWeight := newLaptop(func(laptop *pb.Laptop) { laptop.Weight = nil })
+	pounds := newLaptop(func(laptop *pb.Laptop) { laptop.Weight = &pb.Laptop_WeightLb{WeightLb: 4.4} })
+	amd := newLaptop(func(laptop *pb.Laptop) { laptop.Cpu.Brand = "AMD" })
+	old := newLaptop(func(laptop *pb.Laptop) { laptop.ReleaseYear = 2015 })
+
+	all := []string{base, cheap, ramMB, lowerCase, noWeight, pounds, amd, old}
+	except := func(excluded ...string) []string {
+		var ids []string
+		for _, id := range all {
+			keep := true
+			for _, e := range excluded {
+				keep = keep && id != e
+			}
+			if keep {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	testCases := []struct {
+		name     string
+		filter   *pb.Filter
+		expected []string
+	}{
+		{"nil_filter_matches_nothing", nil, nil},
+		{"max_price_inclusive", &pb.Filter{MaxPriceUsed: 2000}, all},
+		{"max_price", &pb.Filter{MaxPriceUsed: 1999.99}, []string{cheap}},
+		{"min_price_inclusive", &pb.Filter{MinPriceUsed: 2000, MaxPriceUsed: 3000}, except(cheap)},
+		{"cpu_inclusive", &pb.Filter{MaxPriceUsed: 3000, MinCpuCores: 4, MinCpuGhz: 2.5}, all},
+		{"cpu_cores", &pb.Filter{MaxPriceUsed: 3000, MinCpuCores: 5}, nil},
+		{"ram_unit_conversion", &pb.Filter{MaxPriceUsed: 3000, MinRam: &pb.Memory{Value: 16384, Unit: pb.Memory_MEGABYTE}}, all},
+		{"ram", &pb.Filter{MaxPriceUsed: 3000, MinRam: &pb.Memory{Value: 17, Unit: pb.Memory_GIGABYTE}}, nil},
+		{"brand_ignore_case", &pb.Filter{MaxPriceUsed: 3000, Brands: []string{"APPLE"}}, all},
+		{"cpu_brand", &pb.Filter{MaxPriceUsed: 3000, CpuBrands: []string{"amd", "Qualcomm"}}, []string{amd}},
+		{"weight_unknown_excluded", &pb.Filter{MaxPriceUsed: 3000, MaxWeightKg: 2}, except(noWeight)},
+		{"weight_pounds", &pb.Filter{MaxPriceUsed: 3000, MaxWeightKg: 1.999}, []string{pounds}},
+		{"release_year", &pb.Filter{MaxPriceUsed: 3000, MaxReleaseYear: 2019}, []string{old}},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			expected := append([]string{}, tc.expected...)
+			sort.Strings(expected)
+			found := search(t, store, tc.filter, service.SearchOptions{})
+			sort.Strings(found)
+			require.ElementsMatch(t, expected, found)
+
+			aggregation, err := store.Aggregate(context.Background(), tc.filter)
+			require.NoError(t, err)
+			require.EqualValues(t, len(expected), aggregation.GetTotalCount())
+		})
+	}
+
+	//MaxResults限制返回的数量
+	found := search(t, store, &pb.Filter{MaxPriceUsed: 3000}, service.SearchOptions{MaxResults: 3})
+	require.Len(t, found, 3)
+}
+
+// search 返回搜索结果的id，保持返回的顺序
+func search(t *testing.T, store service.LaptopStore, filter *pb.Filter, options service.SearchOptions) []string {
+	var ids []string
+	err := store.Search(context.Background(), filter, options, func(laptop *pb.Laptop) error {
+		ids = append(ids, laptop.GetId())
+		return nil
+	})
+	require.NoError(t, err)
+	return ids
+}
+
+// requireStored 判断存储的laptop与expected一致
+func requireStored(t *testing.T, store service.LaptopStore, expected *pb.Laptop) {
+	found, err := store.Find(expected.GetId())
+	require.NoError(t, err)
+	require.True(t, proto.Equal(expected, found), "stored laptop is modified")
+}
+
+// TestRateStore 测试RateStore的实现，newStore每次调用都需要返回一个空的存储器
+func TestRateStore(t *testing.T, newStore func(t *testing.T) service.RateStore) {
+	t.Run("rate_and_find", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		rating, err := store.Find(laptopID)
+		require.NoError(t, err)
+		require.Nil(t, rating)
+
+		for i, username := range []string{"user1", "user2", "user3"} {
+			rating, err = store.Rate(username, laptopID, float64(8-3*i))
+			require.NoError(t, err)
+			require.EqualValues(t, i+1, rating.Count)
+		}
+		require.Equal(t, 15.0, rating.Sum)
+		require.Equal(t, 5.0, rating.Average())
+
+		//修改返回的评分不影响存储的数据
+		rating.Count = 100
+		found, err := store.Find(laptopID)
+		require.NoError(t, err)
+		require.EqualValues(t, 3, found.Count)
+
+		other, err := store.Find(sample.NewLaptop().Id)
+		require.NoError(t, err)
+		require.Nil(t, other)
+	})
+
+	t.Run("rate_again_replaces_score", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		_, err := store.Rate("user1", laptopID, 8)
+		require.NoError(t, err)
+		_, err = store.Rate("user2", laptopID, 4)
+		require.NoError(t, err)
+		rating, err := store.Rate("user1", laptopID, 2)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, rating.Count)
+		require.Equal(t, 3.0, rating.Average())
+
+		userRating, err := store.FindUserRating("user1", laptopID)
+		require.NoError(t, err)
+		require.Equal(t, &service.UserRating{Username: "user1", LaptopID: laptopID, Score: 2}, userRating)
+
+		userRating, err = store.FindUserRating("user3", laptopID)
+		require.NoError(t, err)
+		require.Nil(t, userRating)
+	})
+
+	t.Run("histogram_and_total", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID1 := sample.NewLaptop().Id
+		laptopID2 := sample.NewLaptop().Id
+
+		total, err := store.Total()
+		require.NoError(t, err)
+		require.EqualValues(t, 0, total.Count)
+
+		for _, username := range []string{"user1", "user2", "user3"} {
+			_, err = store.Rate(username, laptopID1, 9.5)
+			require.NoError(t, err)
+		}
+		_, err = store.Rate("user4", laptopID1, 3)
+		require.NoError(t, err)
+		_, err = store.Rate("user1", laptopID2, 6)
+		require.NoError(t, err)
+
+		//重新评分后原分数的次数减少
+		rating, err := store.Rate("user3", laptopID1, 3)
+		require.NoError(t, err)
+		require.Equal(t, map[float64]uint32{9.5: 2, 3: 2}, rating.Histogram)
+		found, err := store.Find(laptopID1)
+		require.NoError(t, err)
+		require.Equal(t, map[float64]uint32{9.5: 2, 3: 2}, found.Histogram)
+		require.Equal(t, 6.25, found.Median())
+
+		total, err = store.Total()
+		require.NoError(t, err)
+		require.EqualValues(t, 5, total.Count)
+		require.Equal(t, 31.0, total.Sum)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		_, err := store.Delete("user1", laptopID)
+		require.ErrorIs(t, err, service.ErrNotFound)
+
+		_, err = store.Rate("user1", laptopID, 8)
+		require.NoError(t, err)
+		_, err = store.Rate("user2", laptopID, 4)
+		require.NoError(t, err)
+
+		rating, err := store.Delete("user1", laptopID)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, rating.Count)
+		require.Equal(t, 4.0, rating.Average())
+		userRating, err := store.FindUserRating("user1", laptopID)
+		require.NoError(t, err)
+		require.Nil(t, userRating)
+		_, err = store.Delete("user1", laptopID)
+		require.ErrorIs(t, err, service.ErrNotFound)
+
+		//删除最后一个评分后视为未评分
+		rating, err = store.Delete("user2", laptopID)
+		require.NoError(t, err)
+		require.EqualValues(t, 0, rating.Count)
+		found, err := store.Find(laptopID)
+		require.NoError(t, err)
+		require.Nil(t, found)
+	})
+
+	t.Run("concurrent_rates", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		const writers, scoresPerWriter = 8, 25
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				//每个用户重复评分，最终只保留最后一次
+				for j := 0; j < scoresPerWriter; j++ {
+					_, err := store.Rate(fmt.Sprintf("user%d", i), laptopID, float64(j%5))
+					assert.NoError(t, err)
+				}
+				_, err := store.Rate(fmt.Sprintf("user%d", i), laptopID, 2)
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		rating, err := store.Find(laptopID)
+		require.NoError(t, err)
+		require.EqualValues(t, writers, rating.Count)
+		require.Equal(t, float64(2*writers), rating.Sum)
+	})
+}
+
+// TestReviewStore 测试ReviewStore的实现，newStores每次调用都需要返回一组空的存储器，review的分数记录在返回的RateStore中
+func TestReviewStore(t *testing.T, newStores func(t *testing.T) (service.ReviewStore, service.RateStore)) {
+	t.Run("save_and_find", func(t *testing.T) {
+		t.Parallel()
+		store, _ := newStores(t)
+		laptopID := sample.NewLaptop().Id
+
+		review := newReview(laptopID, "user1", time.Now())
+		review.HelpfulVotes = 5
+		require.NoError(t, saveReview(store, review))
+		//id重复，或同一作者重复评价同一laptop
+		require.ErrorIs(t, saveReview(store, review), service.ErrAlreadyExists)
+		require.ErrorIs(t, saveReview(store, newReview(laptopID, "user1", time.Now())), service.ErrAlreadyExists)
+		require.NoError(t, saveReview(store, newReview(laptopID, "user2", time.Now())))
+		require.NoError(t, saveReview(store, newReview(sample.NewLaptop().Id, "user1", time.Now())))
+
+		//投票数由存储器维护，修改保存时传入的对象及查询结果不影响存储的数据
+		review.Title = "changed"
+		found, err := store.Find(review.Id)
+		require.NoError(t, err)
+		require.EqualValues(t, 0, found.GetHelpfulVotes())
+		require.Equal(t, "title of user1", found.GetTitle())
+		require.True(t, found.GetCreatedAt().AsTime().Equal(review.GetCreatedAt().AsTime()))
+		found.Title = "changed"
+		found, err = store.Find(review.Id)
+		require.NoError(t, err)
+		require.Equal(t, "title of user1", found.GetTitle())
+
+		found, err = store.Find("missing")
+		require.NoError(t, err)
+		require.Nil(t, found)
+
+		found, err = store.FindByAuthor(laptopID, "user1")
+		require.NoError(t, err)
+		require.Equal(t, review.Id, found.GetId())
+		found, err = store.FindByAuthor(laptopID, "user3")
+		require.NoError(t, err)
+		require.Nil(t, found)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		t.Parallel()
+		store, _ := newStores(t)
+		laptopID := sample.NewLaptop().Id
+		require.NoError(t, saveReview(store, newReview(sample.NewLaptop().Id, "user0", time.Now())))
+
+		//review[i]的创建时间为第i秒，review[3]与review[2]创建时间相同
+		base := time.Now().Truncate(time.Second)
+		reviews := make([]*pb.Review, 5)
+		for i := range reviews {
+			createdAt := base.Add(time.Duration(i) * time.Second)
+			if i == 3 {
+				createdAt = base.Add(2 * time.Second)
+			}
+			reviews[i] = newReview(laptopID, fmt.Sprintf("user%d", i+1), createdAt)
+			require.NoError(t, saveReview(store, reviews[i]))
+		}
+		//review[1]得到2票，review[3]得到1票
+		for _, vote := range []struct {
+			review   int
+			username string
+		}{{1, "voter1"}, {1, "voter2"}, {3, "voter1"}} {
+			_, err := store.Vote(reviews[vote.review].Id, vote.username)
+			require.NoError(t, err)
+		}
+
+		//创建时间相同时按id从大到小
+		newest := []string{reviews[4].Id, reviews[2].Id, reviews[3].Id, reviews[1].Id, reviews[0].Id}
+		if reviews[3].Id > reviews[2].Id {
+			newest[1], newest[2] = newest[2], newest[1]
+		}
+		require.Equal(t, newest, listReviews(t, store, laptopID, service.ReviewOrderNewest, 2))
+
+		helpful := []string{reviews[1].Id, reviews[3].Id, reviews[4].Id, reviews[2].Id, reviews[0].Id}
+		require.Equal(t, helpful, listReviews(t, store, laptopID, service.ReviewOrderMostHelpful, 2))
+
+		found, err := store.List(context.Background(), laptopID, service.ReviewOrderMostHelpful, nil, 1)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, found[0].GetHelpfulVotes())
+
+		found, err = store.List(context.Background(), sample.NewLaptop().Id, service.ReviewOrderNewest, nil, 10)
+		require.NoError(t, err)
+		require.Empty(t, found)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = store.List(ctx, laptopID, service.ReviewOrderNewest, nil, 10)
+		require.Error(t, err)
+	})
+
+	t.Run("vote", func(t *testing.T) {
+		t.Parallel()
+		store, _ := newStores(t)
+		review := newReview(sample.NewLaptop().Id, "user1", time.Now())
+		require.NoError(t, saveReview(store, review))
+
+		_, err := store.Vote("missing", "user2")
+		require.ErrorIs(t, err, service.ErrNotFound)
+
+		voted, err := store.Vote(review.Id, "user2")
+		require.NoError(t, err)
+		require.EqualValues(t, 1, voted.GetHelpfulVotes())
+		require.Equal(t, review.GetTitle(), voted.GetTitle())
+		_, err = store.Vote(review.Id, "user2")
+		require.ErrorIs(t, err, service.ErrAlreadyExists)
+		voted, err = store.Vote(review.Id, "user3")
+		require.NoError(t, err)
+		require.EqualValues(t, 2, voted.GetHelpfulVotes())
+
+		found, err := store.Find(review.Id)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, found.GetHelpfulVotes())
+	})
+
+	t.Run("concurrent_votes", func(t *testing.T) {
+		t.Parallel()
+		store, _ := newStores(t)
+		review := newReview(sample.NewLaptop().Id, "user1", time.Now())
+		require.NoError(t, saveReview(store, review))
+
+		//每个用户投票两次，只有一次生效
+		const voters = 20
+		var wg sync.WaitGroup
+		for i := 0; i < voters*2; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := store.Vote(review.Id, fmt.Sprintf("voter%d", i%voters))
+				if err != nil {
+					assert.ErrorIs(t, err, service.ErrAlreadyExists)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		found, err := store.Find(review.Id)
+		require.NoError(t, err)
+		require.EqualValues(t, voters, found.GetHelpfulVotes())
+	})
+	t.Run("save_records_rating", func(t *testing.T) {
+		t.Parallel()
+		store, rateStore := newStores(t)
+		laptopID := sample.NewLaptop().Id
+
+		//评价的分数替换作者之前的评分
+		_, err := rateStore.Rate("user1", laptopID, 2)
+		require.NoError(t, err)
+		_, err = rateStore.Rate("user2", laptopID, 4)
+		require.NoError(t, err)
+		review := newReview(laptopID, "user1", time.Now())
+		review.Score = 8
+		rating, err := store.Save(review)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, rating.Count)
+		require.Equal(t, 6.0, rating.Average())
+		userRating, err := rateStore.FindUserRating("user1", laptopID)
+		require.NoError(t, err)
+		require.Equal(t, 8.0, userRating.Score)
+
+		//重复评价时评分不变
+		again := newReview(laptopID, "user1", time.Now())
+		again.Score = 1
+		_, err = store.Save(again)
+		require.ErrorIs(t, err, service.ErrAlreadyExists)
+		userRating, err = rateStore.FindUserRating("user1", laptopID)
+		require.NoError(t, err)
+		require.Equal(t, 8.0, userRating.Score)
+	})
+
+	t.Run("reviewed_rating_is_fixed", func(t *testing.T) {
+		t.Parallel()
+		store, rateStore := newStores(t)
+		laptopID := sample.NewLaptop().Id
+		review := newReview(laptopID, "user1", time.Now())
+		review.Score = 8
+		require.NoError(t, saveReview(store, review))
+
+		//评价后评分以评价为准，不能单独修改或删除，其他用户和其他laptop不受影响
+		_, err := rateStore.Rate("user1", laptopID, 2)
+		require.ErrorIs(t, err, service.ErrReviewedRating)
+		_, err = rateStore.Delete("user1", laptopID)
+		require.ErrorIs(t, err, service.ErrReviewedRating)
+		userRating, err := rateStore.FindUserRating("user1", laptopID)
+		require.NoError(t, err)
+		require.Equal(t, 8.0, userRating.Score)
+
+		_, err = rateStore.Rate("user2", laptopID, 2)
+		require.NoError(t, err)
+		_, err = rateStore.Rate("user1", sample.NewLaptop().Id, 2)
+		require.NoError(t, err)
+	})
+
+	t.Run("concurrent_saves", func(t *testing.T) {
+		t.Parallel()
+		store, rateStore := newStores(t)
+		laptopID := sample.NewLaptop().Id
+
+		//同一用户同时评价和评分，只有一条评价成功，评分始终与评价的分数一致
+		const writers = 10
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				review := newReview(laptopID, "user1", time.Now())
+				review.Score = float64(i)
+				_, err := store.Save(review)
+				if err != nil {
+					assert.ErrorIs(t, err, service.ErrAlreadyExists)
+				}
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				_, err := rateStore.Rate("user1", laptopID, float64(writers+i))
+				if err != nil {
+					assert.ErrorIs(t, err, service.ErrReviewedRating)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		review, err := store.FindByAuthor(laptopID, "user1")
+		require.NoError(t, err)
+		userRating, err := rateStore.FindUserRating("user1", laptopID)
+		require.NoError(t, err)
+		require.Equal(t, review.GetScore(), userRating.Score)
+		rating, err := rateStore.Find(laptopID)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, rating.Count)
+	})
+}
+
+// saveReview 保存review，只返回错误
+func saveReview(store service.ReviewStore, review *pb.Review) error {
+	_, err := store.Save(review)
+	return err
+}
+
+// newReview 生成一个测试用的review
+func newReview(laptopID, author string, createdAt time.Time) *pb.Review {
+	return &pb.Review{
+		Id:        uuid.New().String(),
+		LaptopId:  laptopID,
+		Author:    author,
+		Score:     8,
+		Title:     "title of " + author,
+		Body:      "body of " + author,
+		CreatedAt: timestamppb.New(createdAt),
+	}
+}
+
+// listReviews 每页pageSize条，依次翻页查询laptop的所有review，返回id
+func listReviews(t *testing.T, store service.ReviewStore, laptopID string, order service.ReviewOrder, pageSize int) []string {
+	var ids []string
+	var after *pb.Review
+	for {
+		reviews, err := store.List(context.Background(), laptopID, order, after, pageSize)
+		require.NoError(t, err)
+		for _, review := range reviews {
+			ids = append(ids, review.GetId())
+		}
+		if len(reviews) < pageSize {
+			return ids
+		}
+		after = reviews[len(reviews)-1]
+	}
+}
+
+// TestUserStore 测试UserStore的实现，newStore每次调用都需要返回一个空的存储器
+func TestUserStore(t *testing.T, newStore func(t *testing.T) service.UserStore) {
+	t.Run("save_and_find", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		user := &service.User{Username: "admin1", HashedPassword: "hash", Role: "admin"}
+		require.NoError(t, store.Save(user))
+		require.ErrorIs(t, store.Save(&service.User{Username: "admin1", Role: "user"}), service.ErrAlreadyExists)
+
+		//修改保存时传入的对象及查询结果不影响存储的数据
+		user.Role = "user"
+		found, err := store.Find("admin1")
+		require.NoError(t, err)
+		require.Equal(t, "admin", found.Role)
+		require.Equal(t, "hash", found.HashedPassword)
+		found.Role = "user"
+		found, err = store.Find("admin1")
+		require.NoError(t, err)
+		require.Equal(t, "admin", found.Role)
+
+		found, err = store.Find("unknown")
+		require.NoError(t, err)
+		require.Nil(t, found)
+	})
+
+	t.Run("concurrent_saves", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+
+		//多个协程同时保存同一个用户，只有一个成功
+		const writers = 8
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- store.Save(&service.User{Username: "user1", Role: "user"})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		saved := 0
+		for err := range errs {
+			if err == nil {
+				saved++
+			} else {
+				require.ErrorIs(t, err, service.ErrAlreadyExists)
+			}
+		}
+		require.Equal(t, 1, saved)
+	})
+}
+
+// TestImageStore 测试ImageStore的实现，newStore每次调用都需要返回一个空的存储器
+func TestImageStore(t *testing.T, newStore func(t *testing.T) service.ImageStore) {
+	t.Run("save_and_open", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		id, err := store.Save(laptopID, ".png", "image/png", strings.NewReader("png data"))
+		require.NoError(t, err)
+		require.NotEmpty(t, id)
+
+		info, reader, err := store.Open(id)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, "png data", string(data))
+		require.Equal(t, id, info.ID)
+		require.Equal(t, laptopID, info.LaptopID)
+		require.Equal(t, ".png", info.Type)
+		require.Equal(t, "image/png", info.MIMEType)
+		require.EqualValues(t, len(data), info.Size)
+		require.False(t, info.CreatedAt.IsZero())
+
+		found, err := store.Find(id)
+		require.NoError(t, err)
+		require.Equal(t, info, found)
+
+		_, _, err = store.Open("missing")
+		require.ErrorIs(t, err, service.ErrNotFound)
+		found, err = store.Find("missing")
+		require.NoError(t, err)
+		require.Nil(t, found)
+	})
+
+	t.Run("list_by_laptop", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		var ids []string
+		for i := 0; i < 3; i++ {
+			id, err := store.Save(laptopID, ".jpg", "image/jpeg", strings.NewReader(fmt.Sprintf("image %d", i)))
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		_, err := store.Save(sample.NewLaptop().Id, ".jpg", "image/jpeg", strings.NewReader("other"))
+		require.NoError(t, err)
+
+		images, err := store.ListByLaptop(laptopID)
+		require.NoError(t, err)
+		var listed []string
+		for i, image := range images {
+			require.Equal(t, laptopID, image.LaptopID)
+			if i > 0 {
+				require.False(t, image.CreatedAt.Before(images[i-1].CreatedAt))
+			}
+			listed = append(listed, image.ID)
+		}
+		require.ElementsMatch(t, ids, listed)
+
+		images, err = store.ListByLaptop(sample.NewLaptop().Id)
+		require.NoError(t, err)
+		require.Empty(t, images)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		id, err := store.Save(laptopID, ".png", "image/png", strings.NewReader("png data"))
+		require.NoError(t, err)
+		require.NoError(t, store.Delete(id))
+		require.ErrorIs(t, store.Delete(id), service.ErrNotFound)
+
+		found, err := store.Find(id)
+		require.NoError(t, err)
+		require.Nil(t, found)
+		_, _, err = store.Open(id)
+		require.ErrorIs(t, err, service.ErrNotFound)
+		images, err := store.ListByLaptop(laptopID)
+		require.NoError(t, err)
+		require.Empty(t, images)
+	})
+
+	t.Run("deduplicate", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID1 := sample.NewLaptop().Id
+		laptopID2 := sample.NewLaptop().Id
+
+		//同一个laptop重复保存相同内容时返回已有的图片，不同laptop之间共用内容
+		id1, err := store.Save(laptopID1, ".png", "image/png", strings.NewReader("shared data"))
+		require.NoError(t, err)
+		id2, err := store.Save(laptopID1, ".png", "image/png", strings.NewReader("shared data"))
+		require.NoError(t, err)
+		require.Equal(t, id1, id2)
+		id3, err := store.Save(laptopID2, ".png", "image/png", strings.NewReader("shared data"))
+		require.NoError(t, err)
+		require.NotEqual(t, id1, id3)
+
+		sum := sha256.Sum256([]byte("shared data"))
+		info1, err := store.Find(id1)
+		require.NoError(t, err)
+		info3, err := store.Find(id3)
+		require.NoError(t, err)
+		require.Equal(t, hex.EncodeToString(sum[:]), info1.Checksum)
+		require.Equal(t, info1.Checksum, info3.Checksum)
+		require.Equal(t, laptopID2, info3.LaptopID)
+
+		//缩略图也在相同内容的图片之间共用
+		require.NoError(t, store.SaveVariant(id1, 128, "image/png", strings.NewReader("variant")))
+		info3, err = store.Find(id3)
+		require.NoError(t, err)
+		require.Equal(t, []int{128}, info3.Variants)
+
+		//删除一个图片不影响引用相同内容的其他图片
+		require.NoError(t, store.Delete(id1))
+		_, reader, err := store.Open(id3)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, "shared data", string(data))
+		_, reader, err = store.OpenVariant(id3, 128)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+
+		require.NoError(t, store.Delete(id3))
+		_, _, err = store.Open(id3)
+		require.ErrorIs(t, err, service.ErrNotFound)
+	})
+
+	t.Run("variants", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		id, err := store.Save(laptopID, ".webp", "image/webp", strings.NewReader("original"))
+		require.NoError(t, err)
+		_, _, err = store.OpenVariant(id, 128)
+		require.ErrorIs(t, err, service.ErrNotFound)
+		require.ErrorIs(t, store.SaveVariant("missing", 128, "image/png", strings.NewReader("variant")), service.ErrNotFound)
+
+		require.NoError(t, store.SaveVariant(id, 512, "image/png", strings.NewReader("variant 512")))
+		require.NoError(t, store.SaveVariant(id, 128, "image/png", strings.NewReader("variant 128")))
+		info, reader, err := store.OpenVariant(id, 128)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, "variant 128", string(data))
+		require.Equal(t, id, info.ID)
+		require.Equal(t, laptopID, info.LaptopID)
+		require.Equal(t, "image/png", info.MIMEType)
+		require.Equal(t, 128, info.Variant)
+		require.EqualValues(t, len(data), info.Size)
+
+		//原图不受影响
+		found, err := store.Find(id)
+		require.NoError(t, err)
+		require.Equal(t, []int{128, 512}, found.Variants)
+		require.Equal(t, 0, found.Variant)
+		require.Equal(t, "image/webp", found.MIMEType)
+		found.Variants[0] = 1
+		found, err = store.Find(id)
+		require.NoError(t, err)
+		require.Equal(t, []int{128, 512}, found.Variants)
+
+		//删除原图时同时删除缩略图
+		require.NoError(t, store.Delete(id))
+		_, _, err = store.OpenVariant(id, 512)
+		require.ErrorIs(t, err, service.ErrNotFound)
+	})
+
+	t.Run("concurrent_saves", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		const writers = 8
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := store.Save(laptopID, ".png", "image/png", strings.NewReader(fmt.Sprintf("image %d", i)))
+				assert.NoError(t, err)
+				_, err = store.ListByLaptop(laptopID)
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		images, err := store.ListByLaptop(laptopID)
+		require.NoError(t, err)
+		require.Len(t, images, writers)
+	})
+}
+
+// TestUploadStore 测试UploadStore的实现，newStore每次调用都需要返回一个空的存储器，会话有效期需要大于测试时长
+func TestUploadStore(t *testing.T, newStore func(t *testing.T) service.UploadStore) {
+	t.Run("create_and_find", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		laptopID := sample.NewLaptop().Id
+
+		session, err := store.Create(laptopID, ".png", "checksum")
+		require.NoError(t, err)
+		require.NotEmpty(t, session.ID)
+		require.Equal(t, laptopID, session.LaptopID)
+		require.Equal(t, ".png", session.ImageType)
+		require.Equal(t, "checksum", session.Checksum)
+		require.Zero(t, session.Offset)
+		require.True(t, session.ExpiresAt.After(time.Now()))
+
+		found, err := store.Find(session.ID)
+		require.NoError(t, err)
+		require.Equal(t, session, found)
+		found, err = store.Find("missing")
+		require.NoError(t, err)
+		require.Nil(t, found)
+	})
+
+	t.Run("append_and_open", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		session, err := store.Create(sample.NewLaptop().Id, ".png", "")
+		require.NoError(t, err)
+
+		appended, err := store.Append(session.ID, 0, []byte("hello "))
+		require.NoError(t, err)
+		require.EqualValues(t, 6, appended.Offset)
+		require.False(t, appended.ExpiresAt.Before(session.ExpiresAt))
+
+		//起始位置必须等于已接收的字节数
+		for _, offset := range []int64{0, 3, 7} {
+			_, err = store.Append(session.ID, offset, []byte("again"))
+			require.ErrorIs(t, err, service.ErrOffsetMismatch)
+		}
+		_, err = store.Append("missing", 0, []byte("data"))
+		require.ErrorIs(t, err, service.ErrNotFound)
+
+		appended, err = store.Append(session.ID, 6, []byte("world"))
+		require.NoError(t, err)
+		require.EqualValues(t, 11, appended.Offset)
+
+		found, reader, err := store.Open(session.ID)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, "hello world", string(data))
+		require.EqualValues(t, 11, found.Offset)
+
+		_, _, err = store.Open("missing")
+		require.ErrorIs(t, err, service.ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		session, err := store.Create(sample.NewLaptop().Id, ".png", "")
+		require.NoError(t, err)
+		_, err = store.Append(session.ID, 0, []byte("data"))
+		require.NoError(t, err)
+
+		require.NoError(t, store.Delete(session.ID))
+		require.ErrorIs(t, store.Delete(session.ID), service.ErrNotFound)
+		found, err := store.Find(session.ID)
+		require.NoError(t, err)
+		require.Nil(t, found)
+		_, _, err = store.Open(session.ID)
+		require.ErrorIs(t, err, service.ErrNotFound)
+		_, err = store.Append(session.ID, 4, []byte("data"))
+		require.ErrorIs(t, err, service.ErrNotFound)
+	})
+
+	t.Run("delete_expired", func(t *testing.T) {
+		t.Parallel()
+		store := newStore(t)
+		expired, err := store.Create(sample.NewLaptop().Id, ".png", "")
+		require.NoError(t, err)
+		active, err := store.Create(sample.NewLaptop().Id, ".png", "")
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond) //接收数据后延长有效期，保证两个会话的过期时间不同
+		active, err = store.Append(active.ID, 0, []byte("data"))
+		require.NoError(t, err)
+		require.True(t, active.ExpiresAt.After(expired.ExpiresAt))
+
+		//在两个会话的过期时间之间清除，只删除先过期的会话
+		deleted, err := store.DeleteExpired(expired.ExpiresAt.Add(time.Nanosecond))
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted)
+		found, err := store.Find(expired.ID)
+		require.NoError(t, err)
+		require.Nil(t, found)
+		found, err = store.Find(active.ID)
+		require.NoError(t, err)
+		require.Equal(t, active, found)
+
+		deleted, err = store.DeleteExpired(active.ExpiresAt.Add(time.Nanosecond))
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted)
+		found, err = store.Find(active.ID)
+		require.NoError(t, err)
+		require.Nil(t, found)
+	})
+}
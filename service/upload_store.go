@@ -0,0 +1,245 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrOffsetMismatch 上传的数据块的起始位置与已接收的字节数不一致
+var ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+const _uploadPartExt = ".part" //暂存上传数据的文件扩展名
+
+// UploadStore 断点续传上传会话存储器接口，已接收的数据暂存在存储器中，完成上传后再保存到ImageStore
+type UploadStore interface {
+	// Create 新建上传会话，checksum为客户端提供的图片内容的SHA-256，可以为空
+	Create(laptopID, imageType, checksum string) (*UploadSession, error)
+	// Find 查询上传会话，不存在时返回nil
+	Find(uploadID string) (*UploadSession, error)
+	// Append 在offset处写入数据并延长会话有效期，offset与已接收的字节数不一致时返回ErrOffsetMismatch，会话不存在时返回ErrNotFound
+	Append(uploadID string, offset int64, data []byte) (*UploadSession, error)
+	// Open 打开已接收的数据用于读取，会话不存在时返回ErrNotFound，调用方需要关闭返回的reader
+	Open(uploadID string) (*UploadSession, io.ReadCloser, error)
+	// Delete 删除上传会话及已接收的数据，不存在时返回ErrNotFound
+	Delete(uploadID string) error
+	// DeleteExpired 删除有效期在now之前的上传会话，返回删除的数量
+	DeleteExpired(now time.Time) (int, error)
+}
+
+// UploadSession 断点续传的上传会话
+type UploadSession struct {
+	ID        string
+	LaptopID  string
+	ImageType string
+	Checksum  string    //客户端提供的图片内容的SHA-256，为空时不校验
+	Offset    int64     //已接收的字节数
+	ExpiresAt time.Time //超过该时间未继续上传的会话会被清除
+}
+
+// DiskUploadStore 将已接收的数据暂存在硬盘上的上传会话存储器，会话信息只保存在内存中
+type DiskUploadStore struct {
+	mutex        sync.Mutex
+	uploadFolder string                    //暂存数据的文件夹路径
+	ttl          time.Duration             //会话的有效期，每次接收数据后重新计算
+	sessions     map[string]*UploadSession //上传会话id -> 上传会话
+	done         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// OpenDiskUploadStore 创建暂存数据的文件夹并删除上次运行遗留的数据，cleanupInterval大于0时按该间隔在后台清除过期的会话
+func OpenDiskUploadStore(uploadFolder string, ttl, cleanupInterval time.Duration) (*DiskUploadStore, error) {
+	err := os.MkdirAll(uploadFolder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create upload folder: %w", err)
+	}
+	//会话信息不会持久化，重启后之前暂存的数据无法继续上传
+	paths, err := filepath.Glob(filepath.Join(uploadFolder, "*"+_uploadPartExt))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list upload folder: %w", err)
+	}
+	for _, path := range paths {
+		err = os.Remove(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot remove stale upload: %w", err)
+		}
+	}
+
+	store := &DiskUploadStore{
+		uploadFolder: uploadFolder,
+		ttl:          ttl,
+		sessions:     make(map[string]*UploadSession),
+		done:         make(chan struct{}),
+	}
+	if cleanupInterval > 0 {
+		store.wg.Add(1)
+		go store.cleanupLoop(cleanupInterval)
+	}
+	return store, nil
+}
+
+// path 上传会话暂存数据的文件路径
+func (store *DiskUploadStore) path(uploadID string) string {
+	return filepath.Join(store.uploadFolder, uploadID+_uploadPartExt)
+}
+
+func (store *DiskUploadStore) Create(laptopID, imageType, checksum string) (*UploadSession, error) {
+	uploadID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate upload id: %w", err)
+	}
+	session := &UploadSession{
+		ID:        uploadID.String(),
+		LaptopID:  laptopID,
+		ImageType: imageType,
+		Checksum:  checksum,
+		ExpiresAt: time.Now().Add(store.ttl),
+	}
+
+	file, err := os.Create(store.path(session.ID))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create upload file: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create upload file: %w", err)
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.sessions[session.ID] = session
+	other := *session
+	return &other, nil
+}
+
+func (store *DiskUploadStore) Find(uploadID string) (*UploadSession, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	session := store.sessions[uploadID]
+	if session == nil {
+		return nil, nil
+	}
+	other := *session
+	return &other, nil
+}
+
+func (store *DiskUploadStore) Append(uploadID string, offset int64, data []byte) (*UploadSession, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	session := store.sessions[uploadID]
+	if session == nil {
+		return nil, ErrNotFound
+	}
+	if offset != session.Offset {
+		return nil, fmt.Errorf("%w: expected offset %d, got %d", ErrOffsetMismatch, session.Offset, offset)
+	}
+
+	//写入失败时已接收的字节数不变，之后从同一位置重新写入会覆盖不完整的数据
+	file, err := os.OpenFile(store.path(uploadID), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open upload file: %w", err)
+	}
+	defer file.Close()
+	_, err = file.WriteAt(data, offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write upload file: %w", err)
+	}
+
+	session.Offset += int64(len(data))
+	session.ExpiresAt = time.Now().Add(store.ttl)
+	other := *session
+	return &other, nil
+}
+
+func (store *DiskUploadStore) Open(uploadID string) (*UploadSession, io.ReadCloser, error) {
+	session, err := store.Find(uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session == nil {
+		return nil, nil, ErrNotFound
+	}
+	file, err := os.Open(store.path(uploadID))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open upload file: %w", err)
+	}
+	//文件末尾可能有写入失败的数据，只读取已接收的部分
+	reader := struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, session.Offset), file}
+	return session, reader, nil
+}
+
+func (store *DiskUploadStore) Delete(uploadID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.sessions[uploadID] == nil {
+		return ErrNotFound
+	}
+	return store.delete(uploadID)
+}
+
+func (store *DiskUploadStore) DeleteExpired(now time.Time) (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	deleted := 0
+	for uploadID, session := range store.sessions {
+		if !session.ExpiresAt.Before(now) {
+			continue
+		}
+		err := store.delete(uploadID)
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// delete 删除上传会话及暂存的文件，调用方需要持有锁
+func (store *DiskUploadStore) delete(uploadID string) error {
+	delete(store.sessions, uploadID)
+	err := os.Remove(store.path(uploadID))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove upload file: %w", err)
+	}
+	return nil
+}
+
+// cleanupLoop 定期清除过期的上传会话，直到Close
+func (store *DiskUploadStore) cleanupLoop(interval time.Duration) {
+	defer store.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-store.done:
+			return
+		case now := <-ticker.C:
+			deleted, err := store.DeleteExpired(now)
+			if err != nil {
+				log.Printf("cannot delete expired uploads: %v", err)
+			}
+			if deleted > 0 {
+				log.Printf("deleted %d expired uploads", deleted)
+			}
+		}
+	}
+}
+
+// Close 停止后台清除过期的上传会话
+func (store *DiskUploadStore) Close() error {
+	close(store.done)
+	store.wg.Wait()
+	return nil
+}
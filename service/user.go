@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
+	"pcbook/pb"
 )
 
 type User struct {
@@ -40,3 +41,21 @@ func (user *User) Clone() *User {
 		Role:           user.Role,
 	}
 }
+
+// toProto 转换为持久化使用的proto对象
+func (user *User) toProto() *pb.StoredUser {
+	return &pb.StoredUser{
+		Username:       user.Username,
+		HashedPassword: user.HashedPassword,
+		Role:           user.Role,
+	}
+}
+
+// userFromProto 从持久化的proto对象创建User对象
+func userFromProto(user *pb.StoredUser) *User {
+	return &User{
+		Username:       user.GetUsername(),
+		HashedPassword: user.GetHashedPassword(),
+		Role:           user.GetRole(),
+	}
+}
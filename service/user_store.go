@@ -1,6 +1,7 @@
 package service
 
 import (
+	"pcbook/pb"
 	"sync"
 )
 
@@ -12,6 +13,7 @@ type UserStore interface {
 type InMemoryUserStore struct {
 	mutex sync.RWMutex
 	users map[string]*User
+	wal   mutationLog //不为nil时，修改数据之前先记录变更
 }
 
 func NewInMemoryUserStore() *InMemoryUserStore {
@@ -28,6 +30,10 @@ func (store *InMemoryUserStore) Save(user *User) error {
 		return ErrAlreadyExists
 	}
 	other := user.Clone()
+	err := appendMutation(store.wal, &pb.StoreMutation{Mutation: &pb.StoreMutation_PutUser{PutUser: other.toProto()}})
+	if err != nil {
+		return err
+	}
 	store.users[user.Username] = other
 	return nil
 }
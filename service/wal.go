@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"hash/crc32"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"pcbook/pb"
+	"sort"
+	"sync"
+)
+
+const _walRecordHeaderSize = 8 //每条记录前的长度和crc32校验码，各4字节
+
+var ErrCorruptLog = errors.New("write-ahead log is corrupt")
+
+// mutationLog 记录存储器的变更，存储器在修改内存数据之前调用，返回错误时不修改数据
+type mutationLog interface {
+	append(mutation *pb.StoreMutation) error
+}
+
+// appendMutation 在wal不为nil时记录变更
+func appendMutation(wal mutationLog, mutation *pb.StoreMutation) error {
+	if wal == nil {
+		return nil
+	}
+	return wal.append(mutation)
+}
+
+// writeAheadLog 预写日志，按编号分为多个文件，生成快照后之前的文件可以删除
+type writeAheadLog struct {
+	mutex   sync.Mutex
+	dir     string
+	segment uint64 //当前写入的文件编号
+	file    *os.File
+}
+
+// segmentPath 日志文件的路径，编号补零保证文件名按编号排序
+func segmentPath(dir string, segment uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("wal-%020d.log", segment))
+}
+
+// listSegments 返回dir中所有日志文件的编号，按升序排列
+func listSegments(dir string) ([]uint64, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, path := range paths {
+		var segment uint64
+		_, err := fmt.Sscanf(filepath.Base(path), "wal-%d.log", &segment)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i] < segments[j]
+	})
+	return segments, nil
+}
+
+// openWriteAheadLog 打开编号为segment的日志文件，追加写入
+func openWriteAheadLog(dir string, segment uint64) (*writeAheadLog, error) {
+	file, err := os.OpenFile(segmentPath(dir, segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open write-ahead log: %w", err)
+	}
+	return &writeAheadLog{
+		dir:     dir,
+		segment: segment,
+		file:    file,
+	}, nil
+}
+
+// append 写入一条记录，并同步到磁盘后返回
+func (wal *writeAheadLog) append(mutation *pb.StoreMutation) error {
+	payload, err := proto.Marshal(mutation)
+	if err != nil {
+		return fmt.Errorf("cannot marshal mutation: %w", err)
+	}
+	record := make([]byte, _walRecordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record, uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+	copy(record[_walRecordHeaderSize:], payload)
+
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	_, err = wal.file.Write(record)
+	if err != nil {
+		return fmt.Errorf("cannot write mutation: %w", err)
+	}
+	err = wal.file.Sync()
+	if err != nil {
+		return fmt.Errorf("cannot sync write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// rotate 关闭当前文件，之后的记录写入下一个编号的文件，返回新的编号
+func (wal *writeAheadLog) rotate() (uint64, error) {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+
+	file, err := os.OpenFile(segmentPath(wal.dir, wal.segment+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("cannot open write-ahead log: %w", err)
+	}
+	wal.file.Close()
+	wal.file = file
+	wal.segment++
+	return wal.segment, nil
+}
+
+// removeBefore 删除编号小于segment的日志文件
+func (wal *writeAheadLog) removeBefore(segment uint64) error {
+	segments, err := listSegments(wal.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if s >= segment {
+			break
+		}
+		err := os.Remove(segmentPath(wal.dir, s))
+		if err != nil {
+			return fmt.Errorf("cannot remove write-ahead log: %w", err)
+		}
+	}
+	return nil
+}
+
+func (wal *writeAheadLog) close() error {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	return wal.file.Close()
+}
+
+// replaySegment 依次读取日志文件中的记录并调用apply
+// last为true时表示最后一个文件，写入过程中崩溃可能导致最后一条记录不完整，此时截断该记录
+func replaySegment(path string, last bool, apply func(mutation *pb.StoreMutation)) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read write-ahead log: %w", err)
+	}
+
+	offset := 0
+	for offset < len(data) {
+		rest := data[offset:]
+		complete := len(rest) >= _walRecordHeaderSize &&
+			len(rest)-_walRecordHeaderSize >= int(binary.BigEndian.Uint32(rest))
+		if !complete {
+			break
+		}
+		length := int(binary.BigEndian.Uint32(rest))
+		payload := rest[_walRecordHeaderSize : _walRecordHeaderSize+length]
+		end := offset + _walRecordHeaderSize + length
+
+		//校验失败的记录只有是最后一条时才可能是写入未完成
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(rest[4:]) {
+			if last && end == len(data) {
+				break
+			}
+			return fmt.Errorf("%w: checksum mismatch at offset %d of %s", ErrCorruptLog, offset, path)
+		}
+		mutation := &pb.StoreMutation{}
+		err := proto.Unmarshal(payload, mutation)
+		if err != nil {
+			return fmt.Errorf("%w: cannot unmarshal mutation at offset %d of %s: %v", ErrCorruptLog, offset, path, err)
+		}
+		apply(mutation)
+		offset = end
+	}
+
+	if offset == len(data) {
+		return nil
+	}
+	if !last {
+		return fmt.Errorf("%w: truncated record at offset %d of %s", ErrCorruptLog, offset, path)
+	}
+	log.Printf("truncate incomplete record at offset %d of %s", offset, path)
+	err = os.Truncate(path, int64(offset))
+	if err != nil {
+		return fmt.Errorf("cannot truncate write-ahead log: %w", err)
+	}
+	return nil
+}